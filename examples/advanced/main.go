@@ -114,10 +114,7 @@ func processAssistantMessage(msg *pkg.AssistantMessage) {
 		case pkg.ToolUseBlock:
 			fmt.Printf("\n[Tool Use] %s (ID: %s)\n", b.Name, b.ID)
 			if len(b.Input) > 0 {
-				fmt.Println("Input:")
-				for k, v := range b.Input {
-					fmt.Printf("  %s: %v\n", k, v)
-				}
+				fmt.Printf("Input:\n%s\n", b.InputJSON())
 			}
 			
 		case pkg.ToolResultBlock:
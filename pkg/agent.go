@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ToolHandler runs a client-side tool with the input Claude supplied. The
+// returned value becomes the tool_result content; an error is sent back
+// as an error result carrying its message.
+type ToolHandler func(ctx context.Context, input map[string]interface{}) (interface{}, error)
+
+// defaultMaxIterations caps an Agent's tool round-trips per Run when
+// MaxIterations is zero
+const defaultMaxIterations = 25
+
+// Agent drives a connected Client through turns, answering tool calls for
+// registered tools as they arrive.
+type Agent struct {
+	// MaxIterations caps how many tool round-trips a Run answers. The
+	// turn is interrupted when Claude asks for more, and Run returns a
+	// MaxIterationsError. Zero means 25; negative means no limit.
+	MaxIterations int
+
+	client *Client
+
+	mu       sync.Mutex
+	tools    map[string]ToolHandler
+	timeouts map[string]time.Duration
+}
+
+// NewAgent creates an agent for client, which must be connected before
+// Run is called.
+func NewAgent(client *Client) *Agent {
+	return &Agent{
+		client:   client,
+		tools:    make(map[string]ToolHandler),
+		timeouts: make(map[string]time.Duration),
+	}
+}
+
+// RegisterTool makes the agent answer tool calls named name with handler.
+func (a *Agent) RegisterTool(name string, handler ToolHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.tools[name] = handler
+}
+
+// SetToolTimeout bounds how long the handler of the named tool may run. A
+// handler that exceeds it has its context cancelled and Claude receives a
+// "tool timed out" error result, so a hung tool can't stall the
+// conversation. Zero removes the limit.
+func (a *Agent) SetToolTimeout(name string, d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if d <= 0 {
+		delete(a.timeouts, name)
+		return
+	}
+	a.timeouts[name] = d
+}
+
+// Run sends prompt and services the turn until its result arrives,
+// running registered tools for the tool calls Claude makes. Calls to
+// tools that are not registered are left for the CLI to handle.
+func (a *Agent) Run(ctx context.Context, prompt string) (*ResultMessage, error) {
+	maxIterations := a.MaxIterations
+	if maxIterations == 0 {
+		maxIterations = defaultMaxIterations
+	}
+
+	if err := a.client.SendMessage(ctx, prompt); err != nil {
+		return nil, err
+	}
+
+	// Stop the response goroutine if Run returns before the result
+	responseCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	iterations := 0
+	stopped := false
+	for msg := range a.client.ReceiveResponse(responseCtx) {
+		switch m := msg.(type) {
+		case *AssistantMessage:
+			toolUses := a.registeredToolUses(m)
+			if stopped || len(toolUses) == 0 {
+				continue
+			}
+			if maxIterations > 0 && iterations >= maxIterations {
+				if err := a.interrupt(ctx); err != nil {
+					return nil, err
+				}
+				stopped = true
+				continue
+			}
+			iterations++
+			for _, toolUse := range toolUses {
+				if err := a.handleToolUse(ctx, toolUse); err != nil {
+					return nil, err
+				}
+			}
+		case ResultMessage:
+			// The CLI still reports the interrupted turn's own result, which
+			// would otherwise be taken for the next turn's
+			if stopped {
+				m.Data.InterruptRequested = true
+				return nil, NewMaxIterationsError(maxIterations, &m)
+			}
+			return &m, nil
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if stopped {
+		return nil, NewMaxIterationsError(maxIterations, a.client.interruptedResult())
+	}
+	return nil, fmt.Errorf("response ended without a result")
+}
+
+// interrupt stops the turn once the agent has run out of iterations. A
+// late acknowledgment still counts, since the turn did stop.
+func (a *Agent) interrupt(ctx context.Context) error {
+	err := a.client.InterruptWithReason(ctx, "agent reached MaxIterations")
+	var timeoutErr *InterruptTimeoutError
+	if errors.As(err, &timeoutErr) && timeoutErr.Observed {
+		return nil
+	}
+	return err
+}
+
+// registeredToolUses returns the tool calls in msg that the agent has a
+// handler for.
+func (a *Agent) registeredToolUses(msg *AssistantMessage) []ToolUseBlock {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var toolUses []ToolUseBlock
+	for _, block := range msg.Content {
+		if toolUse, ok := block.(ToolUseBlock); ok && a.tools[toolUse.Name] != nil {
+			toolUses = append(toolUses, toolUse)
+		}
+	}
+	return toolUses
+}
+
+// handleToolUse runs the registered handler for toolUse, if any, and sends
+// its outcome back as a tool_result.
+func (a *Agent) handleToolUse(ctx context.Context, toolUse ToolUseBlock) error {
+	a.mu.Lock()
+	handler, ok := a.tools[toolUse.Name]
+	timeout := a.timeouts[toolUse.Name]
+	a.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	content, err := runToolHandler(ctx, handler, toolUse.Input, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return a.client.SendToolResult(ctx, toolUse.ID, err.Error(), true)
+	}
+	return a.client.SendToolResult(ctx, toolUse.ID, content, false)
+}
+
+type toolOutcome struct {
+	content interface{}
+	err     error
+}
+
+// runToolHandler calls handler, giving up after timeout when it is
+// positive. The handler keeps running in the background after a timeout
+// but its context is cancelled.
+func runToolHandler(ctx context.Context, handler ToolHandler, input map[string]interface{}, timeout time.Duration) (interface{}, error) {
+	if timeout <= 0 {
+		return handler(ctx, input)
+	}
+
+	toolCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan toolOutcome, 1)
+	go func() {
+		content, err := handler(toolCtx, input)
+		done <- toolOutcome{content, err}
+	}()
+
+	select {
+	case outcome := <-done:
+		return outcome.content, outcome.err
+	case <-toolCtx.Done():
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("tool timed out after %s", timeout)
+	}
+}
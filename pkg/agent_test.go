@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// agentMockScript calls tool "slow" once per prompt and reports the
+// tool_result it gets back as assistant text.
+const agentMockScript = `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tool-1","name":"slow","input":{}}]}}'
+    IFS= read -r answer
+    content=$(echo "$answer" | sed -n 's/.*"content":"\([^"]*\)".*/\1/p')
+    if echo "$answer" | grep -q '"is_error":true'; then
+        status=error
+    else
+        status=ok
+    fi
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"'"$status: $content"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`
+
+func TestAgent_ToolTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		delay    time.Duration
+		timeout  time.Duration
+		wantText string
+	}{
+		{name: "fast tool", delay: 0, timeout: time.Second, wantText: "ok: done"},
+		{name: "no timeout", delay: 50 * time.Millisecond, timeout: 0, wantText: "ok: done"},
+		{name: "slow tool", delay: 10 * time.Second, timeout: 100 * time.Millisecond, wantText: "error: tool timed out after 100ms"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, agentMockScript)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := NewClient(nil)
+			if err := client.Connect(ctx, ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+
+			agent := NewAgent(client)
+			agent.RegisterTool("slow", func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+				select {
+				case <-time.After(tt.delay):
+					return "done", nil
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			})
+			agent.SetToolTimeout("slow", tt.timeout)
+
+			start := time.Now()
+			if _, err := agent.Run(ctx, "Use the tool"); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Run() took %v, want the tool timeout to unblock it", elapsed)
+			}
+
+			if got := client.ResponseText(); got != tt.wantText {
+				t.Errorf("tool result reported by CLI = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+}
+
+// loopingMockScript asks for tool "step" after every message it reads,
+// forever, until it is interrupted.
+const loopingMockScript = `#!/bin/sh
+n=0
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"control_request"'; then
+        id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+        echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true}}'
+        echo '{"type":"system","message":{"role":"system","subtype":"interrupted"}}'
+        echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1","stopReason":"tool_use"}}}'
+        continue
+    fi
+    n=$((n+1))
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tool-'$n'","name":"step","input":{}}]}}'
+done
+`
+
+func TestAgent_MaxIterations(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxIterations int
+		wantCalls     int
+	}{
+		{name: "explicit cap", maxIterations: 3, wantCalls: 3},
+		{name: "default cap", maxIterations: 0, wantCalls: defaultMaxIterations},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, loopingMockScript)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			client := NewClient(nil)
+			if err := client.Connect(ctx, ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+
+			calls := 0
+			agent := NewAgent(client)
+			agent.MaxIterations = tt.maxIterations
+			agent.RegisterTool("step", func(ctx context.Context, input map[string]interface{}) (interface{}, error) {
+				calls++
+				return "again", nil
+			})
+
+			result, err := agent.Run(ctx, "Loop forever")
+			if result != nil {
+				t.Errorf("Run() result = %+v, want nil", result)
+			}
+			var iterErr *MaxIterationsError
+			if !errors.As(err, &iterErr) {
+				t.Fatalf("Run() error = %v, want *MaxIterationsError", err)
+			}
+			if iterErr.MaxIterations != tt.wantCalls {
+				t.Errorf("MaxIterations = %d, want %d", iterErr.MaxIterations, tt.wantCalls)
+			}
+			if iterErr.Result == nil || !iterErr.Result.Data.InterruptRequested || iterErr.Result.Data.StopReason != "tool_use" {
+				t.Errorf("Result = %+v, want the CLI's result marked interrupted", iterErr.Result)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("tool called %d times, want %d", calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import "strings"
+
+// loginPromptPatterns are lowercase fragments of what the CLI prints when
+// it is not authenticated and falls back to an interactive login.
+var loginPromptPatterns = []string{
+	"please log in",
+	"please login",
+	"please run /login",
+	"run `claude login`",
+	"press enter to open",
+	"open the following url",
+	"browser didn't open",
+	"not logged in",
+	"invalid api key",
+}
+
+// detectLoginPrompt reports whether stderr output shows the CLI asking for
+// an interactive login.
+func detectLoginPrompt(stderr string) bool {
+	lower := strings.ToLower(stderr)
+	for _, pattern := range loginPromptPatterns {
+		if strings.Contains(lower, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxLoginPromptLen is the length of the longest login prompt pattern
+var maxLoginPromptLen = func() int {
+	longest := 0
+	for _, pattern := range loginPromptPatterns {
+		longest = max(longest, len(pattern))
+	}
+	return longest
+}()
+
+// loginPromptScanner looks for a login prompt in stderr as it arrives. It
+// keeps the end of the previous chunk so a prompt split across reads is
+// still found without rescanning everything before it.
+type loginPromptScanner struct {
+	tail string
+}
+
+// scan reports whether chunk, joined to the end of the previous one, shows
+// a login prompt.
+func (s *loginPromptScanner) scan(chunk []byte) bool {
+	text := s.tail + string(chunk)
+	found := detectLoginPrompt(text)
+	if keep := maxLoginPromptLen - 1; len(text) > keep {
+		text = text[len(text)-keep:]
+	}
+	s.tail = text
+	return found
+}
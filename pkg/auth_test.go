@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectLoginPrompt(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   bool
+	}{
+		{name: "empty", stderr: "", want: false},
+		{name: "unrelated warning", stderr: "warning: update available\n", want: false},
+		{name: "browser prompt", stderr: "Press Enter to open your browser and log in...", want: true},
+		{name: "mixed case", stderr: "Invalid API key · Please run /login", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectLoginPrompt(tt.stderr); got != tt.want {
+				t.Errorf("detectLoginPrompt(%q) = %v, want %v", tt.stderr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginPromptScanner(t *testing.T) {
+	var s loginPromptScanner
+	chunks := []string{strings.Repeat("x", 5000), "Press Enter to o", "pen your browser"}
+	for i, chunk := range chunks {
+		want := i == len(chunks)-1
+		if got := s.scan([]byte(chunk)); got != want {
+			t.Errorf("scan(chunk %d) = %v, want %v", i, got, want)
+		}
+	}
+	if len(s.tail) >= maxLoginPromptLen {
+		t.Errorf("scanner kept %d bytes, want fewer than %d", len(s.tail), maxLoginPromptLen)
+	}
+}
+
+func TestQuery_LoginPromptWithoutAuthTimeout(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo "warning: invalid api key in ~/.config/other-tool" >&2
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+`)
+
+	if _, err := Query(context.Background(), "Hello", nil); err != nil {
+		t.Errorf("Query() error = %v, want login prompts ignored without AuthTimeout", err)
+	}
+}
+
+func TestQuery_AuthRequired(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		options *ClaudeCodeOptions
+		reason  string
+	}{
+		{
+			name: "login prompt",
+			script: `#!/bin/sh
+echo "Not logged in. Press Enter to open your browser..." >&2
+exec sleep 30
+`,
+			options: &ClaudeCodeOptions{AuthTimeout: 10 * time.Second},
+			reason:  "login prompt",
+		},
+		{
+			name: "silent wait for tty",
+			script: `#!/bin/sh
+exec sleep 30
+`,
+			options: &ClaudeCodeOptions{AuthTimeout: 200 * time.Millisecond},
+			reason:  "no output within 200ms",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, tt.script)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			start := time.Now()
+			_, err := Query(ctx, "Hello", tt.options)
+
+			var authErr *AuthRequiredError
+			if !errors.As(err, &authErr) {
+				t.Fatalf("Query() error = %v, want *AuthRequiredError", err)
+			}
+			if !errors.Is(err, ErrAuthRequired) {
+				t.Errorf("errors.Is(%v, ErrAuthRequired) = false, want true", err)
+			}
+			if !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.reason)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Query() took %v, want it to fail fast instead of hanging", elapsed)
+			}
+		})
+	}
+}
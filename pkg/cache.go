@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// QueryCache stores Query results keyed by a hash of the prompt and
+// options. It is only useful for deterministic prompts, e.g. those run at
+// temperature 0. Implementations must be safe for concurrent use.
+type QueryCache interface {
+	Get(key string) (*QueryResult, bool)
+	Put(key string, result *QueryResult)
+}
+
+// queryCacheKey derives the cache key for a query from the prompt and the
+// JSON form of options. Fields excluded from JSON, such as writers, caches
+// and callbacks, are not part of the key; queryCacheable rules out the ones
+// that change the result.
+func queryCacheKey(prompt string, options *ClaudeCodeOptions) (string, error) {
+	data, err := json.Marshal(struct {
+		Prompt  string             `json:"prompt"`
+		Options *ClaudeCodeOptions `json:"options"`
+	}{
+		Prompt:  prompt,
+		Options: options,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// queryCacheable reports whether a query with options may use its
+// QueryCache. ToolResultInterceptor and Redactor are functions, which can't
+// be keyed, so a result cached with one could be served to a query with
+// another.
+func queryCacheable(options *ClaudeCodeOptions) bool {
+	return options.QueryCache != nil && options.ToolResultInterceptor == nil && options.Redactor == nil
+}
+
+// MemoryQueryCache is an unbounded in-memory QueryCache. Cached results are
+// shared between callers and must not be modified.
+type MemoryQueryCache struct {
+	mu      sync.Mutex
+	results map[string]*QueryResult
+}
+
+func NewMemoryQueryCache() *MemoryQueryCache {
+	return &MemoryQueryCache{
+		results: make(map[string]*QueryResult),
+	}
+}
+
+func (c *MemoryQueryCache) Get(key string) (*QueryResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result, ok := c.results[key]
+	return result, ok
+}
+
+func (c *MemoryQueryCache) Put(key string, result *QueryResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.results[key] = result
+}
@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuery_Cache(t *testing.T) {
+	countFile := filepath.Join(t.TempDir(), "runs")
+	setupScriptMockCLI(t, `#!/bin/sh
+echo run >> '`+countFile+`'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Cached answer"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":5,"outputTokens":3,"backgroundTokens":0},"cost":{"inputTokenCost":0.0005,"outputTokenCost":0.0006,"backgroundTokenCost":0,"totalCost":0.0011},"sessionId":"cache-session","interruptRequested":false}}}'
+`)
+
+	runs := func() int {
+		data, err := os.ReadFile(countFile)
+		if err != nil {
+			return 0
+		}
+		return strings.Count(string(data), "run")
+	}
+
+	ctx := context.Background()
+	cache := NewMemoryQueryCache()
+	options := &ClaudeCodeOptions{QueryCache: cache}
+
+	first, err := Query(ctx, "What is 2+2?", options)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	second, err := Query(ctx, "What is 2+2?", options)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	if got := runs(); got != 1 {
+		t.Errorf("CLI runs = %d, want 1", got)
+	}
+	if second.Stdout != first.Stdout {
+		t.Errorf("cached Stdout = %q, want %q", second.Stdout, first.Stdout)
+	}
+
+	// A different prompt or different options must miss
+	if _, err := Query(ctx, "What is 3+3?", options); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if _, err := Query(ctx, "What is 2+2?", &ClaudeCodeOptions{QueryCache: cache, Model: "other"}); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got := runs(); got != 3 {
+		t.Errorf("CLI runs = %d, want 3", got)
+	}
+
+	// Functions can't be part of the key, so they bypass the cache
+	identity := func(block ToolResultBlock) ToolResultBlock { return block }
+	if _, err := Query(ctx, "What is 2+2?", &ClaudeCodeOptions{QueryCache: cache, ToolResultInterceptor: identity}); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if _, err := Query(ctx, "What is 2+2?", &ClaudeCodeOptions{QueryCache: cache, Redactor: strings.ToUpper}); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if got := runs(); got != 5 {
+		t.Errorf("CLI runs = %d, want 5", got)
+	}
+}
+
+func TestQuery_CacheSkipsFailures(t *testing.T) {
+	setupQueryMockCLI(t, "error")
+
+	cache := NewMemoryQueryCache()
+	if _, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{QueryCache: cache}); err == nil {
+		t.Fatal("Query() error = nil, want error")
+	}
+	if len(cache.results) != 0 {
+		t.Errorf("cache entries = %d, want 0", len(cache.results))
+	}
+}
+
+func TestQuery_CacheSkipsErrorResults(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1","isError":true}}}'
+`)
+
+	cache := NewMemoryQueryCache()
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{QueryCache: cache})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if !result.Result.Data.IsError {
+		t.Fatal("Query() result IsError = false, want true")
+	}
+	if len(cache.results) != 0 {
+		t.Errorf("cache entries = %d, want 0", len(cache.results))
+	}
+}
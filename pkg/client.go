@@ -2,17 +2,89 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
+)
+
+const (
+	// continuePrompt is sent to resume a response truncated by max_tokens
+	continuePrompt          = "continue"
+	defaultMaxContinuations = 3
+
+	// trailingMessageGrace is how long ReceiveResponse waits for further
+	// trailing messages when IncludeTrailingMessages is set
+	trailingMessageGrace = 100 * time.Millisecond
 )
 
 type Client struct {
 	transport   *transport
 	options     *ClaudeCodeOptions
 	messages    []Message
+	// Messages spilled to options.HistoryFile, older than those in messages
+	history     *historyFile
 	mu          sync.Mutex
+	// Signalled on c.mu when history grows or the client closes
+	historyCond *sync.Cond
 	closed      bool
+	// Set by CloseAfterResult: no new sends, but the turn may finish
+	closing     bool
 	connected   bool
+	startedAt   time.Time
+	closedAt    time.Time
+	// How long the last Close took to tear down the transport
+	shutdownDuration time.Duration
+
+	// Whether this client holds its SessionID in the process registry
+	sessionClaimed bool
+
+	// The most recent CLI launch, kept after Close for diagnostics
+	lastCommand *launchCommand
+
+	// Tool calls seen in the stream, for validating SendToolResult
+	pendingTools  []ToolUseBlock
+	answeredTools map[string]bool
+
+	// Assistant text of the current turn, stitched across continuations
+	turnText      strings.Builder
+	continuations int
+	continuing    bool
+	// Thinking of the current turn, kept apart from its text
+	turnThinking strings.Builder
+
+	// Text of the most recent assistant message, kept so partial output
+	// survives an interrupt
+	lastAssistantText string
+	interrupted       bool
+
+	// Working directory reported by the CLI's init message
+	initCwd string
+	// Session ID from the first init or result message that carried one
+	sessionID string
+	// Assistant turns received, for TurnCount
+	turns turnCounter
+
+	// Span of the turn in progress when options has a Tracer
+	turnSpan *turnSpan
+
+	// Why the client was closed, for the session report
+	closeReason CloseReason
+
+	// Progress of the current turn, for Progress
+	progress turnProgress
+
+	// Transcript played back instead of launching the CLI, see ReplayClient
+	replayPath string
+
+	// Usage and cost summed over every result seen
+	totalUsage ResultUsage
+	totalCost  ResultCost
+
+	// Set by a result and cleared by the next turn's first non-system
+	// message; system messages in between trail the finished turn
+	afterResult bool
 }
 
 // NewClient creates a new client instance without connecting to the CLI.
@@ -22,11 +94,31 @@ func NewClient(options *ClaudeCodeOptions) *Client {
 		options = &ClaudeCodeOptions{}
 	}
 
-	return &Client{
-		options:   options,
-		messages:  make([]Message, 0),
-		connected: false,
+	c := &Client{
+		options:       options,
+		messages:      make([]Message, 0),
+		connected:     false,
+		answeredTools: make(map[string]bool),
 	}
+	c.historyCond = sync.NewCond(&c.mu)
+	return c
+}
+
+// WithClient connects a new client without an initial prompt, runs fn
+// with it and closes it when fn returns or panics. It returns fn's error,
+// or Close's if fn succeeded.
+func WithClient(ctx context.Context, opts *ClaudeCodeOptions, fn func(*Client) error) (err error) {
+	client := NewClient(opts)
+	if err := client.Connect(ctx, ""); err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := client.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	return fn(client)
 }
 
 // Connect establishes a connection to the Claude CLI.
@@ -43,16 +135,42 @@ func (c *Client) Connect(ctx context.Context, prompt string) error {
 		return fmt.Errorf("client is closed")
 	}
 
-	transport, err := newTransport(ctx, c.options, true)
+	if err := c.options.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.options.checkPrompt(prompt); err != nil {
+		return err
+	}
+
+	if c.options.SessionID != "" && !c.options.AllowSharedSession {
+		if err := claimSession(c.options.SessionID, c); err != nil {
+			return err
+		}
+		c.sessionClaimed = true
+	}
+
+	var transport *transport
+	var err error
+	if c.replayPath != "" {
+		transport, err = newReplayTransport(c.options, c.replayPath)
+	} else {
+		transport, err = newTransport(ctx, c.options, true)
+	}
 	if err != nil {
+		c.releaseSession()
 		return err
 	}
 
 	c.transport = transport
+	c.lastCommand = transport.command
 	c.connected = true
+	c.startedAt = c.options.clock().Now()
 
 	// If a prompt is provided, send it as the initial message
 	if prompt != "" {
+		c.startProgress()
+		c.startTurnSpan(ctx)
 		msg := UserMessage{
 			Role:    MessageRoleUser,
 			Content: prompt,
@@ -64,26 +182,518 @@ func (c *Client) Connect(ctx context.Context, prompt string) error {
 }
 
 func (c *Client) SendMessage(ctx context.Context, prompt string) error {
+	return c.sendUserMessage(ctx, prompt, UserMessage{
+		Role:    MessageRoleUser,
+		Content: prompt,
+	})
+}
+
+// SendMessageWithImages sends prompt and images together as one user
+// message, the text first. Images over MaxFileUploadsBytes or
+// MaxImagePixels are rejected with an AttachmentTooLargeError before
+// anything is sent.
+func (c *Client) SendMessageWithImages(ctx context.Context, prompt string, images ...ImageBlock) error {
+	blocks := make([]ContentBlock, 0, len(images)+1)
+	if prompt != "" {
+		blocks = append(blocks, TextBlock{Type: "text", Text: prompt})
+	}
+	for _, image := range images {
+		blocks = append(blocks, image)
+	}
+	return c.sendUserMessage(ctx, prompt, UserMessage{
+		Role:   MessageRoleUser,
+		Blocks: blocks,
+	})
+}
+
+// SendMessageWithBlocks sends blocks as one user message, for turns that
+// mix content such as text, images and tool results. Tool results answer
+// their tool calls as SendToolResult would, though unlike it they aren't
+// checked against the outstanding calls. The text blocks together count
+// against MaxPromptChars.
+func (c *Client) SendMessageWithBlocks(ctx context.Context, blocks []ContentBlock) error {
+	if len(blocks) == 0 {
+		return fmt.Errorf("no content blocks to send")
+	}
+
+	var prompt strings.Builder
+	for _, block := range blocks {
+		if text, ok := block.(TextBlock); ok {
+			prompt.WriteString(text.Text)
+		}
+	}
+	return c.sendUserMessage(ctx, prompt.String(), UserMessage{
+		Role:   MessageRoleUser,
+		Blocks: blocks,
+	})
+}
+
+// sendUserMessage starts a new turn with msg, checking prompt, its text,
+// against MaxPromptChars and its attachments against their limits.
+func (c *Client) sendUserMessage(ctx context.Context, prompt string, msg UserMessage) error {
+	if err := c.options.checkAttachments(msg.Blocks); err != nil {
+		return err
+	}
+
 	c.mu.Lock()
 	if c.closed {
 		c.mu.Unlock()
 		return fmt.Errorf("client is closed")
 	}
+	if c.closing {
+		c.mu.Unlock()
+		return fmt.Errorf("client is closing")
+	}
 	if !c.connected {
 		c.mu.Unlock()
 		return fmt.Errorf("client is not connected, call Connect() first")
 	}
+	if err := c.options.checkPrompt(prompt); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	for _, block := range msg.Blocks {
+		if result, ok := block.(ToolResultBlock); ok {
+			if idx := c.pendingToolIndex(result.ToolUseID); idx >= 0 {
+				c.pendingTools = append(c.pendingTools[:idx], c.pendingTools[idx+1:]...)
+			}
+			c.answeredTools[result.ToolUseID] = true
+		}
+	}
+	c.startTurn()
+	c.startTurnSpan(ctx)
+	c.mu.Unlock()
+
+	return c.transport.sendMessage(ctx, msg, "", c.options.SessionID)
+}
+
+// startTurn resets per-turn state for a new user-initiated turn. It must be
+// called with c.mu held.
+func (c *Client) startTurn() {
+	c.turnText.Reset()
+	c.turnThinking.Reset()
+	c.continuations = 0
+	c.continuing = false
+	c.interrupted = false
+	c.startProgress()
+}
+
+// startTurnSpan starts tracing a new turn, ending any span left open by a
+// turn that never produced a result. It must be called with c.mu held.
+func (c *Client) startTurnSpan(ctx context.Context) {
+	c.turnSpan.end(nil)
+	c.turnSpan = startTurnSpan(ctx, c.options.Tracer, SpanNameTurn)
+}
+
+// ResponseText returns the assistant text of the current turn. When
+// AutoContinueOnTruncation is enabled, text from automatic continuations is
+// stitched onto the truncated response.
+func (c *Client) ResponseText() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.turnText.String()
+}
+
+// LastThinking returns the thinking of the current turn, or of the last
+// one once it has finished, with its blocks separated by newlines. It is
+// empty unless extended thinking is enabled with MaxThinkingTokens.
+func (c *Client) LastThinking() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.turnThinking.String()
+}
+
+// ThinkingStream consumes the current response like ReceiveResponse,
+// delivering the text of each thinking block as it arrives. The channel
+// closes when the response ends; the answer itself is left for
+// ResponseText and GetMessages.
+func (c *Client) ThinkingStream(ctx context.Context) <-chan string {
+	out := make(chan string, 10)
+	go func() {
+		defer close(out)
+		for msg := range c.ReceiveResponse(ctx) {
+			assistant, ok := msg.(*AssistantMessage)
+			if !ok {
+				continue
+			}
+			for _, block := range assistant.Content {
+				thinking, ok := block.(ThinkingBlock)
+				if !ok {
+					continue
+				}
+				select {
+				case out <- thinking.Thinking:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// SamplingParams overrides sampling settings for a single turn. Nil fields
+// leave the session's launch settings in effect.
+type SamplingParams struct {
+	Temperature *float64
+	TopP        *float64
+	TopK        *int
+}
+
+func (p SamplingParams) isZero() bool {
+	return p.Temperature == nil && p.TopP == nil && p.TopK == nil
+}
+
+// SendMessageWithParams sends a user message with per-turn sampling
+// overrides. The CLI's stream-json input has no way to carry sampling
+// parameters, so any override returns an *UnsupportedError without sending;
+// empty params behave exactly like SendMessage.
+func (c *Client) SendMessageWithParams(ctx context.Context, prompt string, params SamplingParams) error {
+	if !params.isZero() {
+		return NewUnsupportedError("per-message sampling parameters",
+			"the CLI's stream-json input does not accept sampling overrides; set Temperature in ClaudeCodeOptions instead")
+	}
+	return c.SendMessage(ctx, prompt)
+}
+
+// SendToolResult answers an outstanding tool_use with a tool_result block.
+// toolUseID must name a ToolUseBlock the client has received and that has
+// not been answered yet, either by an earlier SendToolResult or by a
+// tool_result already present in the stream.
+func (c *Client) SendToolResult(ctx context.Context, toolUseID string, content interface{}, isError bool) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return fmt.Errorf("client is closed")
+	}
+	if c.closing {
+		c.mu.Unlock()
+		return fmt.Errorf("client is closing")
+	}
+	if !c.connected {
+		c.mu.Unlock()
+		return fmt.Errorf("client is not connected, call Connect() first")
+	}
+	idx := c.pendingToolIndex(toolUseID)
+	if idx < 0 {
+		answered := c.answeredTools[toolUseID]
+		c.mu.Unlock()
+		if answered {
+			return fmt.Errorf("tool_use_id %q has already been answered", toolUseID)
+		}
+		return fmt.Errorf("unknown tool_use_id %q: no outstanding tool_use with that ID", toolUseID)
+	}
+	// Claim the call before sending so concurrent answers can't both pass
+	toolUse := c.pendingTools[idx]
+	c.pendingTools = append(c.pendingTools[:idx], c.pendingTools[idx+1:]...)
+	c.answeredTools[toolUseID] = true
 	c.mu.Unlock()
 
 	msg := UserMessage{
-		Role:    MessageRoleUser,
-		Content: prompt,
+		Role: MessageRoleUser,
+		Blocks: []ContentBlock{
+			ToolResultBlock{
+				Type:      "tool_result",
+				ToolUseID: toolUseID,
+				IsError:   isError,
+				Content:   content,
+			},
+		},
 	}
 
-	return c.transport.sendMessage(ctx, msg, "", c.options.SessionID)
+	if err := c.transport.sendMessage(ctx, msg, "", c.options.SessionID); err != nil {
+		c.mu.Lock()
+		delete(c.answeredTools, toolUseID)
+		c.pendingTools = append(c.pendingTools, toolUse)
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// record appends msg to the history and updates the client's bookkeeping.
+// It reports whether msg trails an already finished turn, such as a final
+// usage message the CLI writes after the result.
+func (c *Client) record(msg Message) (trailing bool) {
+	// Deferred first so OnMessage runs after the unlock and may call back
+	// into the client
+	if c.options.OnMessage != nil {
+		defer c.options.OnMessage(msg)
+	}
+	var newSessionID string
+	if c.options.OnSessionID != nil {
+		defer func() {
+			if newSessionID != "" {
+				c.options.OnSessionID(newSessionID)
+			}
+		}()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Deltas are repeated by the complete message that follows them, and
+	// have no ID to coalesce by, so only live consumers see them
+	assistant, isAssistant := msg.(*AssistantMessage)
+	if !(isAssistant && assistant.isDelta()) && !c.coalesce(msg) {
+		c.messages = append(c.messages, msg)
+		c.spillHistory()
+	}
+	c.historyCond.Broadcast()
+
+	switch m := msg.(type) {
+	case ResultMessage:
+		c.afterResult = true
+		c.totalUsage = addUsage(c.totalUsage, m.Data.Usage)
+		c.totalCost = addCost(c.totalCost, m.Data.Cost)
+	case SystemMessage:
+		trailing = c.afterResult && m.Subtype != SystemMessageSubtypeInit && m.Subtype != SystemMessageSubtypeInterrupted
+	case TurnSummaryMessage:
+		trailing = c.afterResult
+	default:
+		c.afterResult = false
+	}
+
+	if cwd := initCwd(msg); cwd != "" {
+		c.initCwd = cwd
+	}
+	c.turns.observe(msg)
+	if c.sessionID == "" {
+		c.sessionID = messageSessionID(msg)
+		newSessionID = c.sessionID
+	}
+
+	c.trackProgress(msg)
+
+	c.turnSpan.observe(msg)
+	if _, ok := msg.(ResultMessage); ok {
+		c.turnSpan.end(nil)
+		c.turnSpan = nil
+	}
+
+	if assistant, ok := msg.(*AssistantMessage); ok {
+		var text strings.Builder
+		for _, block := range assistant.Content {
+			switch b := block.(type) {
+			case TextBlock:
+				// Continuations pick up mid-sentence, so they are joined directly
+				if c.turnText.Len() > 0 && !c.continuing {
+					c.turnText.WriteString("\n")
+				}
+				c.turnText.WriteString(b.Text)
+				c.continuing = false
+				text.WriteString(b.Text)
+			case ThinkingBlock:
+				if c.turnThinking.Len() > 0 {
+					c.turnThinking.WriteString("\n")
+				}
+				c.turnThinking.WriteString(b.Thinking)
+			case ToolUseBlock:
+				if !c.answeredTools[b.ID] && c.pendingToolIndex(b.ID) < 0 {
+					c.pendingTools = append(c.pendingTools, b)
+				}
+			case ToolResultBlock:
+				// Tools the CLI ran itself are answered in the stream
+				c.answerTool(b.ToolUseID)
+			}
+		}
+		if text.Len() > 0 {
+			c.lastAssistantText = text.String()
+		}
+	}
+
+	// The CLI also echoes tool results back as user messages
+	if user, ok := msg.(UserMessage); ok {
+		for _, block := range user.Blocks {
+			if b, ok := block.(ToolResultBlock); ok {
+				c.answerTool(b.ToolUseID)
+			}
+		}
+	}
+
+	return trailing
+}
+
+// answerTool stops tracking toolUseID as pending. It must be called with
+// c.mu held.
+func (c *Client) answerTool(toolUseID string) {
+	if idx := c.pendingToolIndex(toolUseID); idx >= 0 {
+		c.pendingTools = append(c.pendingTools[:idx], c.pendingTools[idx+1:]...)
+	}
+	c.answeredTools[toolUseID] = true
+}
+
+// coalesce folds msg into the last history entry when both are partial
+// assistant messages of the same response and CoalesceAssistantMessages is
+// set, reporting whether it did. The stored message is replaced by a new
+// one so messages already delivered to the application stay unchanged. It
+// must be called with c.mu held.
+func (c *Client) coalesce(msg Message) bool {
+	if !c.options.CoalesceAssistantMessages || len(c.messages) == 0 {
+		return false
+	}
+	next, ok := msg.(*AssistantMessage)
+	if !ok || next.ID == "" {
+		return false
+	}
+	last, ok := c.messages[len(c.messages)-1].(*AssistantMessage)
+	if !ok || last.ID != next.ID {
+		return false
+	}
+
+	merged := &AssistantMessage{
+		ID:      last.ID,
+		Role:    last.Role,
+		Content: make([]ContentBlock, 0, len(last.Content)+len(next.Content)),
+	}
+	merged.Content = append(merged.Content, last.Content...)
+	for _, block := range next.Content {
+		// Text deltas continue the text block before them
+		if text, ok := block.(TextBlock); ok && len(merged.Content) > 0 {
+			if prev, ok := merged.Content[len(merged.Content)-1].(TextBlock); ok {
+				prev.Text += text.Text
+				merged.Content[len(merged.Content)-1] = prev
+				continue
+			}
+		}
+		merged.Content = append(merged.Content, block)
+	}
+
+	c.messages[len(c.messages)-1] = merged
+	return true
+}
+
+// LastCommand returns the executable path, arguments and environment of
+// the client's most recent CLI launch, with the values of secret-looking
+// flags and environment variables (API keys, tokens and the like)
+// redacted. All are empty if the client has never connected.
+func (c *Client) LastCommand() (path string, args []string, env []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lastCommand == nil {
+		return "", nil, nil
+	}
+	args = make([]string, len(c.lastCommand.args))
+	copy(args, c.lastCommand.args)
+	env = make([]string, len(c.lastCommand.env))
+	copy(env, c.lastCommand.env)
+	return c.lastCommand.path, args, env
+}
+
+// WorkingDir returns the directory the CLI works in, as reported by its
+// init message after resolving symlinks and normalizing the path. Until
+// the CLI reports one it falls back to options.Cwd, which is "" when the
+// CLI inherits this process's directory.
+func (c *Client) WorkingDir() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.initCwd != "" {
+		return c.initCwd
+	}
+	return c.options.Cwd
+}
+
+// SessionID returns the ID of the CLI session, once an init or result
+// message has reported it. Until then it falls back to options.SessionID.
+func (c *Client) SessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sessionID != "" {
+		return c.sessionID
+	}
+	return c.options.SessionID
+}
+
+// TurnCount returns the number of assistant turns received so far. The
+// messages the CLI sends for the content blocks of one response count
+// once, and streamed text deltas don't count.
+func (c *Client) TurnCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.turns.turns
+}
+
+// Stats returns counts of what the client has read from the CLI's stdout,
+// to help explain a stream that yields fewer messages than expected. They
+// stay available after Close.
+func (c *Client) Stats() StreamStats {
+	c.mu.Lock()
+	transport := c.transport
+	c.mu.Unlock()
+
+	if transport == nil {
+		return StreamStats{Messages: map[string]int{}}
+	}
+	return transport.stats.snapshot()
+}
+
+// TotalUsage returns the token usage summed over every result the client
+// has received.
+func (c *Client) TotalUsage() ResultUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.totalUsage
+}
+
+// TotalCost returns the cost summed over every result the client has
+// received.
+func (c *Client) TotalCost() ResultCost {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.totalCost
+}
+
+// LastShutdownDuration returns how long the last Close took to stop the
+// CLI and drain its output, or zero if the client hasn't been closed.
+// Slow shutdowns usually mean the CLI ignored SIGTERM and had to be killed
+// after ShutdownGrace.
+func (c *Client) LastShutdownDuration() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.shutdownDuration
+}
+
+// LastAssistantText returns the text of the most recent assistant message,
+// including partial output received before an interrupt.
+func (c *Client) LastAssistantText() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastAssistantText
+}
+
+// PendingToolCalls returns the tool_use blocks received so far that have no
+// tool_result yet, either from SendToolResult or from the CLI running the
+// tool itself, in the order they arrived.
+func (c *Client) PendingToolCalls() []ToolUseBlock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result := make([]ToolUseBlock, len(c.pendingTools))
+	copy(result, c.pendingTools)
+	return result
+}
+
+// pendingToolIndex must be called with c.mu held.
+func (c *Client) pendingToolIndex(toolUseID string) int {
+	for i, toolUse := range c.pendingTools {
+		if toolUse.ID == toolUseID {
+			return i
+		}
+	}
+	return -1
 }
 
 func (c *Client) SendInterrupt(ctx context.Context) error {
+	return c.InterruptWithReason(ctx, "")
+}
+
+// InterruptWithReason interrupts the current turn like SendInterrupt,
+// passing reason to the CLI in the control request. An empty reason sends
+// a bare interrupt.
+func (c *Client) InterruptWithReason(ctx context.Context, reason string) error {
 	c.mu.Lock()
 	if c.closed {
 		c.mu.Unlock()
@@ -95,7 +705,29 @@ func (c *Client) SendInterrupt(ctx context.Context) error {
 	}
 	c.mu.Unlock()
 
-	return c.transport.sendInterrupt(ctx)
+	err := c.transport.sendInterrupt(ctx, reason)
+	var timeoutErr *InterruptTimeoutError
+	if err != nil && !(errors.As(err, &timeoutErr) && timeoutErr.Observed) {
+		return err
+	}
+
+	// A late acknowledgment still means the turn was interrupted
+	c.mu.Lock()
+	c.interrupted = true
+	c.mu.Unlock()
+	return err
+}
+
+// interruptedResult stands in for the result of a turn that was interrupted
+// before the CLI produced one.
+func (c *Client) interruptedResult() *ResultMessage {
+	return &ResultMessage{
+		Role: MessageRoleSystem,
+		Data: ResultMessageData{
+			SessionID:          c.options.SessionID,
+			InterruptRequested: true,
+		},
+	}
 }
 
 func (c *Client) Messages() <-chan Message {
@@ -124,13 +756,82 @@ func (c *Client) Errors() <-chan error {
 	return c.transport.errors
 }
 
+// CostWarnings returns a channel of spend threshold warnings reported by the
+// CLI. The warnings also appear as SystemMessages in the message stream.
+// Warnings are dropped if the channel's buffer is full.
+func (c *Client) CostWarnings() <-chan CostWarning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.transport == nil {
+		// Return a closed channel if not connected
+		ch := make(chan CostWarning)
+		close(ch)
+		return ch
+	}
+	return c.transport.costWarnings
+}
+
+// StderrLines returns CLI stderr line by line, without trailing newlines,
+// when ClaudeCodeOptions.StderrLines is set. Lines are dropped if the
+// channel's buffer is full.
+func (c *Client) StderrLines() <-chan string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.transport == nil {
+		// Return a closed channel if not connected
+		ch := make(chan string)
+		close(ch)
+		return ch
+	}
+	return c.transport.stderrLines
+}
+
+// Logs returns CLI stderr parsed into LogLines when
+// ClaudeCodeOptions.StderrLogFormat is set. Lines are dropped if the
+// channel's buffer is full.
+func (c *Client) Logs() <-chan LogLine {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.transport == nil {
+		// Return a closed channel if not connected
+		ch := make(chan LogLine)
+		close(ch)
+		return ch
+	}
+	return c.transport.logs
+}
+
+// Subscribe registers an independent consumer of the message stream. Each
+// subscriber receives every message parsed from the CLI, regardless of who
+// else is reading, and buffer controls how far it may lag behind before
+// delivery waits on it. Call the returned function to unsubscribe; it stops
+// delivery immediately without affecting other subscribers.
+func (c *Client) Subscribe(buffer int) (<-chan Message, func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.transport == nil {
+		// Return a closed channel if not connected
+		ch := make(chan Message)
+		close(ch)
+		return ch, func() {}
+	}
+	return c.transport.subscribe(buffer)
+}
+
 func (c *Client) GetMessages() []Message {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	
-	result := make([]Message, len(c.messages))
-	copy(result, c.messages)
-	return result
+
+	var result []Message
+	if c.history != nil {
+		// Unreadable spilled messages leave only the in-memory tail
+		result, _ = c.history.all()
+	}
+	return append(result, c.messages...)
 }
 
 func (c *Client) StreamMessages(ctx context.Context) <-chan Message {
@@ -157,9 +858,7 @@ func (c *Client) StreamMessages(ctx context.Context) <-chan Message {
 					return
 				}
 				
-				c.mu.Lock()
-				c.messages = append(c.messages, msg)
-				c.mu.Unlock()
+				c.record(msg)
 				
 				select {
 				case out <- msg:
@@ -183,6 +882,9 @@ func (c *Client) WaitForResult(ctx context.Context) (*ResultMessage, error) {
 	errChan := c.transport.errors
 	c.mu.Unlock()
 	
+	// sawInterrupt is set once the CLI reports the turn interrupted
+	sawInterrupt := false
+	var limitErr error
 	for {
 		select {
 		case <-ctx.Done():
@@ -191,71 +893,285 @@ func (c *Client) WaitForResult(ctx context.Context) (*ResultMessage, error) {
 			return nil, err
 		case msg, ok := <-msgChan:
 			if !ok {
+				c.mu.Lock()
+				interrupted := c.interrupted
+				c.mu.Unlock()
+				if limitErr != nil {
+					return nil, limitErr
+				}
+				if interrupted || sawInterrupt {
+					return c.finishResult(c.interruptedResult())
+				}
 				return nil, fmt.Errorf("message channel closed")
 			}
 			
-			c.mu.Lock()
-			c.messages = append(c.messages, msg)
-			c.mu.Unlock()
+			c.record(msg)
+			
+			// The CLI was interrupted at the limit; its result still ends
+			// the turn
+			if err := backgroundTokenLimitError(msg); err != nil {
+				limitErr = err
+				continue
+			}
+			
+			// The CLI still reports the interrupted turn's own result, which
+			// would otherwise be taken for the next turn's
+			if system, ok := msg.(SystemMessage); ok && system.Subtype == SystemMessageSubtypeInterrupted {
+				sawInterrupt = true
+				continue
+			}
 			
 			if result, ok := msg.(ResultMessage); ok {
-				return &result, nil
+				if limitErr != nil {
+					return nil, limitErr
+				}
+				if sawInterrupt {
+					result.Data.InterruptRequested = true
+				} else {
+					continued, err := c.maybeContinue(ctx, result)
+					if err != nil {
+						return nil, err
+					}
+					if continued {
+						continue
+					}
+				}
+				return c.finishResult(&result)
 			}
 		}
 	}
 }
 
+// finishResult applies TreatInterruptAsError to a result about to be
+// returned from WaitForResult.
+func (c *Client) finishResult(result *ResultMessage) (*ResultMessage, error) {
+	if c.options.TreatInterruptAsError && result.Data.InterruptRequested {
+		return nil, NewInterruptedError(result)
+	}
+	return result, nil
+}
+
+// maybeContinue asks the CLI to carry on when result was cut off by
+// max_tokens and AutoContinueOnTruncation allows another continuation.
+func (c *Client) maybeContinue(ctx context.Context, result ResultMessage) (bool, error) {
+	if !c.options.AutoContinueOnTruncation || result.Data.StopReason != StopReasonMaxTokens {
+		return false, nil
+	}
+
+	maxContinuations := c.options.MaxContinuations
+	if maxContinuations <= 0 {
+		maxContinuations = defaultMaxContinuations
+	}
+
+	c.mu.Lock()
+	if c.closing || c.continuations >= maxContinuations {
+		c.mu.Unlock()
+		return false, nil
+	}
+	c.continuations++
+	c.continuing = true
+	c.mu.Unlock()
+
+	msg := UserMessage{
+		Role:    MessageRoleUser,
+		Content: continuePrompt,
+	}
+	if err := c.transport.sendMessage(ctx, msg, "", c.options.SessionID); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // ReceiveResponse receives messages until a ResultMessage is encountered.
 // Returns a channel that yields all messages including the ResultMessage.
-// The channel is closed after the ResultMessage is sent.
+// The channel is closed after the ResultMessage is sent, or with
+// IncludeTrailingMessages once the system messages following it have been
+// sent. Otherwise those trailing messages are recorded in the history but
+// left out of the next response.
 func (c *Client) ReceiveResponse(ctx context.Context) <-chan Message {
 	out := make(chan Message)
-	
+	go func() {
+		defer close(out)
+		c.receiveResponse(ctx, out, nil)
+	}()
+	return out
+}
+
+// ReceiveResponseWithErrors is ReceiveResponse that also reports why a
+// response ended without a result: a read or parse error, or the CLI
+// exiting, e.g. a *ProcessError with its exit code and stderr. The error
+// channel yields at most one error and is closed with the message channel.
+func (c *Client) ReceiveResponseWithErrors(ctx context.Context) (<-chan Message, <-chan error) {
+	out := make(chan Message)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(out)
+		c.receiveResponse(ctx, out, errs)
+	}()
+	return out, errs
+}
+
+// receiveResponse delivers the current response to out until its result,
+// reporting to errs, if not nil, an error that ends it early.
+func (c *Client) receiveResponse(ctx context.Context, out chan<- Message, errs chan<- error) {
 	c.mu.Lock()
 	if !c.connected || c.transport == nil {
 		c.mu.Unlock()
-		close(out)
-		return out
+		return
 	}
-	msgChan := c.transport.messages
-	errChan := c.transport.errors
+	t := c.transport
+	msgChan := t.messages
+	errChan := t.errors
 	c.mu.Unlock()
-	
-	go func() {
-		defer close(out)
-		
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-errChan:
-				// Could consider sending error as a special message type
-				// For now, just close the channel on error
+
+	report := func(err error) {
+		if errs != nil && err != nil {
+			errs <- err
+		}
+	}
+
+	deliver := func(msg Message) (done bool) {
+		// Trailing messages of the previous turn aren't part of this response
+		if c.record(msg) {
+			return false
+		}
+
+		// A truncated turn that is continued hasn't ended the response
+		if result, isResult := msg.(ResultMessage); isResult {
+			continued, err := c.maybeContinue(ctx, result)
+			if err != nil {
+				report(err)
+				return true
+			}
+			if continued {
+				return false
+			}
+		}
+
+		select {
+		case out <- msg:
+		case <-ctx.Done():
+			return true
+		}
+
+		if _, isResult := msg.(ResultMessage); isResult {
+			if c.options.EmitTurnSummary && !c.deliverSummary(ctx, msgChan, out) {
+				return true
+			}
+			if c.options.IncludeTrailingMessages {
+				c.deliverTrailing(ctx, msgChan, out)
+			}
+			return true
+		}
+		return false
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errChan:
+			report(err)
+			return
+		case msg, ok := <-msgChan:
+			if !ok || deliver(msg) {
 				return
-			case msg, ok := <-msgChan:
-				if !ok {
-					return
-				}
-				
-				c.mu.Lock()
-				c.messages = append(c.messages, msg)
-				c.mu.Unlock()
-				
+			}
+		case <-t.stdoutDone:
+			// The CLI's output ended without a result; deliver what it
+			// wrote before that, then say why
+			for {
 				select {
-				case out <- msg:
-				case <-ctx.Done():
-					return
-				}
-				
-				// Check if this is a ResultMessage
-				if _, isResult := msg.(ResultMessage); isResult {
+				case msg, ok := <-msgChan:
+					if !ok || deliver(msg) {
+						return
+					}
+				default:
+					if errs != nil {
+						report(c.outputEndedError(t))
+					}
 					return
 				}
 			}
 		}
-	}()
-	
-	return out
+	}
+}
+
+// outputEndedError explains a CLI whose output ended before a result: a
+// pending read error, or how the process exited. It returns nil when the
+// client is closing, which ends the output on purpose.
+func (c *Client) outputEndedError(t *transport) error {
+	c.mu.Lock()
+	closing := c.closing
+	c.mu.Unlock()
+	if closing {
+		return nil
+	}
+
+	select {
+	case err := <-t.errors:
+		return err
+	default:
+	}
+
+	if err := t.wait(); err != nil {
+		return err
+	}
+	return NewCLIConnectionError("Claude Code CLI output ended before a result", nil)
+}
+
+// deliverSummary forwards the TurnSummaryMessage the read loop sends right
+// after a result. It reports false if ctx ended or the stream closed first.
+func (c *Client) deliverSummary(ctx context.Context, msgChan <-chan Message, out chan<- Message) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case msg, ok := <-msgChan:
+			if !ok {
+				return false
+			}
+			c.record(msg)
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return false
+			}
+			if _, ok := msg.(TurnSummaryMessage); ok {
+				return true
+			}
+		}
+	}
+}
+
+// deliverTrailing forwards the system messages the CLI writes after a
+// result, until none has arrived for trailingMessageGrace.
+func (c *Client) deliverTrailing(ctx context.Context, msgChan <-chan Message, out chan<- Message) {
+	for {
+		timer := c.options.clock().NewTimer(trailingMessageGrace)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+			return
+		case msg, ok := <-msgChan:
+			timer.Stop()
+			if !ok {
+				return
+			}
+			trailing := c.record(msg)
+			select {
+			case out <- msg:
+			case <-ctx.Done():
+				return
+			}
+			if !trailing {
+				return
+			}
+		}
+	}
 }
 
 // ReceiveMessages receives all messages from the transport.
@@ -264,21 +1180,144 @@ func (c *Client) ReceiveMessages(ctx context.Context) <-chan Message {
 	return c.StreamMessages(ctx)
 }
 
+// Close closes the client without a specific reason; see CloseWithReason.
 func (c *Client) Close() error {
+	return c.CloseWithReason(CloseReasonUnspecified)
+}
+
+// CloseWithReason closes the client, recording why in the session report
+// passed to OnClose. Only the first close of a client takes effect.
+func (c *Client) CloseWithReason(reason CloseReason) error {
 	c.mu.Lock()
 	if c.closed {
 		c.mu.Unlock()
 		return nil
 	}
 	c.closed = true
+	closedAt := c.options.clock().Now()
+	c.closedAt = closedAt
+	c.closeReason = reason
 	transport := c.transport
 	c.connected = false
+	c.releaseSession()
+	c.historyCond.Broadcast()
+	c.turnSpan.end(fmt.Errorf("client closed before the turn finished"))
+	c.turnSpan = nil
 	c.mu.Unlock()
 
+	var err error
 	if transport != nil {
-		return transport.close()
+		err = transport.close()
+		c.mu.Lock()
+		c.shutdownDuration = c.options.clock().Now().Sub(closedAt)
+		c.mu.Unlock()
 	}
-	return nil
+	if c.options.OnClose != nil {
+		c.options.OnClose(c.SessionReport())
+	}
+	return err
+}
+
+// CloseAfterResult finishes the turn in progress and then closes the
+// client. New sends are rejected immediately, while messages keep being
+// delivered until the next ResultMessage, which is returned. If ctx ends
+// first the client is closed anyway and ctx's error returned.
+func (c *Client) CloseAfterResult(ctx context.Context) (*ResultMessage, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("client is closed")
+	}
+	if !c.connected {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("client is not connected, call Connect() first")
+	}
+	c.closing = true
+	c.mu.Unlock()
+
+	result, err := c.WaitForResult(ctx)
+	closeErr := c.Close()
+	if err != nil {
+		return nil, err
+	}
+	return result, closeErr
+}
+
+// Finish tells the CLI no more input is coming by closing its stdin, then
+// waits for the result of the turn in progress and returns it. The client
+// rejects new sends afterwards; the CLI exits on its own once it has
+// flushed the result, and Close still needs to be called. Call Finish
+// after the last send, in place of waiting for its result.
+func (c *Client) Finish(ctx context.Context) (*ResultMessage, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("client is closed")
+	}
+	if !c.connected || c.transport == nil {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("client is not connected, call Connect() first")
+	}
+	c.closing = true
+	transport := c.transport
+	c.mu.Unlock()
+
+	if err := transport.closeStdin(); err != nil {
+		return nil, NewCLIConnectionError("Failed to close stdin", err)
+	}
+	return c.WaitForResult(ctx)
+}
+
+// releaseSession gives up the client's claim on its SessionID. It must be
+// called with c.mu held.
+func (c *Client) releaseSession() {
+	if c.sessionClaimed {
+		releaseSession(c.options.SessionID, c)
+		c.sessionClaimed = false
+	}
+}
+
+// HistoryCursor walks the client's message history while it is still
+// growing. It is not safe for concurrent use, but any number of cursors may
+// read alongside the goroutine consuming the stream.
+type HistoryCursor struct {
+	client *Client
+	pos    int
+
+	// Blocking makes Next wait for the next message when the cursor has
+	// caught up, instead of returning false. A blocked Next returns false
+	// once the client is closed.
+	Blocking bool
+}
+
+// HistoryCursor returns a non-blocking cursor positioned at the start of
+// the history. Messages enter the history as they are consumed through
+// StreamMessages, WaitForResult, ReceiveResponse or an iterator.
+func (c *Client) HistoryCursor() *HistoryCursor {
+	return &HistoryCursor{client: c}
+}
+
+// Next returns the next message in the history, or false if there is none
+// yet (or, for a blocking cursor, once the client is closed and the
+// history is exhausted).
+func (h *HistoryCursor) Next() (Message, bool) {
+	c := h.client
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for h.pos >= c.historyLen() {
+		if !h.Blocking || c.closed {
+			return nil, false
+		}
+		c.historyCond.Wait()
+	}
+
+	msg, err := c.historyAt(h.pos)
+	if err != nil {
+		return nil, false
+	}
+	h.pos++
+	return msg, true
 }
 
 type MessageIterator struct {
@@ -304,9 +1343,7 @@ func (it *MessageIterator) Next() (Message, error) {
 			return nil, fmt.Errorf("message channel closed")
 		}
 		
-		it.client.mu.Lock()
-		it.client.messages = append(it.client.messages, msg)
-		it.client.mu.Unlock()
+		it.client.record(msg)
 		
 		return msg, nil
 	}
@@ -2,8 +2,15 @@ package pkg
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -43,6 +50,24 @@ echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"us
 	})
 }
 
+// setupScriptMockCLI installs the given shell script as the mock CLI
+func setupScriptMockCLI(t *testing.T, script string) string {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"claude", "claude-code"} {
+		mockPath := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(mockPath, []byte(script), 0755); err != nil {
+			t.Fatalf("Failed to create mock CLI at %s: %v", mockPath, err)
+		}
+	}
+
+	oldPath := os.Getenv("PATH")
+	os.Setenv("PATH", tmpDir+":"+oldPath)
+	t.Cleanup(func() {
+		os.Setenv("PATH", oldPath)
+	})
+	return tmpDir
+}
+
 func TestNewClient(t *testing.T) {
 	setupMockCLI(t)
 	
@@ -456,4 +481,1597 @@ func TestClient_ReceiveResponse(t *testing.T) {
 	if !gotResult {
 		t.Error("ReceiveResponse() should include ResultMessage")
 	}
-}
\ No newline at end of file
+}
+func TestClient_SubscribeUnsubscribe(t *testing.T) {
+	const total = 50
+
+	setupScriptMockCLI(t, `#!/bin/sh
+read line
+i=0
+while [ $i -lt 50 ]; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"chunk"}]}}'
+    i=$((i+1))
+done
+while IFS= read -r line; do :; done
+`)
+
+	ctx := context.Background()
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	// Keep the main channel drained so it never backs up the read loop
+	go func() {
+		for range client.Messages() {
+		}
+	}()
+
+	const subscribers = 4
+	counts := make([]int, subscribers)
+	var wg sync.WaitGroup
+
+	for i := 0; i < subscribers; i++ {
+		ch, unsubscribe := client.Subscribe(1)
+		wg.Add(1)
+		go func(i int, ch <-chan Message, unsubscribe func()) {
+			defer wg.Done()
+			timeout := time.After(5 * time.Second)
+			for counts[i] < total {
+				select {
+				case _, ok := <-ch:
+					if !ok {
+						return
+					}
+					counts[i]++
+					// The first subscriber leaves mid-stream
+					if i == 0 && counts[i] == 10 {
+						unsubscribe()
+						unsubscribe() // must be safe to repeat
+					}
+				case <-timeout:
+					return
+				}
+			}
+		}(i, ch, unsubscribe)
+	}
+
+	if err := client.SendMessage(ctx, "start"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	wg.Wait()
+
+	if counts[0] < 10 || counts[0] > 10+1 {
+		t.Errorf("Unsubscribed subscriber received %d messages, want about 10", counts[0])
+	}
+	for i := 1; i < subscribers; i++ {
+		if counts[i] != total {
+			t.Errorf("Subscriber %d received %d messages, want %d", i, counts[i], total)
+		}
+	}
+}
+
+func TestClient_SendMessageWithParams(t *testing.T) {
+	setupMockCLI(t)
+
+	ctx := context.Background()
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	t.Run("unsupported override", func(t *testing.T) {
+		temperature := 0.2
+		err := client.SendMessageWithParams(ctx, "Be precise", SamplingParams{Temperature: &temperature})
+
+		var unsupported *UnsupportedError
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("SendMessageWithParams() error = %v, want *UnsupportedError", err)
+		}
+		if unsupported.Feature == "" {
+			t.Error("UnsupportedError.Feature is empty")
+		}
+	})
+
+	t.Run("no overrides", func(t *testing.T) {
+		if err := client.SendMessageWithParams(ctx, "Hello", SamplingParams{}); err != nil {
+			t.Fatalf("SendMessageWithParams() error = %v", err)
+		}
+
+		// Only the plain message should have reached the CLI
+		select {
+		case msg := <-client.Messages():
+			assistant, ok := msg.(*AssistantMessage)
+			if !ok {
+				t.Fatalf("Expected assistant message, got %T", msg)
+			}
+			if text := assistant.Content[0].(TextBlock).Text; text != "Reply to: Hello" {
+				t.Errorf("Reply = %q, want %q", text, "Reply to: Hello")
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("Timeout waiting for message")
+		}
+	})
+}
+
+func TestClient_SendToolResult(t *testing.T) {
+	setupMockCLI(t)
+
+	ctx := context.Background()
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	client.record(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "toolu_1", Name: "lookup"},
+		ToolUseBlock{Type: "tool_use", ID: "toolu_2", Name: "Bash"},
+		ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_2", Content: "ran by the CLI"},
+	}})
+
+	t.Run("unknown tool_use_id", func(t *testing.T) {
+		err := client.SendToolResult(ctx, "toolu_missing", "result", false)
+		if err == nil || !strings.Contains(err.Error(), "unknown tool_use_id") {
+			t.Errorf("SendToolResult() error = %v, want unknown tool_use_id", err)
+		}
+	})
+
+	t.Run("answered in stream", func(t *testing.T) {
+		err := client.SendToolResult(ctx, "toolu_2", "result", false)
+		if err == nil || !strings.Contains(err.Error(), "already been answered") {
+			t.Errorf("SendToolResult() error = %v, want already answered", err)
+		}
+	})
+
+	t.Run("outstanding then duplicate", func(t *testing.T) {
+		if err := client.SendToolResult(ctx, "toolu_1", "42", false); err != nil {
+			t.Fatalf("SendToolResult() error = %v", err)
+		}
+
+		err := client.SendToolResult(ctx, "toolu_1", "42", false)
+		if err == nil || !strings.Contains(err.Error(), "already been answered") {
+			t.Errorf("Duplicate SendToolResult() error = %v, want already answered", err)
+		}
+	})
+}
+
+func TestClient_SendMessageWithBlocks(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"content":\[{"type":"text","text":"Here is the lookup result"},{"type":"tool_result","tool_use_id":"toolu_1","content":"42"}\]'; then
+        text="got text and tool result"
+    else
+        text="unexpected input"
+    fi
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"'"$text"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+	client.record(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "toolu_1", Name: "lookup"},
+	}})
+
+	if err := client.SendMessageWithBlocks(ctx, nil); err == nil {
+		t.Error("SendMessageWithBlocks() with no blocks error = nil, want error")
+	}
+
+	err := client.SendMessageWithBlocks(ctx, []ContentBlock{
+		TextBlock{Type: "text", Text: "Here is the lookup result"},
+		ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_1", Content: "42"},
+	})
+	if err != nil {
+		t.Fatalf("SendMessageWithBlocks() error = %v", err)
+	}
+	if _, err := client.WaitForResult(ctx); err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+	if got := client.LastAssistantText(); got != "got text and tool result" {
+		t.Errorf("LastAssistantText() = %q, want the CLI to receive the text and tool_result blocks", got)
+	}
+
+	err = client.SendToolResult(ctx, "toolu_1", "42", false)
+	if err == nil || !strings.Contains(err.Error(), "already been answered") {
+		t.Errorf("SendToolResult() after SendMessageWithBlocks() error = %v, want already answered", err)
+	}
+}
+
+func TestClient_AutoContinueOnTruncation(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"content":"continue"'; then
+        echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":" and then it finished."}]}}'
+        echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":5,"outputTokens":5},"cost":{"totalCost":0.001},"sessionId":"trunc","stopReason":"end_turn"}}}'
+    else
+        echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"The story started"}]}}'
+        echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":5,"outputTokens":10},"cost":{"totalCost":0.002},"sessionId":"trunc","stopReason":"max_tokens"}}}'
+    fi
+done
+`)
+
+	tests := []struct {
+		name           string
+		options        *ClaudeCodeOptions
+		receive        bool
+		wantStopReason string
+		wantText       string
+	}{
+		{
+			name:           "continues past truncation",
+			options:        &ClaudeCodeOptions{AutoContinueOnTruncation: true},
+			wantStopReason: StopReasonEndTurn,
+			wantText:       "The story started and then it finished.",
+		},
+		{
+			name:           "continues in ReceiveResponse",
+			options:        &ClaudeCodeOptions{AutoContinueOnTruncation: true},
+			receive:        true,
+			wantStopReason: StopReasonEndTurn,
+			wantText:       "The story started and then it finished.",
+		},
+		{
+			name:           "disabled by default",
+			options:        nil,
+			wantStopReason: StopReasonMaxTokens,
+			wantText:       "The story started",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			client := NewClient(tt.options)
+			if err := client.Connect(ctx, ""); err != nil {
+				t.Fatalf("Failed to connect client: %v", err)
+			}
+			defer client.Close()
+
+			if err := client.SendMessage(ctx, "Tell me a story"); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+
+			var result *ResultMessage
+			if tt.receive {
+				results := 0
+				for msg := range client.ReceiveResponse(ctx) {
+					if r, ok := msg.(ResultMessage); ok {
+						results++
+						result = &r
+					}
+				}
+				if results != 1 {
+					t.Fatalf("ReceiveResponse() delivered %d results, want only the final one", results)
+				}
+			} else {
+				var err error
+				result, err = client.WaitForResult(ctx)
+				if err != nil {
+					t.Fatalf("WaitForResult() error = %v", err)
+				}
+			}
+			if result.Data.StopReason != tt.wantStopReason {
+				t.Errorf("StopReason = %q, want %q", result.Data.StopReason, tt.wantStopReason)
+			}
+			if got := client.ResponseText(); got != tt.wantText {
+				t.Errorf("ResponseText() = %q, want %q", got, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestClient_InterruptPreservesPartialText(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Partial answ"}]}}'
+read -r line
+id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true}}'
+echo '{"type":"system","message":{"role":"system","subtype":"interrupted"}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	sub, unsubscribe := client.Subscribe(10)
+	defer unsubscribe()
+
+	if err := client.SendMessage(ctx, "Write an essay"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+
+	select {
+	case <-sub:
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for partial assistant message")
+	}
+
+	if err := client.SendInterrupt(ctx); err != nil {
+		t.Fatalf("SendInterrupt() error = %v", err)
+	}
+
+	result, err := client.WaitForResult(ctx)
+	if err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+	if !result.Data.InterruptRequested {
+		t.Error("WaitForResult() InterruptRequested = false, want true")
+	}
+
+	if got := client.LastAssistantText(); got != "Partial answ" {
+		t.Errorf("LastAssistantText() = %q, want %q", got, "Partial answ")
+	}
+
+	var found bool
+	for _, msg := range client.GetMessages() {
+		if _, ok := msg.(*AssistantMessage); ok {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("GetMessages() missing the partial assistant message")
+	}
+}
+
+func TestClient_WaitForResultConsumesInterruptedResult(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+read -r line
+id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true}}'
+echo '{"type":"system","message":{"role":"system","subtype":"interrupted"}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1","stopReason":"tool_use"}}}'
+read -r line
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1","stopReason":"end_turn"}}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(ctx, "Write an essay"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if err := client.SendInterrupt(ctx); err != nil {
+		t.Fatalf("SendInterrupt() error = %v", err)
+	}
+
+	result, err := client.WaitForResult(ctx)
+	if err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+	if !result.Data.InterruptRequested || result.Data.StopReason != "tool_use" {
+		t.Errorf("interrupted WaitForResult() = %+v, want the CLI's result marked interrupted", result.Data)
+	}
+
+	if err := client.SendMessage(ctx, "Try again"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	result, err = client.WaitForResult(ctx)
+	if err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+	if result.Data.InterruptRequested || result.Data.StopReason != "end_turn" {
+		t.Errorf("next WaitForResult() = %+v, want the next turn's result", result.Data)
+	}
+}
+
+func TestClient_CostWarnings(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+echo '{"type":"system","message":{"role":"system","subtype":"cost_warning","data":{"threshold":5,"currentCost":4.5,"message":"Approaching $5.00 spend limit"}}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1,"backgroundTokens":0},"cost":{"totalCost":4.5},"sessionId":"cost-session","interruptRequested":false}}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, "Hello"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	var warning CostWarning
+	select {
+	case warning = <-client.CostWarnings():
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for cost warning")
+	}
+
+	if warning.Threshold != 5 || warning.CurrentCost != 4.5 {
+		t.Errorf("CostWarning = %+v, want threshold 5 and current cost 4.5", warning)
+	}
+	if warning.Message != "Approaching $5.00 spend limit" {
+		t.Errorf("CostWarning.Message = %q", warning.Message)
+	}
+
+	// The warning is non-fatal, so the turn still completes
+	if _, err := client.WaitForResult(ctx); err != nil {
+		t.Errorf("WaitForResult() error = %v", err)
+	}
+}
+
+func TestClient_PendingToolCalls(t *testing.T) {
+	setupMockCLI(t)
+
+	ctx := context.Background()
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Failed to connect client: %v", err)
+	}
+	defer client.Close()
+
+	if pending := client.PendingToolCalls(); len(pending) != 0 {
+		t.Errorf("PendingToolCalls() = %v, want none", pending)
+	}
+
+	client.record(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "toolu_1", Name: "lookup"},
+		ToolUseBlock{Type: "tool_use", ID: "toolu_2", Name: "fetch"},
+		ToolUseBlock{Type: "tool_use", ID: "toolu_3", Name: "Bash"},
+		ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_3", Content: "ran by the CLI"},
+	}})
+
+	pendingIDs := func() []string {
+		var ids []string
+		for _, toolUse := range client.PendingToolCalls() {
+			ids = append(ids, toolUse.ID)
+		}
+		return ids
+	}
+
+	if got := pendingIDs(); strings.Join(got, ",") != "toolu_1,toolu_2" {
+		t.Errorf("PendingToolCalls() IDs = %v, want [toolu_1 toolu_2]", got)
+	}
+
+	if err := client.SendToolResult(ctx, "toolu_1", "42", false); err != nil {
+		t.Fatalf("SendToolResult() error = %v", err)
+	}
+	if got := pendingIDs(); strings.Join(got, ",") != "toolu_2" {
+		t.Errorf("PendingToolCalls() IDs after answer = %v, want [toolu_2]", got)
+	}
+
+	// The returned slice is a copy
+	pending := client.PendingToolCalls()
+	pending[0].ID = "changed"
+	if got := pendingIDs(); got[0] != "toolu_2" {
+		t.Errorf("PendingToolCalls() exposed internal state: %v", got)
+	}
+
+	// The CLI echoes results of tools it ran as user messages
+	client.record(UserMessage{Role: MessageRoleUser, Blocks: []ContentBlock{
+		ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_2", Content: "fetched"},
+	}})
+	if got := pendingIDs(); len(got) != 0 {
+		t.Errorf("PendingToolCalls() IDs after user tool_result = %v, want none", got)
+	}
+}
+
+func TestClient_CloseAfterResult(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    sleep 0.2
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Finished answer"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":2},"cost":{"totalCost":0.001},"sessionId":"close-session"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if err := client.SendMessage(ctx, "Hello"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+
+	result, err := client.CloseAfterResult(ctx)
+	if err != nil {
+		t.Fatalf("CloseAfterResult() error = %v", err)
+	}
+	if result == nil || result.Data.SessionID != "close-session" {
+		t.Fatalf("CloseAfterResult() = %+v, want the in-progress result", result)
+	}
+	if got := client.LastAssistantText(); got != "Finished answer" {
+		t.Errorf("LastAssistantText() = %q, want %q", got, "Finished answer")
+	}
+
+	if err := client.SendMessage(ctx, "Too late"); err == nil {
+		t.Error("SendMessage() after CloseAfterResult() error = nil, want error")
+	}
+}
+
+func TestClient_Finish(t *testing.T) {
+	// Answers only once stdin is closed, with the number of messages read
+	setupScriptMockCLI(t, `#!/bin/sh
+n=0
+while IFS= read -r line; do n=$((n+1)); done
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"read '"$n"' messages"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":2},"cost":{"totalCost":0.001},"sessionId":"finish-session"}}}'
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, "First"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+	if err := client.SendMessage(ctx, "Second"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+
+	result, err := client.Finish(ctx)
+	if err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	if result == nil || result.Data.SessionID != "finish-session" {
+		t.Fatalf("Finish() = %+v, want the final result", result)
+	}
+	if got := client.LastAssistantText(); got != "read 2 messages" {
+		t.Errorf("LastAssistantText() = %q, want %q", got, "read 2 messages")
+	}
+
+	if err := client.SendMessage(ctx, "Too late"); err == nil {
+		t.Error("SendMessage() after Finish() error = nil, want error")
+	}
+	if err := client.Close(); err != nil {
+		t.Errorf("Close() after Finish() error = %v", err)
+	}
+}
+
+func TestClient_CloseAfterResultRejectsSends(t *testing.T) {
+	setupMockCLI(t)
+
+	client := NewClient(nil)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.CloseAfterResult(ctx)
+		done <- err
+	}()
+
+	// Wait for CloseAfterResult to start draining
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		client.mu.Lock()
+		closing := client.closing
+		client.mu.Unlock()
+		if closing || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	err := client.SendMessage(context.Background(), "Hello")
+	if err == nil || !strings.Contains(err.Error(), "closing") {
+		t.Errorf("SendMessage() error = %v, want client is closing", err)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("CloseAfterResult() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestClient_MaxBackgroundTokens(t *testing.T) {
+	dir := setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"control_request"'; then
+        id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+        touch "$(dirname "$0")/interrupted"
+        echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true}}'
+        continue
+    fi
+    for used in 100 600 1200; do
+        echo '{"type":"system","message":{"role":"system","subtype":"usage","data":{"inputTokens":10,"outputTokens":10,"backgroundTokens":'$used'}}}'
+    done
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":10,"outputTokens":10,"backgroundTokens":1200},"cost":{"totalCost":0.01},"sessionId":"bg-session"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{MaxBackgroundTokens: 1000})
+	if err := client.Connect(ctx, "Index the repository"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	_, err := client.WaitForResult(ctx)
+	var limitErr *BackgroundTokenLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("WaitForResult() error = %v, want *BackgroundTokenLimitError", err)
+	}
+	if limitErr.Used != 1200 || limitErr.Limit != 1000 {
+		t.Errorf("BackgroundTokenLimitError = {Used %d, Limit %d}, want {1200, 1000}", limitErr.Used, limitErr.Limit)
+	}
+
+	// The turn is interrupted when the limit is crossed
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "interrupted")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("CLI was not interrupted after exceeding MaxBackgroundTokens")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_InterruptAckLost(t *testing.T) {
+	tests := []struct {
+		name         string
+		sendMessage  bool
+		wantObserved bool
+	}{
+		{name: "interrupt effective", sendMessage: true, wantObserved: true},
+		{name: "interrupt lost", sendMessage: false, wantObserved: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The mock never acknowledges control requests
+			script := `#!/bin/sh
+while IFS= read -r line; do :; done
+`
+			if tt.sendMessage {
+				script = `#!/bin/sh
+read -r line
+echo '{"type":"system","message":{"role":"system","subtype":"interrupted"}}'
+while IFS= read -r line; do :; done
+`
+			}
+			setupScriptMockCLI(t, script)
+
+			ctx := context.Background()
+			client := NewClient(&ClaudeCodeOptions{InterruptTimeout: 200 * time.Millisecond})
+			if err := client.Connect(ctx, ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+
+			err := client.SendInterrupt(ctx)
+			var timeoutErr *InterruptTimeoutError
+			if !errors.As(err, &timeoutErr) {
+				t.Fatalf("SendInterrupt() error = %v, want *InterruptTimeoutError", err)
+			}
+			if timeoutErr.Timeout != 200*time.Millisecond {
+				t.Errorf("InterruptTimeoutError.Timeout = %v, want 200ms", timeoutErr.Timeout)
+			}
+			if timeoutErr.Observed != tt.wantObserved {
+				t.Errorf("InterruptTimeoutError.Observed = %v, want %v", timeoutErr.Observed, tt.wantObserved)
+			}
+		})
+	}
+}
+
+func TestClient_TreatInterruptAsError(t *testing.T) {
+	for _, treatAsError := range []bool{false, true} {
+		t.Run(fmt.Sprintf("TreatInterruptAsError=%v", treatAsError), func(t *testing.T) {
+			setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"int-session","interruptRequested":true}}}'
+while IFS= read -r line; do :; done
+`)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := NewClient(&ClaudeCodeOptions{TreatInterruptAsError: treatAsError})
+			if err := client.Connect(ctx, "Hello"); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+
+			result, err := client.WaitForResult(ctx)
+			if treatAsError {
+				if !errors.Is(err, ErrInterrupted) || result != nil {
+					t.Errorf("WaitForResult() = %v, %v, want nil, InterruptedError", result, err)
+				}
+				return
+			}
+			if err != nil || !result.Data.InterruptRequested {
+				t.Errorf("WaitForResult() = %v, %v, want interrupted result", result, err)
+			}
+		})
+	}
+}
+
+func TestClient_ReceiveResponseTrailingMessages(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"final_usage","data":{"totalTokens":2}}}'
+done
+`)
+
+	receiveTurn := func(t *testing.T, ctx context.Context, client *Client) []Message {
+		t.Helper()
+		if err := client.SendMessage(ctx, "Hello"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+		var got []Message
+		for msg := range client.ReceiveResponse(ctx) {
+			got = append(got, msg)
+		}
+		return got
+	}
+
+	t.Run("recorded but not delivered", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		client := NewClient(nil)
+		if err := client.Connect(ctx, ""); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+		defer client.Close()
+
+		for turn := 1; turn <= 2; turn++ {
+			got := receiveTurn(t, ctx, client)
+			if len(got) != 2 {
+				t.Fatalf("turn %d ReceiveResponse() got %d messages, want 2: %v", turn, len(got), got)
+			}
+			if _, ok := got[0].(*AssistantMessage); !ok {
+				t.Errorf("turn %d first message = %T, want *AssistantMessage", turn, got[0])
+			}
+		}
+
+		trailing := 0
+		for _, msg := range client.GetMessages() {
+			if system, ok := msg.(SystemMessage); ok && system.Subtype == "final_usage" {
+				trailing++
+			}
+		}
+		// The second turn's trailing message may not have been read yet
+		if trailing < 1 {
+			t.Errorf("history has %d trailing messages, want at least 1", trailing)
+		}
+	})
+
+	t.Run("included", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		client := NewClient(&ClaudeCodeOptions{IncludeTrailingMessages: true})
+		if err := client.Connect(ctx, ""); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+		defer client.Close()
+
+		for turn := 1; turn <= 2; turn++ {
+			got := receiveTurn(t, ctx, client)
+			if len(got) != 3 {
+				t.Fatalf("turn %d ReceiveResponse() got %d messages, want 3: %v", turn, len(got), got)
+			}
+			if system, ok := got[2].(SystemMessage); !ok || system.Subtype != "final_usage" {
+				t.Errorf("turn %d last message = %v, want the final_usage system message", turn, got[2])
+			}
+		}
+	})
+}
+
+func TestClient_CoalesceAssistantMessages(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    for delta in "Hel" "lo, " "wor" "ld"; do
+        echo '{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"text","text":"'"$delta"'"}]}}'
+    done
+    echo '{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"tool-1","name":"Read","input":{}}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+done
+`)
+
+	tests := []struct {
+		name        string
+		coalesce    bool
+		wantHistory int
+	}{
+		{name: "coalesced", coalesce: true, wantHistory: 1},
+		{name: "not coalesced", coalesce: false, wantHistory: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := NewClient(&ClaudeCodeOptions{CoalesceAssistantMessages: tt.coalesce})
+			if err := client.Connect(ctx, "Hello"); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+
+			delivered := 0
+			for msg := range client.ReceiveResponse(ctx) {
+				if _, ok := msg.(*AssistantMessage); ok {
+					delivered++
+				}
+			}
+			if delivered != 5 {
+				t.Errorf("ReceiveResponse() delivered %d assistant messages, want 5", delivered)
+			}
+
+			var history []*AssistantMessage
+			for _, msg := range client.GetMessages() {
+				if assistant, ok := msg.(*AssistantMessage); ok {
+					history = append(history, assistant)
+				}
+			}
+			if len(history) != tt.wantHistory {
+				t.Fatalf("history has %d assistant messages, want %d", len(history), tt.wantHistory)
+			}
+			if !tt.coalesce {
+				return
+			}
+
+			content := history[0].Content
+			if len(content) != 2 {
+				t.Fatalf("coalesced message has %d blocks, want 2: %v", len(content), content)
+			}
+			if text, ok := content[0].(TextBlock); !ok || text.Text != "Hello, world" {
+				t.Errorf("coalesced text = %v, want Hello, world", content[0])
+			}
+			if tool, ok := content[1].(ToolUseBlock); !ok || tool.ID != "tool-1" {
+				t.Errorf("coalesced second block = %v, want tool_use tool-1", content[1])
+			}
+		})
+	}
+}
+
+func TestClient_DeltasNotInHistory(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+echo '{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}}'
+echo '{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}}'
+echo '{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"text","text":"Hello"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{IncludePartialMessages: true, CoalesceAssistantMessages: true})
+	if err := client.Connect(ctx, "Hello"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	delivered := 0
+	for msg := range client.ReceiveResponse(ctx) {
+		if _, ok := msg.(*AssistantMessage); ok {
+			delivered++
+		}
+	}
+	if delivered != 3 {
+		t.Errorf("ReceiveResponse() delivered %d assistant messages, want 3", delivered)
+	}
+
+	var history []*AssistantMessage
+	for _, msg := range client.GetMessages() {
+		if assistant, ok := msg.(*AssistantMessage); ok {
+			history = append(history, assistant)
+		}
+	}
+	if len(history) != 1 || history[0].isDelta() {
+		t.Errorf("history = %v, want only the complete assistant message", history)
+	}
+}
+func TestClient_InterruptWithReason(t *testing.T) {
+	// The mock acknowledges an interrupt only when it carries a reason,
+	// which it echoes back
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+    reason=$(echo "$line" | sed -n 's/.*"reason":"\([^"]*\)".*/\1/p')
+    if [ -n "$reason" ]; then
+        echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true,"reason":"'"$reason"'"}}'
+    else
+        echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":false,"error":"no reason given"}}'
+    fi
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.InterruptWithReason(ctx, "user pressed stop"); err != nil {
+		t.Errorf("InterruptWithReason() error = %v", err)
+	}
+
+	err := client.SendInterrupt(ctx)
+	if err == nil || !strings.Contains(err.Error(), "no reason given") {
+		t.Errorf("SendInterrupt() error = %v, want the bare interrupt to carry no reason", err)
+	}
+}
+
+func TestClient_WorkingDir(t *testing.T) {
+	// The CLI reports the resolved path, as on macOS where /tmp is a
+	// symlink to /private/tmp
+	setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+echo '{"type":"system","message":{"role":"system","subtype":"init","data":{"cwd":"/private/work","model":"claude-opus"}}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+cat > /dev/null
+`)
+
+	cwd := t.TempDir()
+	client := NewClient(&ClaudeCodeOptions{Cwd: cwd})
+	if got := client.WorkingDir(); got != cwd {
+		t.Errorf("WorkingDir() before connect = %q, want options.Cwd %q", got, cwd)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Connect(ctx, "Hello"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+	if _, err := client.WaitForResult(ctx); err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+
+	if got := client.WorkingDir(); got != "/private/work" {
+		t.Errorf("WorkingDir() = %q, want the cwd from the init message", got)
+	}
+}
+
+func TestClient_ReceiveResponseWithErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		wantResult bool
+		wantExit   int
+	}{
+		{
+			name: "result",
+			script: `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`,
+			wantResult: true,
+		},
+		{
+			name: "crash mid-response",
+			script: `#!/bin/sh
+read -r line
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+echo "fatal: out of memory" >&2
+exit 3
+`,
+			wantExit: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, tt.script)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := NewClient(nil)
+			if err := client.Connect(ctx, ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+			if err := client.SendMessage(ctx, "Hello"); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+
+			msgs, errs := client.ReceiveResponseWithErrors(ctx)
+			var got []Message
+			for msg := range msgs {
+				got = append(got, msg)
+			}
+			var gotErrs []error
+			for err := range errs {
+				gotErrs = append(gotErrs, err)
+			}
+			if ctx.Err() != nil {
+				t.Fatal("ReceiveResponseWithErrors() did not end before the context deadline")
+			}
+
+			if len(got) == 0 {
+				t.Fatal("ReceiveResponseWithErrors() delivered no messages")
+			}
+			if _, ok := got[0].(*AssistantMessage); !ok {
+				t.Errorf("first message = %T, want *AssistantMessage", got[0])
+			}
+			_, gotResult := got[len(got)-1].(ResultMessage)
+			if gotResult != tt.wantResult {
+				t.Errorf("ended with result = %v, want %v", gotResult, tt.wantResult)
+			}
+
+			if tt.wantResult {
+				if len(gotErrs) != 0 {
+					t.Errorf("errors = %v, want none", gotErrs)
+				}
+				return
+			}
+			if len(gotErrs) != 1 {
+				t.Fatalf("errors = %v, want exactly one", gotErrs)
+			}
+			var procErr *ProcessError
+			if !errors.As(gotErrs[0], &procErr) {
+				t.Fatalf("error = %v, want *ProcessError", gotErrs[0])
+			}
+			if procErr.ExitCode != tt.wantExit || !strings.Contains(procErr.Stderr, "out of memory") {
+				t.Errorf("ProcessError exit %d stderr %q, want exit %d with the CLI's stderr", procErr.ExitCode, procErr.Stderr, tt.wantExit)
+			}
+		})
+	}
+}
+
+func TestClient_TotalCostAndUsage(t *testing.T) {
+	// Turn n uses n*10 input tokens, n output tokens and costs n cents
+	setupScriptMockCLI(t, `#!/bin/sh
+n=0
+while IFS= read -r line; do
+    n=$((n + 1))
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"turn '"$n"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":'"$((n * 10))"',"outputTokens":'"$n"'},"cost":{"inputTokenCost":0.00'"$n"',"totalCost":0.0'"$n"'},"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	for _, prompt := range []string{"first", "second"} {
+		if err := client.SendMessage(ctx, prompt); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+		if _, err := client.WaitForResult(ctx); err != nil {
+			t.Fatalf("WaitForResult() error = %v", err)
+		}
+	}
+
+	wantUsage := ResultUsage{InputTokens: 30, OutputTokens: 3}
+	if got := client.TotalUsage(); got != wantUsage {
+		t.Errorf("TotalUsage() = %+v, want %+v", got, wantUsage)
+	}
+	got := client.TotalCost()
+	if math.Abs(got.TotalCost-0.03) > 1e-9 || math.Abs(got.InputTokenCost-0.003) > 1e-9 {
+		t.Errorf("TotalCost() = %+v, want TotalCost 0.03 and InputTokenCost 0.003", got)
+	}
+}
+
+func TestClient_OnMessage(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"draft"}]}}'
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"final answer"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var client *Client
+	var hooked []Message
+	historyLens := []int{}
+	client = NewClient(&ClaudeCodeOptions{
+		OnMessage: func(msg Message) {
+			hooked = append(hooked, msg)
+			// The hook may call back into the client
+			historyLens = append(historyLens, len(client.GetMessages()))
+		},
+	})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(ctx, "Hello"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if _, err := client.WaitForResult(ctx); err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+
+	history := client.GetMessages()
+	if len(hooked) != 3 || len(history) != 3 {
+		t.Fatalf("OnMessage called %d times for %d messages, want 3 each", len(hooked), len(history))
+	}
+	for i := range history {
+		if !reflect.DeepEqual(hooked[i], history[i]) {
+			t.Errorf("OnMessage call %d = %v, want history message %v", i, hooked[i], history[i])
+		}
+		if historyLens[i] != i+1 {
+			t.Errorf("history length seen by OnMessage call %d = %d, want %d", i, historyLens[i], i+1)
+		}
+	}
+}
+
+func TestQuery_OnMessage(t *testing.T) {
+	setupQueryMockCLI(t, "simple")
+
+	var hooked []Message
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{
+		OnMessage: func(msg Message) { hooked = append(hooked, msg) },
+	})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(hooked) == 0 || len(hooked) != len(result.Messages) {
+		t.Fatalf("OnMessage called %d times, want once per each of %d messages", len(hooked), len(result.Messages))
+	}
+	for i := range hooked {
+		if !reflect.DeepEqual(hooked[i], result.Messages[i]) {
+			t.Errorf("OnMessage call %d = %v, want %v", i, hooked[i], result.Messages[i])
+		}
+	}
+}
+
+func TestClient_MaxCostUSD(t *testing.T) {
+	// Each turn costs more than the last: 0.10, 0.20, 0.30
+	dir := setupScriptMockCLI(t, `#!/bin/sh
+n=0
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"control_request"'; then
+        id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+        echo "$line" > "$(dirname "$0")/interrupted"
+        echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true}}'
+        continue
+    fi
+    n=$((n + 1))
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"turn '"$n"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"cost":{"totalCost":0.'"$n"'0},"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{MaxCostUSD: 0.25})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	var notices []SystemMessage
+	for turn := 1; turn <= 3; turn++ {
+		if err := client.SendMessage(ctx, "Continue"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+		for msg := range client.ReceiveResponse(ctx) {
+			if system, ok := msg.(SystemMessage); ok && system.Subtype == SystemMessageSubtypeCostLimitExceeded {
+				if turn != 2 {
+					t.Errorf("cost_limit_exceeded in turn %d, want it in turn 2 where the total reaches 0.30", turn)
+				}
+				notices = append(notices, system)
+			}
+		}
+	}
+
+	if len(notices) != 1 {
+		t.Fatalf("got %d cost_limit_exceeded messages, want 1", len(notices))
+	}
+	var payload struct {
+		Data CostLimitExceeded `json:"data"`
+	}
+	if err := json.Unmarshal(notices[0].Raw, &payload); err != nil {
+		t.Fatalf("cost_limit_exceeded Raw = %s: %v", notices[0].Raw, err)
+	}
+	if payload.Data.MaxCostUSD != 0.25 || math.Abs(payload.Data.TotalCost-0.3) > 1e-9 {
+		t.Errorf("cost_limit_exceeded data = %+v, want limit 0.25 and total 0.30", payload.Data)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if data, err := os.ReadFile(filepath.Join(dir, "interrupted")); err == nil {
+			if !strings.Contains(string(data), "cost limit exceeded") {
+				t.Errorf("interrupt = %s, want reason cost limit exceeded", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("CLI was not interrupted after exceeding MaxCostUSD")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithClient(t *testing.T) {
+	setupScriptMockCLI(t, controlMockScript)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fnErr := errors.New("fn failed")
+	tests := []struct {
+		name      string
+		fn        func(*Client) error
+		wantErr   error
+		wantPanic bool
+	}{
+		{name: "success", fn: func(*Client) error { return nil }},
+		{name: "error", fn: func(*Client) error { return fnErr }, wantErr: fnErr},
+		{name: "panic", fn: func(*Client) error { panic("fn panicked") }, wantPanic: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *Client
+			var err error
+			panicked := func() (panicked bool) {
+				defer func() { panicked = recover() != nil }()
+				err = WithClient(ctx, nil, func(client *Client) error {
+					got = client
+					if err := CheckClientAlive(ctx, client); err != nil {
+						t.Errorf("WithClient() passed a client that is not alive: %v", err)
+					}
+					return tt.fn(client)
+				})
+				return false
+			}()
+
+			if panicked != tt.wantPanic {
+				t.Errorf("WithClient() panicked = %v, want %v", panicked, tt.wantPanic)
+			}
+			if !tt.wantPanic && !errors.Is(err, tt.wantErr) {
+				t.Errorf("WithClient() error = %v, want %v", err, tt.wantErr)
+			}
+			if got == nil {
+				t.Fatal("WithClient() did not call fn")
+			}
+			got.mu.Lock()
+			closed := got.closed
+			got.mu.Unlock()
+			if !closed {
+				t.Error("client not closed after WithClient() returned")
+			}
+		})
+	}
+}
+
+func TestClient_CloseShutdownGrace(t *testing.T) {
+	tests := []struct {
+		name    string
+		trap    string
+		grace   time.Duration
+		wantErr bool
+		killed  bool
+		// fakeClock runs the session on a FakeClock nobody advances
+		fakeClock bool
+	}{
+		{name: "exits on SIGTERM", trap: `trap 'touch "$dir/terminated"; exit 0' TERM`, grace: 5 * time.Second},
+		{name: "fails on SIGTERM", trap: `trap 'touch "$dir/terminated"; exit 3' TERM`, grace: 5 * time.Second, wantErr: true},
+		{name: "ignores SIGTERM", trap: `trap '' TERM`, grace: 200 * time.Millisecond, killed: true},
+		{name: "ignores SIGTERM under a fake clock", trap: `trap '' TERM`, grace: 200 * time.Millisecond, killed: true, fakeClock: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := setupScriptMockCLI(t, `#!/bin/sh
+dir=$(dirname "$0")
+`+tt.trap+`
+touch "$dir/ready"
+while :; do sleep 0.05; done
+`)
+
+			options := &ClaudeCodeOptions{ShutdownGrace: tt.grace}
+			if tt.fakeClock {
+				options.Clock = NewFakeClock(time.Unix(1700000000, 0))
+			}
+			client := NewClient(options)
+			if err := client.Connect(context.Background(), ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			for i := 0; i < 100; i++ {
+				if _, err := os.Stat(filepath.Join(dir, "ready")); err == nil {
+					break
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+
+			start := time.Now()
+			err := client.Close()
+			elapsed := time.Since(start)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Close() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.killed {
+				if elapsed < tt.grace {
+					t.Errorf("Close() returned after %v, want at least the %v grace", elapsed, tt.grace)
+				}
+				if elapsed > 10*tt.grace {
+					t.Errorf("Close() took %v, want the kill soon after the %v grace", elapsed, tt.grace)
+				}
+				return
+			}
+			if elapsed >= tt.grace {
+				t.Errorf("Close() took %v, want well under the %v grace", elapsed, tt.grace)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "terminated")); err != nil {
+				t.Errorf("mock CLI did not see SIGTERM: %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_CloseReturnsExitError(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"partial"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+echo 'fatal: out of tokens' >&2
+exit 1
+`)
+
+	client := NewClient(nil)
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+Loop:
+	for {
+		select {
+		case msg, ok := <-client.Messages():
+			if !ok {
+				break Loop
+			}
+			if _, ok := msg.(ResultMessage); ok {
+				break Loop
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for the result")
+		}
+	}
+
+	err := client.Close()
+	var procErr *ProcessError
+	if !errors.As(err, &procErr) {
+		t.Fatalf("Close() error = %v, want *ProcessError", err)
+	}
+	if procErr.ExitCode != 1 {
+		t.Errorf("ExitCode = %d, want 1", procErr.ExitCode)
+	}
+	if !strings.Contains(procErr.Stderr, "fatal: out of tokens") {
+		t.Errorf("Stderr = %q, want the CLI's stderr", procErr.Stderr)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Errorf("second Close() error = %v, want nil", err)
+	}
+	if err := client.transport.close(); err != procErr {
+		t.Errorf("transport.close() again = %v, want the cached %v", err, procErr)
+	}
+}
+
+func TestClient_OnSessionID(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"system","subtype":"init","session_id":"sess-42","model":"claude-test"}'
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"sess-42"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var ids []string
+	client := NewClient(&ClaudeCodeOptions{OnSessionID: func(id string) {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, id)
+	}})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := client.SendMessage(ctx, "Hello"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+		if _, err := client.WaitForResult(ctx); err != nil {
+			t.Fatalf("WaitForResult() error = %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(ids, []string{"sess-42"}) {
+		t.Errorf("OnSessionID calls = %v, want exactly one with sess-42", ids)
+	}
+	if got := client.SessionID(); got != "sess-42" {
+		t.Errorf("SessionID() = %q, want %q", got, "sess-42")
+	}
+}
+
+func TestQuery_OnSessionID(t *testing.T) {
+	setupQueryMockCLI(t, "simple")
+
+	var ids []string
+	_, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{
+		OnSessionID: func(id string) { ids = append(ids, id) },
+	})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"query-session"}) {
+		t.Errorf("OnSessionID calls = %v, want exactly one with query-session", ids)
+	}
+}
+
+func TestClient_TurnCount(t *testing.T) {
+	// Four assistant messages, two of them blocks of the same response
+	const script = `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"one"}]}}'
+    echo '{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"one, continued"}]}}'
+    echo '{"type":"assistant","message":{"id":"m2","role":"assistant","content":[{"type":"text","text":"two"}]}}'
+    echo '{"type":"assistant","message":{"id":"m3","role":"assistant","content":[{"type":"text","text":"three"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`
+
+	tests := []struct {
+		name       string
+		maxTurns   int
+		wantNotice bool
+	}{
+		{name: "limit reached", maxTurns: 3, wantNotice: true},
+		{name: "limit not reached", maxTurns: 4},
+		{name: "no limit", maxTurns: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, script)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			client := NewClient(&ClaudeCodeOptions{MaxTurns: tt.maxTurns})
+			if err := client.Connect(ctx, ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+			defer client.Close()
+
+			if err := client.SendMessage(ctx, "Count"); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+			var notices []SystemMessage
+			var previous Message
+			for msg := range client.ReceiveResponse(ctx) {
+				if system, ok := msg.(SystemMessage); ok && system.Subtype == SystemMessageSubtypeMaxTurnsReached {
+					if assistant, ok := previous.(*AssistantMessage); !ok || assistant.ID != "m3" {
+						t.Errorf("max_turns_reached after %v, want it right after the third turn", previous)
+					}
+					notices = append(notices, system)
+				}
+				previous = msg
+			}
+
+			if got := client.TurnCount(); got != 3 {
+				t.Errorf("TurnCount() = %d, want 3", got)
+			}
+			if !tt.wantNotice {
+				if len(notices) != 0 {
+					t.Errorf("got %d max_turns_reached messages, want none", len(notices))
+				}
+				return
+			}
+
+			if len(notices) != 1 {
+				t.Fatalf("got %d max_turns_reached messages, want 1", len(notices))
+			}
+			var payload struct {
+				Data MaxTurnsReached `json:"data"`
+			}
+			if err := json.Unmarshal(notices[0].Raw, &payload); err != nil {
+				t.Fatalf("max_turns_reached Raw = %s: %v", notices[0].Raw, err)
+			}
+			if payload.Data != (MaxTurnsReached{MaxTurns: 3, Turns: 3}) {
+				t.Errorf("max_turns_reached data = %+v, want 3 of 3 turns", payload.Data)
+			}
+		})
+	}
+}
+
+func TestClient_ThinkingStream(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"thinking","thinking":"The user wants a sum.","signature":"sig1"}]}}'
+    echo '{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"thinking","thinking":"2 + 2 is 4."},{"type":"text","text":"The answer is 4."}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{MaxThinkingTokens: 1024})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.SendMessage(ctx, "What is 2 + 2?"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	var chunks []string
+	for chunk := range client.ThinkingStream(ctx) {
+		chunks = append(chunks, chunk)
+	}
+
+	want := []string{"The user wants a sum.", "2 + 2 is 4."}
+	if !reflect.DeepEqual(chunks, want) {
+		t.Errorf("ThinkingStream() = %q, want %q", chunks, want)
+	}
+	if got, want := client.LastThinking(), "The user wants a sum.\n2 + 2 is 4."; got != want {
+		t.Errorf("LastThinking() = %q, want %q", got, want)
+	}
+	if got, want := client.ResponseText(), "The answer is 4."; got != want {
+		t.Errorf("ResponseText() = %q, want %q", got, want)
+	}
+
+	// A new turn starts with no thinking
+	if err := client.SendMessage(ctx, "Again"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if got := client.LastThinking(); got != "" {
+		t.Errorf("LastThinking() after a new send = %q, want empty", got)
+	}
+}
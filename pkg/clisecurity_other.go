@@ -0,0 +1,9 @@
+//go:build !unix
+
+package pkg
+
+// verifyCLIPermissions is a no-op on platforms without Unix ownership and
+// permission bits; VerifyCLIPermissions is ignored there.
+func verifyCLIPermissions(cliPath string) error {
+	return nil
+}
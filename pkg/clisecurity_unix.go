@@ -0,0 +1,34 @@
+//go:build unix
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// verifyCLIPermissions checks that the CLI binary, after resolving
+// symlinks, is owned by root or the current user and is not world-writable,
+// so nobody else can have replaced it.
+func verifyCLIPermissions(cliPath string) error {
+	resolved, err := filepath.EvalSymlinks(cliPath)
+	if err != nil {
+		return NewCLISecurityError(cliPath, err.Error())
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return NewCLISecurityError(resolved, err.Error())
+	}
+
+	if info.Mode().Perm()&0002 != 0 {
+		return NewCLISecurityError(resolved, fmt.Sprintf("world-writable (mode %s)", info.Mode().Perm()))
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		if uid := int(stat.Uid); uid != 0 && uid != os.Getuid() {
+			return NewCLISecurityError(resolved, fmt.Sprintf("owned by uid %d, not root or the current user", uid))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+//go:build unix
+
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuery_VerifyCLIPermissions(t *testing.T) {
+	script := `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"launched"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+`
+
+	tests := []struct {
+		name       string
+		mode       os.FileMode
+		owner      int // -1 keeps the current user
+		wantReason string
+	}{
+		{name: "owned and not world-writable", mode: 0755, owner: -1},
+		{name: "world-writable", mode: 0777, owner: -1, wantReason: "world-writable"},
+		{name: "owned by another user", mode: 0755, owner: 65534, wantReason: "owned by uid 65534"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.owner >= 0 && os.Getuid() != 0 {
+				t.Skip("changing file ownership requires root")
+			}
+
+			cliPath := filepath.Join(t.TempDir(), "claude")
+			if err := os.WriteFile(cliPath, []byte(script), 0755); err != nil {
+				t.Fatalf("Failed to write mock CLI: %v", err)
+			}
+			// Chmod explicitly, as WriteFile's mode is subject to the umask
+			if err := os.Chmod(cliPath, tt.mode); err != nil {
+				t.Fatalf("Failed to chmod mock CLI: %v", err)
+			}
+			if tt.owner >= 0 {
+				if err := os.Chown(cliPath, tt.owner, -1); err != nil {
+					t.Fatalf("Failed to chown mock CLI: %v", err)
+				}
+			}
+			// Checks apply to the binary a symlink points at
+			link := filepath.Join(t.TempDir(), "claude-link")
+			if err := os.Symlink(cliPath, link); err != nil {
+				t.Fatalf("Failed to symlink mock CLI: %v", err)
+			}
+
+			result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{CLIPath: link, VerifyCLIPermissions: true})
+			if tt.wantReason == "" {
+				if err != nil {
+					t.Fatalf("Query() error = %v", err)
+				}
+				if result.Stdout != "launched" {
+					t.Errorf("Query() stdout = %q, want %q", result.Stdout, "launched")
+				}
+				return
+			}
+
+			var secErr *CLISecurityError
+			if !errors.As(err, &secErr) {
+				t.Fatalf("Query() error = %v, want *CLISecurityError", err)
+			}
+			cliPath, _ = filepath.EvalSymlinks(cliPath)
+			if secErr.Path != cliPath || !strings.Contains(secErr.Reason, tt.wantReason) {
+				t.Errorf("CLISecurityError = {Path %s, Reason %q}, want {%s, containing %q}", secErr.Path, secErr.Reason, cliPath, tt.wantReason)
+			}
+
+			// Without the option the same binary launches
+			if _, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{CLIPath: link}); err != nil {
+				t.Errorf("Query() without VerifyCLIPermissions error = %v", err)
+			}
+		})
+	}
+}
+
+func TestVersionDetection_VerifyCLIPermissions(t *testing.T) {
+	dir := setupScriptMockCLI(t, `#!/bin/sh
+touch "$(dirname "$0")/ran"
+echo '1.0.43 (Claude Code)'
+`)
+	cliPath := filepath.Join(dir, "claude")
+	if err := os.Chmod(cliPath, 0777); err != nil {
+		t.Fatalf("Failed to chmod mock CLI: %v", err)
+	}
+
+	issues := ValidateConfig(context.Background(), &ClaudeCodeOptions{CLIPath: cliPath, VerifyCLIPermissions: true})
+	if len(issues) != 1 || issues[0].Severity != ConfigIssueError || !strings.Contains(issues[0].Message, "world-writable") {
+		t.Errorf("ValidateConfig() = %v, want one world-writable error", issues)
+	}
+
+	path, _, err := DetectCLI()
+	var secErr *CLISecurityError
+	if !errors.As(err, &secErr) {
+		t.Errorf("DetectCLI() error = %v, want *CLISecurityError", err)
+	}
+	if path != cliPath {
+		t.Errorf("DetectCLI() path = %s, want %s", path, cliPath)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+		t.Error("world-writable CLI was run for its version")
+	}
+}
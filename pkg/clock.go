@@ -0,0 +1,40 @@
+package pkg
+
+import "time"
+
+// Clock is the SDK's source of time for timestamps and timeouts. Tests can
+// set ClaudeCodeOptions.Clock to a FakeClock to exercise timing-dependent
+// behavior without real sleeps.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time { return t.timer.C }
+func (t realTimer) Stop() bool          { return t.timer.Stop() }
+
+// clock returns the configured Clock, defaulting to the system clock.
+func (o *ClaudeCodeOptions) clock() Clock {
+	if o == nil || o.Clock == nil {
+		return realClock{}
+	}
+	return o.Clock
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import "strings"
+
+// CodeBlock is a fenced code block found in assistant text. Language is
+// the first word of the fence's info string, or "" when it has none.
+type CodeBlock struct {
+	Language string
+	Content  string
+}
+
+// CodeBlocks returns the fenced code blocks in the assistant text of the
+// result, in order. Fences follow CommonMark: ``` or ~~~, at least three
+// long and indented at most three spaces. A block is only closed by a
+// bare fence of the same character at least as long as the opening one,
+// so a longer outer fence can hold shorter fences as content. A block
+// left open runs to the end of its text block.
+func (r *QueryResult) CodeBlocks() []CodeBlock {
+	var blocks []CodeBlock
+	for _, msg := range r.Messages {
+		assistant, ok := msg.(*AssistantMessage)
+		if !ok {
+			continue
+		}
+		for _, block := range assistant.Content {
+			if text, ok := block.(TextBlock); ok {
+				blocks = append(blocks, parseCodeBlocks(text.Text)...)
+			}
+		}
+	}
+	return blocks
+}
+
+func parseCodeBlocks(text string) []CodeBlock {
+	var (
+		blocks  []CodeBlock
+		open    bool
+		fence   string
+		current CodeBlock
+		lines   []string
+	)
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		marker, info, ok := parseFence(line)
+
+		if !open {
+			if ok {
+				open, fence = true, marker
+				current = CodeBlock{Language: firstWord(info)}
+				lines = nil
+			}
+			continue
+		}
+
+		if ok && info == "" && marker[0] == fence[0] && len(marker) >= len(fence) {
+			current.Content = strings.Join(lines, "\n")
+			blocks = append(blocks, current)
+			open = false
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	if open {
+		current.Content = strings.Join(lines, "\n")
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// parseFence reports whether line is a code fence, returning the fence
+// characters and the trimmed info string after them.
+func parseFence(line string) (marker, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+
+	char := trimmed[0]
+	if char != '`' && char != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == char {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+
+	info = strings.TrimSpace(trimmed[n:])
+	// Backtick fences can't have backticks in their info string
+	if char == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], info, true
+}
+
+func firstWord(s string) string {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryResult_CodeBlocks(t *testing.T) {
+	tests := []struct {
+		name string
+		text []string
+		want []CodeBlock
+	}{
+		{
+			name: "no code",
+			text: []string{"Just prose, with `inline` code."},
+			want: nil,
+		},
+		{
+			name: "multiple languages",
+			text: []string{"Go:\n```go\nfmt.Println(\"hi\")\n```\nShell:\n```bash\necho hi\n```\nPlain:\n```\nplain text\n```"},
+			want: []CodeBlock{
+				{Language: "go", Content: "fmt.Println(\"hi\")"},
+				{Language: "bash", Content: "echo hi"},
+				{Language: "", Content: "plain text"},
+			},
+		},
+		{
+			name: "info string with attributes",
+			text: []string{"```python title=\"main.py\"\nprint(1)\n\nprint(2)\n```"},
+			want: []CodeBlock{{Language: "python", Content: "print(1)\n\nprint(2)"}},
+		},
+		{
+			name: "nested fences",
+			text: []string{"````markdown\nExample:\n```js\nlet x = 1\n```\n````"},
+			want: []CodeBlock{{Language: "markdown", Content: "Example:\n```js\nlet x = 1\n```"}},
+		},
+		{
+			name: "tilde fence holds backticks",
+			text: []string{"~~~ruby\nputs `date`\n```\n~~~"},
+			want: []CodeBlock{{Language: "ruby", Content: "puts `date`\n```"}},
+		},
+		{
+			name: "indented fence and CRLF",
+			text: []string{"  ```sql\r\nSELECT 1;\r\n  ```\r\n"},
+			want: []CodeBlock{{Language: "sql", Content: "SELECT 1;"}},
+		},
+		{
+			name: "unclosed fence",
+			text: []string{"```go\npackage main"},
+			want: []CodeBlock{{Language: "go", Content: "package main"}},
+		},
+		{
+			name: "across messages",
+			text: []string{"```go\na\n```", "```rust\nb\n```"},
+			want: []CodeBlock{{Language: "go", Content: "a"}, {Language: "rust", Content: "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &QueryResult{}
+			for _, text := range tt.text {
+				result.Messages = append(result.Messages, &AssistantMessage{
+					Role:    MessageRoleAssistant,
+					Content: []ContentBlock{TextBlock{Type: "text", Text: text}},
+				})
+			}
+
+			if got := result.CodeBlocks(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CodeBlocks() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretNamePattern matches environment variable and flag names whose
+// values are treated as secrets.
+var secretNamePattern = regexp.MustCompile(`(?i)(key|token|secret|password|passwd|credential|auth)`)
+
+// launchCommand records what was exec'd for a CLI launch, with secrets
+// redacted.
+type launchCommand struct {
+	path string
+	args []string
+	env  []string
+}
+
+func newLaunchCommand(path string, args, env []string) *launchCommand {
+	return &launchCommand{
+		path: path,
+		args: redactArgs(args),
+		env:  redactEnv(env),
+	}
+}
+
+// redactEnv replaces the values of secret-looking variables.
+func redactEnv(env []string) []string {
+	result := make([]string, len(env))
+	for i, kv := range env {
+		name, _, found := strings.Cut(kv, "=")
+		if found && secretNamePattern.MatchString(name) {
+			kv = name + "=" + redacted
+		}
+		result[i] = kv
+	}
+	return result
+}
+
+// redactArgs replaces the values of secret-looking flags, given either as
+// "--flag value" or "--flag=value".
+func redactArgs(args []string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i := 0; i < len(result); i++ {
+		arg := result[i]
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, _, hasValue := strings.Cut(arg, "=")
+		if !secretNamePattern.MatchString(name) {
+			continue
+		}
+		if hasValue {
+			result[i] = name + "=" + redacted
+		} else if i+1 < len(result) && !strings.HasPrefix(result[i+1], "-") {
+			result[i+1] = redacted
+			i++
+		}
+	}
+	return result
+}
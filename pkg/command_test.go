@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "no secrets",
+			args: []string{"--model", "claude-opus", "--verbose"},
+			want: []string{"--model", "claude-opus", "--verbose"},
+		},
+		{
+			name: "separate value",
+			args: []string{"--api-key", "sk-123", "--verbose"},
+			want: []string{"--api-key", redacted, "--verbose"},
+		},
+		{
+			name: "inline value",
+			args: []string{"--auth-token=abc", "--print", "hi"},
+			want: []string{"--auth-token=" + redacted, "--print", "hi"},
+		},
+		{
+			name: "secret flag without value",
+			args: []string{"--use-token", "--verbose"},
+			want: []string{"--use-token", "--verbose"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactEnv(t *testing.T) {
+	env := []string{"PATH=/usr/bin", "ANTHROPIC_API_KEY=sk-123", "GITHUB_TOKEN=ghp", "HOME=/root"}
+	want := []string{"PATH=/usr/bin", "ANTHROPIC_API_KEY=" + redacted, "GITHUB_TOKEN=" + redacted, "HOME=/root"}
+	if got := redactEnv(env); !reflect.DeepEqual(got, want) {
+		t.Errorf("redactEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_LastCommand(t *testing.T) {
+	dir := setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do :; done
+`)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-secret")
+
+	client := NewClient(&ClaudeCodeOptions{Model: "claude-opus", MaxTurns: 3})
+	if path, args, env := client.LastCommand(); path != "" || args != nil || env != nil {
+		t.Errorf("LastCommand() before Connect = %q, %v, %v, want empty", path, args, env)
+	}
+
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	client.Close()
+
+	// The launch is still reported after Close
+	path, args, env := client.LastCommand()
+	if path != filepath.Join(dir, "claude") {
+		t.Errorf("LastCommand() path = %q, want %q", path, filepath.Join(dir, "claude"))
+	}
+
+	wantArgs := []string{
+		"--output-format", "stream-json", "--verbose",
+		"--model", "claude-opus", "--max-turns", "3",
+		"--input-format", "stream-json",
+	}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("LastCommand() args = %v, want %v", args, wantArgs)
+	}
+
+	var sawEntrypoint, sawKey bool
+	for _, kv := range env {
+		switch {
+		case kv == "CLAUDE_CODE_ENTRYPOINT=sdk-go":
+			sawEntrypoint = true
+		case strings.HasPrefix(kv, "ANTHROPIC_API_KEY="):
+			sawKey = true
+			if kv != "ANTHROPIC_API_KEY="+redacted {
+				t.Errorf("LastCommand() env leaked the API key: %q", kv)
+			}
+		}
+	}
+	if !sawEntrypoint || !sawKey {
+		t.Errorf("LastCommand() env missing entries: entrypoint %v, api key %v", sawEntrypoint, sawKey)
+	}
+}
@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const versionTimeout = 10 * time.Second
+
+type ConfigIssueSeverity string
+
+const (
+	ConfigIssueError   ConfigIssueSeverity = "error"
+	ConfigIssueWarning ConfigIssueSeverity = "warning"
+)
+
+// ConfigIssue is a problem found by ValidateConfig. Option names the
+// ClaudeCodeOptions field involved, or is empty for issues with the CLI
+// itself.
+type ConfigIssue struct {
+	Severity ConfigIssueSeverity
+	Option   string
+	Message  string
+}
+
+func (i ConfigIssue) String() string {
+	if i.Option == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Option, i.Message)
+}
+
+// cliVersion is a parsed major.minor.patch CLI version
+type cliVersion [3]int
+
+var versionPattern = regexp.MustCompile(`(\d+)\.(\d+)\.(\d+)`)
+
+func parseCLIVersion(s string) (cliVersion, bool) {
+	match := versionPattern.FindStringSubmatch(s)
+	if match == nil {
+		return cliVersion{}, false
+	}
+	var v cliVersion
+	for i := range v {
+		v[i], _ = strconv.Atoi(match[i+1])
+	}
+	return v, true
+}
+
+func (v cliVersion) less(other cliVersion) bool {
+	for i := range v {
+		if v[i] != other[i] {
+			return v[i] < other[i]
+		}
+	}
+	return false
+}
+
+func (v cliVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
+
+// detectCLIVersion runs the CLI with --version, after the same OfflineOnly
+// and VerifyCLIPermissions checks a launch with options would make
+func detectCLIVersion(ctx context.Context, cliPath string, options *ClaudeCodeOptions) (cliVersion, error) {
+	if err := checkCLILaunch(cliPath, options); err != nil {
+		return cliVersion{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, cliPath, "--version").Output()
+	if err != nil {
+		return cliVersion{}, err
+	}
+	v, ok := parseCLIVersion(string(out))
+	if !ok {
+		return cliVersion{}, fmt.Errorf("unrecognized version output %q", string(out))
+	}
+	return v, nil
+}
+
+// DetectCLI reports which CLI binary the SDK would launch and its version,
+// for debugging PATH issues. It looks the binary up afresh on every call.
+// A *CLINotFoundError is returned when no CLI is found; if the binary is
+// found but its version can't be determined, path is still returned along
+// with the error. As it runs whatever binary PATH resolves to, the binary
+// must pass the VerifyCLIPermissions checks first. It takes no options, so
+// OfflineOnly does not apply: use ValidateConfig to respect it.
+func DetectCLI() (path string, version string, err error) {
+	path, err = findCLI()
+	if err != nil {
+		return "", "", err
+	}
+
+	v, err := detectCLIVersion(context.Background(), path, &ClaudeCodeOptions{VerifyCLIPermissions: true})
+	if err != nil {
+		return path, "", NewCLIConnectionError("Failed to detect Claude Code CLI version", err)
+	}
+	return path, v.String(), nil
+}
+
+// optionRequirement is an option that only works with newer CLI versions
+type optionRequirement struct {
+	option     string
+	minVersion cliVersion
+	isSet      func(o *ClaudeCodeOptions) bool
+}
+
+// optionRequirements lists the options ValidateConfig checks against the
+// CLI version. Each entry must name the CLI release that introduced the
+// option, taken from the CLI's changelog; none are known yet.
+var optionRequirements []optionRequirement
+
+// ValidateConfig checks options against the installed CLI without running a
+// query: the options must pass the SDK's own validation, and the CLI must be
+// found, pass the OfflineOnly and VerifyCLIPermissions checks, and report
+// its version. Options are only checked against that version where
+// optionRequirements names the release that added them, which it does for
+// none yet. Unknown MCP server types and deprecated fields are reported as
+// warnings. It returns nil when no issues are found.
+func ValidateConfig(ctx context.Context, options *ClaudeCodeOptions) []ConfigIssue {
+	if options == nil {
+		options = &ClaudeCodeOptions{}
+	}
+
+	var issues []ConfigIssue
+
+	if err := options.Validate(); err != nil {
+		issue := ConfigIssue{Severity: ConfigIssueError, Message: err.Error()}
+		var optErr *InvalidOptionError
+		if errors.As(err, &optErr) {
+			issue.Option = optErr.Option
+		}
+		issues = append(issues, issue)
+	}
+
+	for name, server := range options.McpServers {
+		switch server.Type {
+		case "", MCPServerTypeStdio, MCPServerTypeSSE, MCPServerTypeHTTP:
+		default:
+			issues = append(issues, ConfigIssue{
+				Severity: ConfigIssueWarning,
+				Option:   "McpServers",
+				Message:  fmt.Sprintf("server %q has unsupported type %q", name, server.Type),
+			})
+		}
+	}
+
+	if options.Mode != "" {
+		issues = append(issues, ConfigIssue{
+			Severity: ConfigIssueWarning,
+			Option:   "Mode",
+			Message:  "deprecated, use PermissionMode",
+		})
+	}
+	if len(options.OnlyTools) > 0 {
+		issues = append(issues, ConfigIssue{
+			Severity: ConfigIssueWarning,
+			Option:   "OnlyTools",
+			Message:  "deprecated, use AllowedTools",
+		})
+	}
+
+	cliPath, err := resolveCLI(options)
+	if err != nil {
+		return append(issues, ConfigIssue{Severity: ConfigIssueError, Message: err.Error()})
+	}
+
+	version, err := detectCLIVersion(ctx, cliPath, options)
+	// A binary that may not be launched is a configuration error
+	var secErr *CLISecurityError
+	var offlineErr *OfflineLaunchError
+	if errors.As(err, &secErr) || errors.As(err, &offlineErr) {
+		return append(issues, ConfigIssue{Severity: ConfigIssueError, Message: err.Error()})
+	}
+	if err != nil {
+		return append(issues, ConfigIssue{
+			Severity: ConfigIssueWarning,
+			Message:  fmt.Sprintf("could not detect CLI version, option support not checked: %v", err),
+		})
+	}
+
+	for _, req := range optionRequirements {
+		if req.isSet(options) && version.less(req.minVersion) {
+			issues = append(issues, ConfigIssue{
+				Severity: ConfigIssueError,
+				Option:   req.option,
+				Message:  fmt.Sprintf("requires CLI >= %s, found %s", req.minVersion, version),
+			})
+		}
+	}
+
+	return issues
+}
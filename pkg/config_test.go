@@ -0,0 +1,165 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCLIVersion(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   cliVersion
+		wantOK bool
+	}{
+		{"1.0.43 (Claude Code)\n", cliVersion{1, 0, 43}, true},
+		{"claude 0.2.9", cliVersion{0, 2, 9}, true},
+		{"unknown", cliVersion{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseCLIVersion(tt.input)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseCLIVersion(%q) = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	httpServers := map[string]MCPServerConfig{
+		"remote": {Type: MCPServerTypeHTTP, URL: "https://example.com/mcp"},
+	}
+
+	// A made-up requirement, since the real table has no entries to test
+	saved := optionRequirements
+	optionRequirements = []optionRequirement{{
+		option:     "MaxThinkingTokens",
+		minVersion: cliVersion{1, 0, 30},
+		isSet:      func(o *ClaudeCodeOptions) bool { return o.MaxThinkingTokens > 0 },
+	}}
+	t.Cleanup(func() { optionRequirements = saved })
+
+	tests := []struct {
+		name       string
+		version    string
+		options    *ClaudeCodeOptions
+		wantIssues []string
+	}{
+		{
+			name:    "supported options",
+			version: "1.0.43 (Claude Code)",
+			options: &ClaudeCodeOptions{McpServers: httpServers, MaxThinkingTokens: 1000},
+		},
+		{
+			name:       "option needs newer CLI",
+			version:    "1.0.20 (Claude Code)",
+			options:    &ClaudeCodeOptions{MaxThinkingTokens: 1000},
+			wantIssues: []string{"error: MaxThinkingTokens: requires CLI >= 1.0.30, found 1.0.20"},
+		},
+		{
+			name:    "unknown MCP type and deprecated field",
+			version: "1.0.43 (Claude Code)",
+			options: &ClaudeCodeOptions{
+				McpServers: map[string]MCPServerConfig{"ws": {Type: "websocket"}},
+				Mode:       PermissionModeDefault,
+			},
+			wantIssues: []string{
+				`warning: McpServers: server "ws" has unsupported type "websocket"`,
+				"warning: Mode: deprecated, use PermissionMode",
+			},
+		},
+		{
+			name:       "invalid option",
+			version:    "1.0.43 (Claude Code)",
+			options:    &ClaudeCodeOptions{Cwd: filepath.Join(t.TempDir(), "missing")},
+			wantIssues: []string{"error: Cwd: invalid option Cwd="},
+		},
+		{
+			name:       "unrecognized version",
+			version:    "dev build",
+			options:    &ClaudeCodeOptions{},
+			wantIssues: []string{"warning: could not detect CLI version"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, `#!/bin/sh
+if [ "$1" = "--version" ]; then
+    echo '`+tt.version+`'
+    exit 0
+fi
+exit 1
+`)
+
+			issues := ValidateConfig(context.Background(), tt.options)
+			if len(issues) != len(tt.wantIssues) {
+				t.Fatalf("ValidateConfig() = %v, want %d issues", issues, len(tt.wantIssues))
+			}
+			for i, want := range tt.wantIssues {
+				if got := issues[i].String(); !strings.HasPrefix(got, want) {
+					t.Errorf("issue %d = %q, want prefix %q", i, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectCLI(t *testing.T) {
+	versionScript := func(version string) string {
+		return `#!/bin/sh
+if [ "$1" = "--version" ]; then
+    echo '` + version + `'
+    exit 0
+fi
+exit 1
+`
+	}
+
+	dir := setupScriptMockCLI(t, versionScript("1.0.43 (Claude Code)"))
+	path, version, err := DetectCLI()
+	if err != nil {
+		t.Fatalf("DetectCLI() error = %v", err)
+	}
+	if path != filepath.Join(dir, "claude") || version != "1.0.43" {
+		t.Errorf("DetectCLI() = (%s, %s), want (%s, 1.0.43)", path, version, filepath.Join(dir, "claude"))
+	}
+
+	// A newer install earlier on PATH must be picked up, not a cached result
+	dir = setupScriptMockCLI(t, versionScript("2.1.0"))
+	path, version, err = DetectCLI()
+	if err != nil {
+		t.Fatalf("DetectCLI() error = %v", err)
+	}
+	if path != filepath.Join(dir, "claude") || version != "2.1.0" {
+		t.Errorf("DetectCLI() after PATH change = (%s, %s), want (%s, 2.1.0)", path, version, filepath.Join(dir, "claude"))
+	}
+
+	dir = setupScriptMockCLI(t, versionScript("dev build"))
+	path, _, err = DetectCLI()
+	if err == nil {
+		t.Error("DetectCLI() with unparseable version error = nil, want error")
+	}
+	if path != filepath.Join(dir, "claude") {
+		t.Errorf("DetectCLI() path = %s, want %s even when the version is unknown", path, filepath.Join(dir, "claude"))
+	}
+}
+
+func TestDetectCLI_NotFound(t *testing.T) {
+	for _, fallback := range []string{"/usr/local/bin/claude", "/usr/local/bin/claude-code", "/opt/homebrew/bin/claude", "/opt/homebrew/bin/claude-code"} {
+		if _, err := os.Stat(fallback); err == nil {
+			t.Skipf("a CLI is installed at %s", fallback)
+		}
+	}
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	_, _, err := DetectCLI()
+	var notFound *CLINotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("DetectCLI() error = %v, want *CLINotFoundError", err)
+	}
+}
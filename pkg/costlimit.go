@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// CostLimitExceeded is the data of the cost_limit_exceeded system message
+// sent when a session's cost passes MaxCostUSD.
+type CostLimitExceeded struct {
+	MaxCostUSD float64 `json:"maxCostUsd"`
+	TotalCost  float64 `json:"totalCost"`
+}
+
+// checkCostLimit adds a result's cost to the session total and, the first
+// time the total passes MaxCostUSD, interrupts the CLI and returns the
+// cost_limit_exceeded notice to deliver. It is only called from the read
+// loop.
+func (t *transport) checkCostLimit(result ResultMessage) (SystemMessage, bool) {
+	t.totalCost += result.Data.Cost.TotalCost
+
+	limit := t.options.MaxCostUSD
+	if limit <= 0 || t.costExceeded || t.totalCost <= limit {
+		return SystemMessage{}, false
+	}
+	t.costExceeded = true
+
+	// A Query's stdin is already closed, so there is nothing to interrupt
+	if t.isStreaming {
+		go t.sendInterrupt(context.Background(), "cost limit exceeded")
+	}
+
+	return sdkNotice(SystemMessageSubtypeCostLimitExceeded, CostLimitExceeded{MaxCostUSD: limit, TotalCost: t.totalCost}), true
+}
+
+// BackgroundTokenLimitExceeded is the data of the
+// background_token_limit_exceeded system message sent when a session's
+// background tokens pass MaxBackgroundTokens.
+type BackgroundTokenLimitExceeded struct {
+	MaxBackgroundTokens int `json:"maxBackgroundTokens"`
+	BackgroundTokens    int `json:"backgroundTokens"`
+}
+
+// checkBackgroundTokens tracks background token usage from usage and result
+// messages and, the first time the session total passes
+// MaxBackgroundTokens, interrupts the CLI and returns the
+// background_token_limit_exceeded notice to deliver. It is only called from
+// the read loop.
+func (t *transport) checkBackgroundTokens(msg Message) (SystemMessage, bool) {
+	switch m := msg.(type) {
+	case SystemMessage:
+		if m.Subtype != SystemMessageSubtypeUsage {
+			return SystemMessage{}, false
+		}
+		var payload struct {
+			Data ResultUsage `json:"data"`
+		}
+		if err := json.Unmarshal(m.Raw, &payload); err != nil {
+			return SystemMessage{}, false
+		}
+		// Usage updates are cumulative for the turn
+		t.turnBackgroundTokens = payload.Data.BackgroundTokens
+	case ResultMessage:
+		t.backgroundTokens += m.Data.Usage.BackgroundTokens
+		t.turnBackgroundTokens = 0
+	default:
+		return SystemMessage{}, false
+	}
+
+	limit := t.options.MaxBackgroundTokens
+	used := t.backgroundTokens + t.turnBackgroundTokens
+	if limit <= 0 || t.backgroundExceeded || used <= limit {
+		return SystemMessage{}, false
+	}
+	t.backgroundExceeded = true
+
+	if t.isStreaming {
+		go t.sendInterrupt(context.Background(), "background token limit exceeded")
+	}
+
+	return sdkNotice(SystemMessageSubtypeBackgroundTokenLimitExceeded, BackgroundTokenLimitExceeded{MaxBackgroundTokens: limit, BackgroundTokens: used}), true
+}
+
+// backgroundTokenLimitError returns the BackgroundTokenLimitError that msg
+// reports if it is a background_token_limit_exceeded notice, or nil.
+func backgroundTokenLimitError(msg Message) error {
+	system, ok := msg.(SystemMessage)
+	if !ok || system.Subtype != SystemMessageSubtypeBackgroundTokenLimitExceeded {
+		return nil
+	}
+	var payload struct {
+		Data BackgroundTokenLimitExceeded `json:"data"`
+	}
+	json.Unmarshal(system.Raw, &payload)
+	return NewBackgroundTokenLimitError(payload.Data.BackgroundTokens, payload.Data.MaxBackgroundTokens)
+}
+
+// sdkNotice builds a system message the SDK sends itself, decoded and with
+// Raw set as if it had come from the CLI.
+func sdkNotice(subtype SystemMessageSubtype, data interface{}) SystemMessage {
+	raw, _ := json.Marshal(struct {
+		Role    MessageRole          `json:"role"`
+		Subtype SystemMessageSubtype `json:"subtype"`
+		Data    interface{}          `json:"data"`
+	}{
+		Role:    MessageRoleSystem,
+		Subtype: subtype,
+		Data:    data,
+	})
+	var notice SystemMessage
+	json.Unmarshal(raw, &notice)
+	notice.Raw = raw
+	return notice
+}
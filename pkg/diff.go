@@ -0,0 +1,197 @@
+package pkg
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UnifiedDiff is a unified diff parsed from a tool result
+type UnifiedDiff struct {
+	Files []DiffFile
+}
+
+// DiffFile is the part of a diff that changes one file. The paths are as
+// given in the --- and +++ headers without their a/ and b/ prefixes, and
+// /dev/null for a created or deleted file. Both are empty for hunks that
+// had no file headers.
+type DiffFile struct {
+	OldPath string
+	NewPath string
+	Hunks   []DiffHunk
+}
+
+// DiffHunk is one @@ section of a diff, covering OldLines lines from
+// OldStart in the old file and NewLines lines from NewStart in the new one.
+type DiffHunk struct {
+	OldStart int
+	OldLines int
+	NewStart int
+	NewLines int
+	Lines    []DiffLine
+}
+
+// DiffLineKind says whether a diff line was kept, added or removed
+type DiffLineKind int
+
+const (
+	DiffContext DiffLineKind = iota
+	DiffAdded
+	DiffRemoved
+)
+
+// DiffLine is a line of a hunk, without its leading marker
+type DiffLine struct {
+	Kind DiffLineKind
+	Text string
+}
+
+// Added returns the lines the hunk adds
+func (h DiffHunk) Added() []string { return h.linesOf(DiffAdded) }
+
+// Removed returns the lines the hunk removes
+func (h DiffHunk) Removed() []string { return h.linesOf(DiffRemoved) }
+
+func (h DiffHunk) linesOf(kind DiffLineKind) []string {
+	var lines []string
+	for _, line := range h.Lines {
+		if line.Kind == kind {
+			lines = append(lines, line.Text)
+		}
+	}
+	return lines
+}
+
+// AsDiff parses the result's content as a unified diff. It reports false
+// when the content holds no hunks or a hunk is malformed or cut short.
+// Text around the diff, such as a message or code fence, is ignored.
+func (b ToolResultBlock) AsDiff() (*UnifiedDiff, bool) {
+	return parseUnifiedDiff(toolResultText(b.Content))
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+func parseUnifiedDiff(text string) (*UnifiedDiff, bool) {
+	diff := &UnifiedDiff{}
+	lines := strings.Split(text, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+
+		if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+			diff.Files = append(diff.Files, DiffFile{
+				OldPath: diffPath(line[4:], "a/"),
+				NewPath: diffPath(strings.TrimSuffix(lines[i+1], "\r")[4:], "b/"),
+			})
+			i++
+			continue
+		}
+
+		if !strings.HasPrefix(line, "@@ ") {
+			continue
+		}
+		hunk, ok := parseHunkHeader(line)
+		if !ok {
+			return nil, false
+		}
+
+		// Read until both sides have as many lines as the header says
+		oldLeft, newLeft := hunk.OldLines, hunk.NewLines
+		for (oldLeft > 0 || newLeft > 0) && i+1 < len(lines) {
+			i++
+			body := strings.TrimSuffix(lines[i], "\r")
+			if strings.HasPrefix(body, `\`) {
+				// "\ No newline at end of file"
+				continue
+			}
+
+			kind := DiffContext
+			text := body
+			if body != "" {
+				switch body[0] {
+				case ' ':
+				case '+':
+					kind = DiffAdded
+				case '-':
+					kind = DiffRemoved
+				default:
+					return nil, false
+				}
+				text = body[1:]
+			}
+
+			switch kind {
+			case DiffContext:
+				oldLeft--
+				newLeft--
+			case DiffAdded:
+				newLeft--
+			case DiffRemoved:
+				oldLeft--
+			}
+			if oldLeft < 0 || newLeft < 0 {
+				return nil, false
+			}
+			hunk.Lines = append(hunk.Lines, DiffLine{Kind: kind, Text: text})
+		}
+		if oldLeft > 0 || newLeft > 0 {
+			return nil, false
+		}
+
+		if len(diff.Files) == 0 {
+			diff.Files = append(diff.Files, DiffFile{})
+		}
+		file := &diff.Files[len(diff.Files)-1]
+		file.Hunks = append(file.Hunks, hunk)
+	}
+
+	// Drop headers that no hunk followed
+	files := diff.Files[:0]
+	for _, file := range diff.Files {
+		if len(file.Hunks) > 0 {
+			files = append(files, file)
+		}
+	}
+	diff.Files = files
+
+	if len(diff.Files) == 0 {
+		return nil, false
+	}
+	return diff, true
+}
+
+func parseHunkHeader(line string) (DiffHunk, bool) {
+	m := hunkHeaderRe.FindStringSubmatch(line)
+	if m == nil {
+		return DiffHunk{}, false
+	}
+	count := func(s string) int {
+		// A range without a count covers one line
+		if s == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	oldStart, _ := strconv.Atoi(m[1])
+	newStart, _ := strconv.Atoi(m[3])
+	return DiffHunk{
+		OldStart: oldStart,
+		OldLines: count(m[2]),
+		NewStart: newStart,
+		NewLines: count(m[4]),
+	}, true
+}
+
+// diffPath strips the timestamp some tools append after a tab and the
+// a/ or b/ prefix git adds.
+func diffPath(header, prefix string) string {
+	if tab := strings.IndexByte(header, '\t'); tab >= 0 {
+		header = header[:tab]
+	}
+	header = strings.TrimSpace(header)
+	if header == "/dev/null" {
+		return header
+	}
+	return strings.TrimPrefix(header, prefix)
+}
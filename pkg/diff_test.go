@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+const sampleDiff = `Applied the following changes:
+
+diff --git a/main.go b/main.go
+index 3b18e51..a9c2f4d 100644
+--- a/main.go
++++ b/main.go
+@@ -1,5 +1,7 @@
+ package main
+ 
++import "fmt"
++
+ func main() {
+-	println("hello")
++	fmt.Println("hello")
+ }
+--- /dev/null
++++ b/README.md
+@@ -0,0 +1 @@
++# Demo
+\ No newline at end of file
+`
+
+func TestToolResultBlock_AsDiff(t *testing.T) {
+	block := ToolResultBlock{
+		Type:      "tool_result",
+		ToolUseID: "tool_1",
+		Content: []interface{}{
+			map[string]interface{}{"type": "text", "text": sampleDiff},
+		},
+	}
+
+	diff, ok := block.AsDiff()
+	if !ok {
+		t.Fatal("AsDiff() ok = false, want true")
+	}
+	if len(diff.Files) != 2 {
+		t.Fatalf("len(Files) = %d, want 2", len(diff.Files))
+	}
+
+	main := diff.Files[0]
+	if main.OldPath != "main.go" || main.NewPath != "main.go" {
+		t.Errorf("paths = %q, %q, want main.go, main.go", main.OldPath, main.NewPath)
+	}
+	if len(main.Hunks) != 1 {
+		t.Fatalf("len(Hunks) = %d, want 1", len(main.Hunks))
+	}
+	hunk := main.Hunks[0]
+	if hunk.OldStart != 1 || hunk.OldLines != 5 || hunk.NewStart != 1 || hunk.NewLines != 7 {
+		t.Errorf("ranges = -%d,%d +%d,%d, want -1,5 +1,7", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+	}
+	if got, want := hunk.Added(), []string{`import "fmt"`, "", `	fmt.Println("hello")`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Added() = %q, want %q", got, want)
+	}
+	if got, want := hunk.Removed(), []string{`	println("hello")`}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Removed() = %q, want %q", got, want)
+	}
+	if len(hunk.Lines) != 8 {
+		t.Errorf("len(Lines) = %d, want 8", len(hunk.Lines))
+	}
+
+	readme := diff.Files[1]
+	if readme.OldPath != "/dev/null" || readme.NewPath != "README.md" {
+		t.Errorf("paths = %q, %q, want /dev/null, README.md", readme.OldPath, readme.NewPath)
+	}
+	if got, want := readme.Hunks[0].Added(), []string{"# Demo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Added() = %q, want %q", got, want)
+	}
+}
+
+func TestToolResultBlock_AsDiffRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		content interface{}
+	}{
+		{name: "plain text", content: "The file main.go has been updated."},
+		{name: "nil content", content: nil},
+		{name: "headers only", content: "--- a/x\n+++ b/x\n"},
+		{name: "cut short", content: "@@ -1,3 +1,3 @@\n a\n-b\n"},
+		{name: "bad line", content: "@@ -1,2 +1,2 @@\n a\n*b\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := ToolResultBlock{Type: "tool_result", Content: tt.content}
+			if diff, ok := block.AsDiff(); ok {
+				t.Errorf("AsDiff() = %+v, true, want false", diff)
+			}
+		})
+	}
+}
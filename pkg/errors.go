@@ -1,9 +1,42 @@
 package pkg
 
 import (
+	"errors"
 	"fmt"
+	"time"
 )
 
+// Sentinel errors for checking the category of an SDK error with
+// errors.Is, e.g. errors.Is(err, ErrCLI). Every SDK error matches ErrSDK.
+var (
+	ErrSDK             = errors.New("claude sdk error")
+	ErrCLI             = errors.New("claude cli error")
+	ErrParse           = errors.New("claude output parse error")
+	ErrInvalidOption   = errors.New("invalid claude option")
+	ErrUnsupported     = errors.New("unsupported by claude cli")
+	ErrLimit           = errors.New("claude limit exceeded")
+	ErrTimeout         = errors.New("claude timeout")
+	ErrSessionInUse    = errors.New("claude session in use")
+	ErrInterrupted     = errors.New("claude turn interrupted")
+	ErrAuthRequired    = errors.New("claude cli requires login")
+	ErrOffline         = errors.New("claude cli launch blocked by OfflineOnly")
+	ErrContextOverflow = errors.New("claude context window exceeded")
+	ErrCLISecurity     = errors.New("claude cli failed security checks")
+)
+
+// isCategory reports whether target is ErrSDK or one of categories.
+func isCategory(target error, categories ...error) bool {
+	if target == ErrSDK {
+		return true
+	}
+	for _, category := range categories {
+		if target == category {
+			return true
+		}
+	}
+	return false
+}
+
 type ClaudeSDKError struct {
 	Message string
 	Cause   error
@@ -20,6 +53,8 @@ func (e *ClaudeSDKError) Unwrap() error {
 	return e.Cause
 }
 
+func (e *ClaudeSDKError) Is(target error) bool { return isCategory(target) }
+
 type CLIConnectionError struct {
 	ClaudeSDKError
 }
@@ -33,6 +68,8 @@ func NewCLIConnectionError(message string, cause error) *CLIConnectionError {
 	}
 }
 
+func (e *CLIConnectionError) Is(target error) bool { return isCategory(target, ErrCLI) }
+
 type CLINotFoundError struct {
 	ClaudeSDKError
 	SearchPaths []string
@@ -57,6 +94,8 @@ After installation, make sure 'claude-code' is in your PATH.`
 	}
 }
 
+func (e *CLINotFoundError) Is(target error) bool { return isCategory(target, ErrCLI) }
+
 type ProcessError struct {
 	ClaudeSDKError
 	ExitCode int
@@ -80,6 +119,8 @@ func NewProcessError(exitCode int, stdout, stderr string) *ProcessError {
 	}
 }
 
+func (e *ProcessError) Is(target error) bool { return isCategory(target, ErrCLI) }
+
 type CLIJSONDecodeError struct {
 	ClaudeSDKError
 	RawData string
@@ -95,6 +136,27 @@ func NewCLIJSONDecodeError(rawData string, cause error) *CLIJSONDecodeError {
 	}
 }
 
+func (e *CLIJSONDecodeError) Is(target error) bool { return isCategory(target, ErrParse) }
+
+// JSONOutputError reports assistant output that QueryJSON could not decode.
+// Text is the assistant's full answer.
+type JSONOutputError struct {
+	ClaudeSDKError
+	Text string
+}
+
+func NewJSONOutputError(text string, cause error) *JSONOutputError {
+	return &JSONOutputError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: "assistant output is not the expected JSON",
+			Cause:   cause,
+		},
+		Text: text,
+	}
+}
+
+func (e *JSONOutputError) Is(target error) bool { return isCategory(target, ErrParse) }
+
 type MessageParseError struct {
 	ClaudeSDKError
 	MessageType string
@@ -110,4 +172,324 @@ func NewMessageParseError(messageType string, rawMessage interface{}, cause erro
 		MessageType: messageType,
 		RawMessage:  rawMessage,
 	}
-}
\ No newline at end of file
+}
+
+func (e *MessageParseError) Is(target error) bool { return isCategory(target, ErrParse) }
+
+type UnsupportedError struct {
+	ClaudeSDKError
+	Feature string
+}
+
+func NewUnsupportedError(feature, reason string) *UnsupportedError {
+	return &UnsupportedError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("%s is not supported: %s", feature, reason),
+		},
+		Feature: feature,
+	}
+}
+
+func (e *UnsupportedError) Is(target error) bool { return isCategory(target, ErrUnsupported) }
+
+type InvalidOptionError struct {
+	ClaudeSDKError
+	Option string
+	Value  string
+}
+
+func NewInvalidOptionError(option, value, reason string) *InvalidOptionError {
+	return &InvalidOptionError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("invalid option %s=%q: %s", option, value, reason),
+		},
+		Option: option,
+		Value:  value,
+	}
+}
+
+func (e *InvalidOptionError) Is(target error) bool { return isCategory(target, ErrInvalidOption) }
+
+type SessionInUseError struct {
+	ClaudeSDKError
+	SessionID string
+}
+
+func NewSessionInUseError(sessionID string) *SessionInUseError {
+	return &SessionInUseError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("session %s is already in use by another client", sessionID),
+		},
+		SessionID: sessionID,
+	}
+}
+
+func (e *SessionInUseError) Is(target error) bool { return isCategory(target, ErrSessionInUse) }
+
+type PromptTooLargeError struct {
+	ClaudeSDKError
+	Size  int
+	Limit int
+}
+
+func NewPromptTooLargeError(size, limit int) *PromptTooLargeError {
+	return &PromptTooLargeError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("prompt is %d characters, exceeding the limit of %d", size, limit),
+		},
+		Size:  size,
+		Limit: limit,
+	}
+}
+
+func (e *PromptTooLargeError) Is(target error) bool { return isCategory(target, ErrLimit) }
+
+type BackgroundTokenLimitError struct {
+	ClaudeSDKError
+	Used  int
+	Limit int
+}
+
+func NewBackgroundTokenLimitError(used, limit int) *BackgroundTokenLimitError {
+	return &BackgroundTokenLimitError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("background tokens used (%d) exceeded MaxBackgroundTokens (%d)", used, limit),
+		},
+		Used:  used,
+		Limit: limit,
+	}
+}
+
+func (e *BackgroundTokenLimitError) Is(target error) bool { return isCategory(target, ErrLimit) }
+
+// MaxIterationsError reports an Agent run that was interrupted for making
+// more tool round-trips than its MaxIterations. Result is the result of
+// the interrupted turn.
+type MaxIterationsError struct {
+	ClaudeSDKError
+	MaxIterations int
+	Result        *ResultMessage
+}
+
+func NewMaxIterationsError(maxIterations int, result *ResultMessage) *MaxIterationsError {
+	return &MaxIterationsError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("agent exceeded MaxIterations (%d tool round-trips)", maxIterations),
+		},
+		MaxIterations: maxIterations,
+		Result:        result,
+	}
+}
+
+func (e *MaxIterationsError) Is(target error) bool { return isCategory(target, ErrLimit) }
+
+// AttachmentTooLargeError reports an attachment, such as an image, over
+// the limit set by Option: its bytes for MaxFileUploadsBytes, or its
+// pixels for MaxImagePixels.
+type AttachmentTooLargeError struct {
+	ClaudeSDKError
+	Option string
+	Size   int
+	Limit  int
+}
+
+func NewAttachmentTooLargeError(option string, size, limit int) *AttachmentTooLargeError {
+	unit := "bytes"
+	if option == "MaxImagePixels" {
+		unit = "pixels"
+	}
+	return &AttachmentTooLargeError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("attachment is %d %s, exceeding %s (%d)", size, unit, option, limit),
+		},
+		Option: option,
+		Size:   size,
+		Limit:  limit,
+	}
+}
+
+func (e *AttachmentTooLargeError) Is(target error) bool { return isCategory(target, ErrLimit) }
+
+// InterruptTimeoutError reports an interrupt the CLI did not acknowledge
+// within the timeout. Observed tells whether an interrupted system message
+// arrived while waiting, meaning the interrupt took effect and only its
+// acknowledgment was lost or late.
+type InterruptTimeoutError struct {
+	ClaudeSDKError
+	Timeout  time.Duration
+	Observed bool
+}
+
+func NewInterruptTimeoutError(timeout time.Duration, observed bool) *InterruptTimeoutError {
+	message := fmt.Sprintf("interrupt not acknowledged within %s", timeout)
+	if observed {
+		message += " (interrupted message was observed)"
+	}
+	return &InterruptTimeoutError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: message,
+		},
+		Timeout:  timeout,
+		Observed: observed,
+	}
+}
+
+func (e *InterruptTimeoutError) Is(target error) bool { return isCategory(target, ErrTimeout) }
+
+// MCPTimeoutError reports a call to an MCP server's tool that got no
+// result, and no MCP log output, within MCPToolTimeout: the server is
+// likely hung.
+type MCPTimeoutError struct {
+	ClaudeSDKError
+	Server    string
+	Tool      string
+	ToolUseID string
+	Timeout   time.Duration
+}
+
+func NewMCPTimeoutError(server, tool, toolUseID string, timeout time.Duration) *MCPTimeoutError {
+	return &MCPTimeoutError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("MCP server %q did not answer tool %q (%s) within %s", server, tool, toolUseID, timeout),
+		},
+		Server:    server,
+		Tool:      tool,
+		ToolUseID: toolUseID,
+		Timeout:   timeout,
+	}
+}
+
+func (e *MCPTimeoutError) Is(target error) bool { return isCategory(target, ErrTimeout) }
+
+// QueryTimeoutError reports a Query that did not finish within its
+// QueryTimeout. Partial holds what was collected before the deadline; its
+// Result is nil unless the result arrived but the CLI never exited.
+type QueryTimeoutError struct {
+	ClaudeSDKError
+	Timeout time.Duration
+	Partial *QueryResult
+}
+
+func NewQueryTimeoutError(timeout time.Duration, partial *QueryResult) *QueryTimeoutError {
+	return &QueryTimeoutError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("query timeout after %s", timeout),
+		},
+		Timeout: timeout,
+		Partial: partial,
+	}
+}
+
+func (e *QueryTimeoutError) Is(target error) bool { return isCategory(target, ErrTimeout) }
+
+// InterruptedError is returned instead of a result for an interrupted turn
+// when TreatInterruptAsError is set. Result is the interrupted result.
+type InterruptedError struct {
+	ClaudeSDKError
+	Result *ResultMessage
+}
+
+func NewInterruptedError(result *ResultMessage) *InterruptedError {
+	return &InterruptedError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: "turn was interrupted",
+		},
+		Result: result,
+	}
+}
+
+func (e *InterruptedError) Is(target error) bool { return isCategory(target, ErrInterrupted) }
+
+// ResultError is returned by QueryJSON for a turn the CLI ended in an
+// error instead of an answer. Result is the failed result.
+type ResultError struct {
+	ClaudeSDKError
+	Result *ResultMessage
+}
+
+func NewResultError(result *ResultMessage) *ResultError {
+	return &ResultError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: "turn ended in an error",
+		},
+		Result: result,
+	}
+}
+
+func (e *ResultError) Is(target error) bool { return isCategory(target, ErrCLI) }
+
+// AuthRequiredError reports a CLI that is not authenticated and tried to
+// log in interactively instead of answering. Stderr holds what the CLI
+// printed before it was stopped.
+type AuthRequiredError struct {
+	ClaudeSDKError
+	Stderr string
+}
+
+func NewAuthRequiredError(reason, stderr string) *AuthRequiredError {
+	return &AuthRequiredError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("Claude Code CLI requires login (%s); run 'claude login' or set ANTHROPIC_API_KEY first", reason),
+		},
+		Stderr: stderr,
+	}
+}
+
+func (e *AuthRequiredError) Is(target error) bool { return isCategory(target, ErrAuthRequired) }
+
+// OfflineLaunchError reports a launch of a real CLI blocked by OfflineOnly.
+type OfflineLaunchError struct {
+	ClaudeSDKError
+	CLIPath string
+}
+
+func NewOfflineLaunchError(cliPath string) *OfflineLaunchError {
+	return &OfflineLaunchError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("OfflineOnly is set but %s is not a registered mock CLI", cliPath),
+		},
+		CLIPath: cliPath,
+	}
+}
+
+func (e *OfflineLaunchError) Is(target error) bool { return isCategory(target, ErrOffline) }
+
+// ContextOverflowError reports a conversation that no longer fits the
+// model's context window. Compacting the conversation or switching to a
+// model with a larger window and retrying can recover. Detail is the
+// CLI's own description of the error.
+type ContextOverflowError struct {
+	ClaudeSDKError
+	Detail string
+}
+
+func NewContextOverflowError(detail string) *ContextOverflowError {
+	return &ContextOverflowError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("conversation exceeds the model's context window (%s); compact it or use a model with a larger context window", detail),
+		},
+		Detail: detail,
+	}
+}
+
+func (e *ContextOverflowError) Is(target error) bool { return isCategory(target, ErrContextOverflow) }
+
+// CLISecurityError reports a CLI binary that failed the VerifyCLIPermissions
+// checks and was not launched.
+type CLISecurityError struct {
+	ClaudeSDKError
+	Path   string
+	Reason string
+}
+
+func NewCLISecurityError(path, reason string) *CLISecurityError {
+	return &CLISecurityError{
+		ClaudeSDKError: ClaudeSDKError{
+			Message: fmt.Sprintf("refusing to launch Claude Code CLI %s: %s", path, reason),
+		},
+		Path:   path,
+		Reason: reason,
+	}
+}
+
+func (e *CLISecurityError) Is(target error) bool { return isCategory(target, ErrCLISecurity) }
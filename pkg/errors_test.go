@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestErrorCategories(t *testing.T) {
+	categories := []error{ErrCLI, ErrParse, ErrInvalidOption, ErrUnsupported, ErrLimit, ErrTimeout, ErrSessionInUse, ErrInterrupted, ErrAuthRequired, ErrOffline, ErrContextOverflow, ErrCLISecurity}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"connection", NewCLIConnectionError("failed", io.EOF), ErrCLI},
+		{"not found", NewCLINotFoundError(nil), ErrCLI},
+		{"process", NewProcessError(1, "", "boom"), ErrCLI},
+		{"json decode", NewCLIJSONDecodeError("{", io.ErrUnexpectedEOF), ErrParse},
+		{"message parse", NewMessageParseError("user", nil, io.EOF), ErrParse},
+		{"invalid option", NewInvalidOptionError("Cwd", "/missing", "directory does not exist"), ErrInvalidOption},
+		{"unsupported", NewUnsupportedError("sampling", "no flag"), ErrUnsupported},
+		{"prompt too large", NewPromptTooLargeError(20, 10), ErrLimit},
+		{"background tokens", NewBackgroundTokenLimitError(20, 10), ErrLimit},
+		{"max iterations", NewMaxIterationsError(25, nil), ErrLimit},
+		{"attachment too large", NewAttachmentTooLargeError("MaxImagePixels", 200, 100), ErrLimit},
+		{"mcp timeout", NewMCPTimeoutError("search", "query", "toolu_1", time.Second), ErrTimeout},
+		{"json output", NewJSONOutputError("not json", errors.New("invalid")), ErrParse},
+		{"interrupt timeout", NewInterruptTimeoutError(time.Second, false), ErrTimeout},
+		{"query timeout", NewQueryTimeoutError(time.Minute, nil), ErrTimeout},
+		{"session in use", NewSessionInUseError("s1"), ErrSessionInUse},
+		{"interrupted", NewInterruptedError(&ResultMessage{}), ErrInterrupted},
+		{"result error", NewResultError(&ResultMessage{}), ErrCLI},
+		{"auth required", NewAuthRequiredError("login prompt on stderr", ""), ErrAuthRequired},
+		{"offline", NewOfflineLaunchError("/usr/local/bin/claude"), ErrOffline},
+		{"context overflow", NewContextOverflowError("prompt is too long"), ErrContextOverflow},
+		{"cli security", NewCLISecurityError("/usr/local/bin/claude", "world-writable"), ErrCLISecurity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Wrapping by callers must not hide the category
+			wrapped := fmt.Errorf("context: %w", tt.err)
+
+			for _, err := range []error{tt.err, wrapped} {
+				if !errors.Is(err, ErrSDK) {
+					t.Errorf("errors.Is(%v, ErrSDK) = false, want true", err)
+				}
+				for _, category := range categories {
+					if got := errors.Is(err, category); got != (category == tt.want) {
+						t.Errorf("errors.Is(%T, %v) = %v, want %v", tt.err, category, got, category == tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestErrorCategories_Cause(t *testing.T) {
+	// Cause chains are still followed alongside the category
+	err := NewCLIConnectionError("failed to start", io.ErrClosedPipe)
+	if !errors.Is(err, io.ErrClosedPipe) {
+		t.Error("errors.Is(err, io.ErrClosedPipe) = false, want true")
+	}
+	if errors.Is(errors.New("other"), ErrSDK) {
+		t.Error("errors.Is(non-SDK error, ErrSDK) = true, want false")
+	}
+}
@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHistoryCursor_NonBlocking(t *testing.T) {
+	client := NewClient(nil)
+	cursor := client.HistoryCursor()
+
+	if msg, ok := cursor.Next(); ok {
+		t.Fatalf("Next() on empty history = %v, want false", msg)
+	}
+
+	client.record(UserMessage{Role: MessageRoleUser, Content: "one"})
+	client.record(UserMessage{Role: MessageRoleUser, Content: "two"})
+
+	for _, want := range []string{"one", "two"} {
+		msg, ok := cursor.Next()
+		if !ok {
+			t.Fatalf("Next() = false, want %q", want)
+		}
+		if got := msg.(UserMessage).Content; got != want {
+			t.Errorf("Next() = %q, want %q", got, want)
+		}
+	}
+	if _, ok := cursor.Next(); ok {
+		t.Error("Next() after catching up = true, want false")
+	}
+}
+
+func TestHistoryCursor_ConcurrentAppends(t *testing.T) {
+	const total = 200
+	client := NewClient(nil)
+
+	var wg sync.WaitGroup
+	results := make([][]string, 3)
+	for i := range results {
+		cursor := client.HistoryCursor()
+		cursor.Blocking = true
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for {
+				msg, ok := cursor.Next()
+				if !ok {
+					return
+				}
+				results[i] = append(results[i], msg.(UserMessage).Content)
+			}
+		}(i)
+	}
+
+	// A non-blocking reader polling alongside the writer
+	polled := make(chan int)
+	go func() {
+		cursor := client.HistoryCursor()
+		count := 0
+		deadline := time.Now().Add(5 * time.Second)
+		for count < total && time.Now().Before(deadline) {
+			if _, ok := cursor.Next(); ok {
+				count++
+			}
+		}
+		polled <- count
+	}()
+
+	for i := 0; i < total; i++ {
+		client.record(UserMessage{Role: MessageRoleUser, Content: fmt.Sprint(i)})
+	}
+
+	if count := <-polled; count != total {
+		t.Errorf("non-blocking cursor read %d messages, want %d", count, total)
+	}
+
+	// Closing releases the blocked cursors once they have drained
+	client.Close()
+	wg.Wait()
+
+	for i, got := range results {
+		if len(got) != total {
+			t.Fatalf("cursor %d read %d messages, want %d", i, len(got), total)
+		}
+		for j, content := range got {
+			if content != fmt.Sprint(j) {
+				t.Errorf("cursor %d message %d = %s, want %d", i, j, content, j)
+				break
+			}
+		}
+	}
+}
+
+func TestClient_HistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	client := NewClient(&ClaudeCodeOptions{HistoryFile: path})
+
+	lines := []string{
+		`{"type":"user","message":{"role":"user","content":"question %d"}}`,
+		`{"type":"assistant","message":{"id":"msg_%d","role":"assistant","content":[{"type":"text","text":"answer"},{"type":"tool_use","id":"t1","name":"Read","input":{"path":"a.go"}}]}}`,
+		`{"type":"system","message":{"role":"system","subtype":"usage","data":{"outputTokens":%d}}}`,
+		`{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":%d,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}`,
+	}
+	const total = 300
+	var want []Message
+	for i := 0; i < total; i++ {
+		msg, err := ParseLine([]byte(fmt.Sprintf(lines[i%len(lines)], i)))
+		if err != nil {
+			t.Fatalf("ParseLine() error = %v", err)
+		}
+		want = append(want, msg)
+		client.record(msg)
+	}
+
+	if n := len(client.messages); n >= 2*historyTail {
+		t.Errorf("in-memory history holds %d messages, want fewer than %d", n, 2*historyTail)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("history file not written: %v", err)
+	}
+	if spilled := strings.Count(string(data), "\n"); spilled != total-len(client.messages) {
+		t.Errorf("history file holds %d messages, want %d", spilled, total-len(client.messages))
+	}
+
+	if got := client.GetMessages(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetMessages() returned %d messages differing from the %d recorded", len(got), len(want))
+	}
+
+	cursor := client.HistoryCursor()
+	for i, wantMsg := range want {
+		msg, ok := cursor.Next()
+		if !ok {
+			t.Fatalf("Next() = false at message %d, want %d messages", i, total)
+		}
+		if !reflect.DeepEqual(msg, wantMsg) {
+			t.Fatalf("Next() message %d = %#v, want %#v", i, msg, wantMsg)
+		}
+	}
+	if _, ok := cursor.Next(); ok {
+		t.Error("Next() after the last message = true, want false")
+	}
+}
+
+func TestClient_HistoryFileTurnSummaries(t *testing.T) {
+	const turns = 100
+	setupScriptMockCLI(t, `#!/bin/sh
+read -r line
+i=0
+while [ $i -lt `+fmt.Sprint(turns)+` ]; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"answer"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"sessionId":"s1"}}}'
+    i=$((i+1))
+done
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	client := NewClient(&ClaudeCodeOptions{HistoryFile: path, EmitTurnSummary: true})
+	if err := client.Connect(ctx, "Hello"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < turns; i++ {
+		if _, err := client.WaitForResult(ctx); err != nil {
+			t.Fatalf("WaitForResult() %d error = %v", i, err)
+		}
+	}
+	if n := len(client.messages); n >= 2*historyTail {
+		t.Fatalf("in-memory history holds %d messages, want the rest spilled", n)
+	}
+
+	// Each turn's summary is recorded by the next WaitForResult, so the
+	// last one may still be unread
+	messages := client.GetMessages()
+	summaries := 0
+	for _, msg := range messages {
+		if _, ok := msg.(TurnSummaryMessage); ok {
+			summaries++
+		}
+	}
+	if len(messages) < 3*turns-1 || summaries < turns-1 {
+		t.Errorf("GetMessages() = %d messages with %d summaries, want %d with %d", len(messages), summaries, 3*turns, turns)
+	}
+
+	cursor := client.HistoryCursor()
+	for i := range messages {
+		if _, ok := cursor.Next(); !ok {
+			t.Fatalf("Next() = false at message %d, want %d messages", i, len(messages))
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// historyTail is how many recent messages a client with a HistoryFile
+// keeps in memory. Older ones are spilled once twice as many accumulate.
+const historyTail = 64
+
+// historyEntry is one line of a history file.
+type historyEntry struct {
+	Type    string          `json:"type"`
+	Message json.RawMessage `json:"message"`
+}
+
+// historyFile is the on-disk part of a client's history: the oldest
+// messages, one JSON line each, in order.
+type historyFile struct {
+	path    string
+	offsets []int64 // start of each message's line
+	size    int64
+}
+
+func newHistoryFile(path string) (*historyFile, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &historyFile{path: path}, f.Close()
+}
+
+func (h *historyFile) len() int { return len(h.offsets) }
+
+// append writes msgs to the end of the file.
+func (h *historyFile) append(msgs []Message) error {
+	var buf []byte
+	offsets := make([]int64, 0, len(msgs))
+	for _, msg := range msgs {
+		line, err := encodeHistoryEntry(msg)
+		if err != nil {
+			return err
+		}
+		offsets = append(offsets, h.size+int64(len(buf)))
+		buf = append(append(buf, line...), '\n')
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(buf); err != nil {
+		// Drop a partial write so the offsets stay valid
+		f.Truncate(h.size)
+		return err
+	}
+
+	h.offsets = append(h.offsets, offsets...)
+	h.size += int64(len(buf))
+	return nil
+}
+
+// at reads the i-th spilled message.
+func (h *historyFile) at(i int) (Message, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	end := h.size
+	if i+1 < len(h.offsets) {
+		end = h.offsets[i+1]
+	}
+	line := make([]byte, end-h.offsets[i])
+	if _, err := f.ReadAt(line, h.offsets[i]); err != nil {
+		return nil, err
+	}
+	return decodeHistoryEntry(line)
+}
+
+// all reads every spilled message.
+func (h *historyFile) all() ([]Message, error) {
+	f, err := os.Open(h.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	msgs := make([]Message, 0, len(h.offsets))
+	r := bufio.NewReader(io.LimitReader(f, h.size))
+	for range h.offsets {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeHistoryEntry(line)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func encodeHistoryEntry(msg Message) ([]byte, error) {
+	var data []byte
+	var err error
+	if system, ok := msg.(SystemMessage); ok && len(system.Raw) > 0 {
+		data = system.Raw
+	} else if data, err = json.Marshal(msg); err != nil {
+		return nil, err
+	}
+	return json.Marshal(historyEntry{Type: msg.GetType(), Message: data})
+}
+
+func decodeHistoryEntry(line []byte) (Message, error) {
+	var entry historyEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return nil, err
+	}
+
+	switch entry.Type {
+	case "user":
+		var msg UserMessage
+		err := json.Unmarshal(entry.Message, &msg)
+		return msg, err
+	case "assistant":
+		var msg AssistantMessage
+		err := json.Unmarshal(entry.Message, &msg)
+		return &msg, err
+	case "system":
+		var msg SystemMessage
+		err := json.Unmarshal(entry.Message, &msg)
+		msg.Raw = entry.Message
+		return msg, err
+	case "result":
+		var msg ResultMessage
+		err := json.Unmarshal(entry.Message, &msg)
+		return msg, err
+	case "turn_summary":
+		var msg TurnSummaryMessage
+		err := json.Unmarshal(entry.Message, &msg)
+		return msg, err
+	default:
+		return nil, fmt.Errorf("unknown history entry type: %s", entry.Type)
+	}
+}
+
+// spillHistory moves all but the newest historyTail messages to the
+// HistoryFile once the in-memory history has grown to twice that. If the
+// file can't be written the messages stay in memory. It must be called
+// with c.mu held.
+func (c *Client) spillHistory() {
+	if c.options.HistoryFile == "" || len(c.messages) < 2*historyTail {
+		return
+	}
+
+	if c.history == nil {
+		history, err := newHistoryFile(c.options.HistoryFile)
+		if err != nil {
+			return
+		}
+		c.history = history
+	}
+
+	spill := len(c.messages) - historyTail
+	if err := c.history.append(c.messages[:spill]); err != nil {
+		return
+	}
+	tail := make([]Message, historyTail, 2*historyTail)
+	copy(tail, c.messages[spill:])
+	c.messages = tail
+}
+
+// historyLen returns the number of messages in the history. It must be
+// called with c.mu held.
+func (c *Client) historyLen() int {
+	if c.history == nil {
+		return len(c.messages)
+	}
+	return c.history.len() + len(c.messages)
+}
+
+// historyAt returns the i-th message of the history, reading it back from
+// the HistoryFile if it was spilled. It must be called with c.mu held.
+func (c *Client) historyAt(i int) (Message, error) {
+	if c.history == nil {
+		return c.messages[i], nil
+	}
+	if i < c.history.len() {
+		return c.history.at(i)
+	}
+	return c.messages[i-c.history.len()], nil
+}
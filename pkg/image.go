@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageBlock is an image in a user message, such as a screenshot, sent
+// inline as base64. Build one with NewImageBlock or NewImageBlockFromFile.
+type ImageBlock struct {
+	Type   string      `json:"type"`
+	Source ImageSource `json:"source"`
+}
+
+// ImageSource is the encoded data of an ImageBlock
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+func (b ImageBlock) GetType() string { return "image" }
+
+// NewImageBlock encodes data as an image of the given media type, such as
+// "image/png". An empty mediaType is detected from the data.
+func NewImageBlock(data []byte, mediaType string) ImageBlock {
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+	}
+	return ImageBlock{
+		Type: "image",
+		Source: ImageSource{
+			Type:      "base64",
+			MediaType: mediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		},
+	}
+}
+
+// NewImageBlockFromFile reads and encodes the image at path. Its media
+// type comes from the file extension, or from the data if the extension
+// isn't an image type.
+func NewImageBlockFromFile(path string) (ImageBlock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ImageBlock{}, err
+	}
+	mediaType, _, _ := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(path)))
+	if !strings.HasPrefix(mediaType, "image/") {
+		mediaType = ""
+	}
+	return NewImageBlock(data, mediaType), nil
+}
+
+// checkAttachments applies checkImage to each image among blocks
+func (o *ClaudeCodeOptions) checkAttachments(blocks []ContentBlock) error {
+	for _, block := range blocks {
+		if image, ok := block.(ImageBlock); ok {
+			if err := o.checkImage(image); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkImage enforces MaxFileUploadsBytes and MaxImagePixels on an image
+// about to be sent. Pixels are only counted for PNG, JPEG and GIF images.
+func (o *ClaudeCodeOptions) checkImage(b ImageBlock) error {
+	if o.MaxFileUploadsBytes <= 0 && o.MaxImagePixels <= 0 {
+		return nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(b.Source.Data)
+	if err != nil {
+		return fmt.Errorf("image data is not valid base64: %w", err)
+	}
+	if o.MaxFileUploadsBytes > 0 && len(data) > o.MaxFileUploadsBytes {
+		return NewAttachmentTooLargeError("MaxFileUploadsBytes", len(data), o.MaxFileUploadsBytes)
+	}
+
+	if o.MaxImagePixels <= 0 {
+		return nil
+	}
+	var decodeConfig func(r *bytes.Reader) (image.Config, error)
+	switch b.Source.MediaType {
+	case "image/png":
+		decodeConfig = func(r *bytes.Reader) (image.Config, error) { return png.DecodeConfig(r) }
+	case "image/jpeg":
+		decodeConfig = func(r *bytes.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) }
+	case "image/gif":
+		decodeConfig = func(r *bytes.Reader) (image.Config, error) { return gif.DecodeConfig(r) }
+	default:
+		return nil
+	}
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to read %s dimensions: %w", b.Source.MediaType, err)
+	}
+	if pixels := config.Width * config.Height; pixels > o.MaxImagePixels {
+		return NewAttachmentTooLargeError("MaxImagePixels", pixels, o.MaxImagePixels)
+	}
+	return nil
+}
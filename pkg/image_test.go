@@ -0,0 +1,204 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPNG encodes a blank width x height PNG
+func testPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewImageBlock(t *testing.T) {
+	data := testPNG(t, 2, 2)
+
+	block := NewImageBlock(data, "")
+	got, err := json.Marshal(block)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	want := `{"type":"image","source":{"type":"base64","media_type":"image/png","data":"` + base64.StdEncoding.EncodeToString(data) + `"}}`
+	if string(got) != want {
+		t.Errorf("Marshal() = %s, want %s", got, want)
+	}
+
+	if got := NewImageBlock(data, "image/webp").Source.MediaType; got != "image/webp" {
+		t.Errorf("NewImageBlock() media type = %q, want the given image/webp", got)
+	}
+}
+
+func TestNewImageBlockFromFile(t *testing.T) {
+	dir := t.TempDir()
+	data := testPNG(t, 2, 2)
+
+	tests := []struct {
+		name          string
+		file          string
+		wantMediaType string
+	}{
+		{name: "extension", file: "shot.jpg", wantMediaType: "image/jpeg"},
+		{name: "detected", file: "shot.dat", wantMediaType: "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatalf("Failed to write image: %v", err)
+			}
+			block, err := NewImageBlockFromFile(path)
+			if err != nil {
+				t.Fatalf("NewImageBlockFromFile() error = %v", err)
+			}
+			if block.Source.MediaType != tt.wantMediaType {
+				t.Errorf("NewImageBlockFromFile() media type = %q, want %q", block.Source.MediaType, tt.wantMediaType)
+			}
+			if block.Source.Data != base64.StdEncoding.EncodeToString(data) {
+				t.Error("NewImageBlockFromFile() data does not match the file")
+			}
+		})
+	}
+
+	if _, err := NewImageBlockFromFile(filepath.Join(dir, "missing.png")); err == nil {
+		t.Error("NewImageBlockFromFile() of a missing file error = nil, want error")
+	}
+}
+
+func TestClaudeCodeOptions_CheckImage(t *testing.T) {
+	block := NewImageBlock(testPNG(t, 10, 10), "image/png")
+	size := len(testPNG(t, 10, 10))
+
+	tests := []struct {
+		name       string
+		options    ClaudeCodeOptions
+		block      ImageBlock
+		wantOption string
+	}{
+		{name: "no limits", options: ClaudeCodeOptions{}, block: block},
+		{name: "bytes at limit", options: ClaudeCodeOptions{MaxFileUploadsBytes: size}, block: block},
+		{name: "bytes over limit", options: ClaudeCodeOptions{MaxFileUploadsBytes: size - 1}, block: block, wantOption: "MaxFileUploadsBytes"},
+		{name: "pixels at limit", options: ClaudeCodeOptions{MaxImagePixels: 100}, block: block},
+		{name: "pixels over limit", options: ClaudeCodeOptions{MaxImagePixels: 99}, block: block, wantOption: "MaxImagePixels"},
+		{name: "unmeasured type", options: ClaudeCodeOptions{MaxImagePixels: 1}, block: NewImageBlock([]byte("RIFF"), "image/webp")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.checkImage(tt.block)
+			if tt.wantOption == "" {
+				if err != nil {
+					t.Errorf("checkImage() error = %v, want nil", err)
+				}
+				return
+			}
+			var tooLarge *AttachmentTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("checkImage() error = %v, want *AttachmentTooLargeError", err)
+			}
+			if tooLarge.Option != tt.wantOption {
+				t.Errorf("checkImage() Option = %q, want %q", tooLarge.Option, tt.wantOption)
+			}
+		})
+	}
+
+	corrupt := NewImageBlock([]byte("not a png"), "image/png")
+	if err := (&ClaudeCodeOptions{MaxImagePixels: 100}).checkImage(corrupt); err == nil {
+		t.Error("checkImage() of a corrupt PNG error = nil, want error")
+	}
+}
+
+func TestClient_SendMessageWithImages(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"content":\[{"type":"text","text":"What is this?"},{"type":"image","source":{"type":"base64","media_type":"image/png"'; then
+        text="got an image"
+    else
+        text="no image"
+    fi
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"'"$text"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{MaxImagePixels: 100})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	err := client.SendMessageWithImages(ctx, "What is this?", NewImageBlock(testPNG(t, 20, 20), ""))
+	var tooLarge *AttachmentTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("SendMessageWithImages() with a 400 pixel image error = %v, want *AttachmentTooLargeError", err)
+	}
+
+	if err := client.SendMessageWithImages(ctx, "What is this?", NewImageBlock(testPNG(t, 10, 10), "")); err != nil {
+		t.Fatalf("SendMessageWithImages() error = %v", err)
+	}
+	if _, err := client.WaitForResult(ctx); err != nil {
+		t.Fatalf("WaitForResult() error = %v", err)
+	}
+	if got := client.LastAssistantText(); got != "got an image" {
+		t.Errorf("LastAssistantText() = %q, want the CLI to receive the text and image blocks", got)
+	}
+}
+
+func TestClaudeCodeOptions_CheckAttachments(t *testing.T) {
+	small := NewImageBlock(testPNG(t, 10, 10), "image/png")
+	large := NewImageBlock(testPNG(t, 100, 100), "image/png")
+	largeSize := len(testPNG(t, 100, 100))
+
+	tests := []struct {
+		name       string
+		options    ClaudeCodeOptions
+		blocks     []ContentBlock
+		wantOption string
+	}{
+		{name: "zero limits are unlimited", options: ClaudeCodeOptions{}, blocks: []ContentBlock{large}},
+		{name: "no attachments", options: ClaudeCodeOptions{MaxFileUploadsBytes: 1, MaxImagePixels: 1}, blocks: []ContentBlock{TextBlock{Type: "text", Text: "hi"}}},
+		{name: "bytes at limit", options: ClaudeCodeOptions{MaxFileUploadsBytes: largeSize}, blocks: []ContentBlock{small, large}},
+		{name: "bytes one over", options: ClaudeCodeOptions{MaxFileUploadsBytes: largeSize - 1}, blocks: []ContentBlock{small, large}, wantOption: "MaxFileUploadsBytes"},
+		{name: "pixels at limit", options: ClaudeCodeOptions{MaxImagePixels: 10_000}, blocks: []ContentBlock{small, large}},
+		{name: "pixels one over", options: ClaudeCodeOptions{MaxImagePixels: 9_999}, blocks: []ContentBlock{small, large}, wantOption: "MaxImagePixels"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.checkAttachments(tt.blocks)
+			if tt.wantOption == "" {
+				if err != nil {
+					t.Errorf("checkAttachments() error = %v, want nil", err)
+				}
+				return
+			}
+			var tooLarge *AttachmentTooLargeError
+			if !errors.As(err, &tooLarge) {
+				t.Fatalf("checkAttachments() error = %v, want *AttachmentTooLargeError", err)
+			}
+			if tooLarge.Option != tt.wantOption {
+				t.Errorf("checkAttachments() Option = %q, want %q", tooLarge.Option, tt.wantOption)
+			}
+			if tooLarge.Size != tooLarge.Limit+1 {
+				t.Errorf("checkAttachments() Size = %d, Limit = %d, want one over", tooLarge.Size, tooLarge.Limit)
+			}
+		})
+	}
+}
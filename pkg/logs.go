@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LogFormat selects how CLI stderr lines are parsed into LogLines
+type LogFormat string
+
+const (
+	// LogFormatText parses lines like "[INFO] msg", "WARN: msg" or
+	// "level=error msg", optionally preceded by an RFC 3339 timestamp.
+	LogFormatText LogFormat = "text"
+	// LogFormatJSON parses one JSON object per line with level, message
+	// (or msg) and time (or timestamp) fields.
+	LogFormatJSON LogFormat = "json"
+	// LogFormatAuto tries JSON first and falls back to text.
+	LogFormatAuto LogFormat = "auto"
+)
+
+// LogLine is one line of CLI stderr. Parsing is best-effort: a line that
+// doesn't match the format is delivered with an empty Level and the whole
+// line as Message. Time is the time the line was read unless the line
+// carries its own timestamp.
+type LogLine struct {
+	Level   string
+	Message string
+	Time    time.Time
+	Raw     string
+}
+
+var textLogPattern = regexp.MustCompile(`(?i)^(?:(\d{4}-\d{2}-\d{2}T\S+)\s+)?(?:\[(trace|debug|info|warn|warning|error|fatal)\]|(trace|debug|info|warn|warning|error|fatal):|level=(trace|debug|info|warn|warning|error|fatal))\s*(.*)$`)
+
+func parseLogLine(line string, format LogFormat, received time.Time) LogLine {
+	logLine := LogLine{Message: line, Time: received, Raw: line}
+
+	if format == LogFormatJSON || format == LogFormatAuto {
+		if parsed, ok := parseJSONLogLine(line, received); ok {
+			return parsed
+		}
+		if format == LogFormatJSON {
+			return logLine
+		}
+	}
+
+	match := textLogPattern.FindStringSubmatch(strings.TrimSpace(line))
+	if match == nil {
+		return logLine
+	}
+	if match[1] != "" {
+		if ts, err := time.Parse(time.RFC3339Nano, match[1]); err == nil {
+			logLine.Time = ts
+		}
+	}
+	logLine.Level = normalizeLogLevel(match[2] + match[3] + match[4])
+	logLine.Message = match[5]
+	return logLine
+}
+
+func parseJSONLogLine(line string, received time.Time) (LogLine, bool) {
+	var entry struct {
+		Level     string    `json:"level"`
+		Message   string    `json:"message"`
+		Msg       string    `json:"msg"`
+		Time      time.Time `json:"time"`
+		Timestamp time.Time `json:"timestamp"`
+	}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return LogLine{}, false
+	}
+
+	logLine := LogLine{
+		Level:   normalizeLogLevel(entry.Level),
+		Message: entry.Message,
+		Time:    received,
+		Raw:     line,
+	}
+	if logLine.Message == "" {
+		logLine.Message = entry.Msg
+	}
+	if !entry.Time.IsZero() {
+		logLine.Time = entry.Time
+	} else if !entry.Timestamp.IsZero() {
+		logLine.Time = entry.Timestamp
+	}
+	return logLine, true
+}
+
+func normalizeLogLevel(level string) string {
+	level = strings.ToLower(level)
+	if level == "warning" {
+		return "warn"
+	}
+	return level
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLogLine(t *testing.T) {
+	received := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	stamped := time.Date(2025, 6, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		line        string
+		format      LogFormat
+		wantLevel   string
+		wantMessage string
+		wantTime    time.Time
+	}{
+		{"bracketed level", "[INFO] Starting session", LogFormatText, "info", "Starting session", received},
+		{"colon level", "WARNING: rate limited", LogFormatText, "warn", "rate limited", received},
+		{"key value level", "level=error connection reset", LogFormatText, "error", "connection reset", received},
+		{"timestamped", "2025-06-01T12:30:00Z [DEBUG] tick", LogFormatText, "debug", "tick", stamped},
+		{"unstructured", "something happened", LogFormatText, "", "something happened", received},
+		{"json", `{"level":"ERROR","message":"boom","time":"2025-06-01T12:30:00Z"}`, LogFormatJSON, "error", "boom", stamped},
+		{"json msg field", `{"level":"info","msg":"hello"}`, LogFormatJSON, "info", "hello", received},
+		{"json format with text line", "[INFO] not json", LogFormatJSON, "", "[INFO] not json", received},
+		{"auto json", `{"level":"warn","msg":"careful"}`, LogFormatAuto, "warn", "careful", received},
+		{"auto text", "[ERROR] failed", LogFormatAuto, "error", "failed", received},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseLogLine(tt.line, tt.format, received)
+			if got.Level != tt.wantLevel {
+				t.Errorf("Level = %q, want %q", got.Level, tt.wantLevel)
+			}
+			if got.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", got.Message, tt.wantMessage)
+			}
+			if !got.Time.Equal(tt.wantTime) {
+				t.Errorf("Time = %v, want %v", got.Time, tt.wantTime)
+			}
+			if got.Raw != tt.line {
+				t.Errorf("Raw = %q, want %q", got.Raw, tt.line)
+			}
+		})
+	}
+}
+
+func TestClient_Logs(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '[INFO] Loading configuration' >&2
+printf 'level=warn slow ' >&2
+printf 'response\n' >&2
+printf '[ERROR] partial line at exit' >&2
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{StderrLogFormat: LogFormatText})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+	logs := client.Logs()
+
+	// The partial last line is flushed when stderr closes
+	want := []LogLine{
+		{Level: "info", Message: "Loading configuration"},
+		{Level: "warn", Message: "slow response"},
+		{Level: "error", Message: "partial line at exit"},
+	}
+	for i, w := range want {
+		select {
+		case got := <-logs:
+			if got.Level != w.Level || got.Message != w.Message {
+				t.Errorf("log %d = {%s %q}, want {%s %q}", i, got.Level, got.Message, w.Level, w.Message)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timed out waiting for log %d", i)
+		}
+	}
+}
+
+func TestClient_StderrLines(t *testing.T) {
+	// The second line is only written once the client sends something, so
+	// the first must arrive while the CLI is still running
+	setupScriptMockCLI(t, `#!/bin/sh
+echo 'mcp: starting filesystem server' >&2
+read -r line
+printf 'mcp: filesystem ' >&2
+printf 'ready\n' >&2
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{StderrLines: true})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+	lines := client.StderrLines()
+
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-ctx.Done():
+			t.Fatal("Timed out waiting for a stderr line")
+			return ""
+		}
+	}
+
+	if got, want := next(), "mcp: starting filesystem server"; got != want {
+		t.Errorf("first line = %q, want %q", got, want)
+	}
+	if err := client.SendMessage(ctx, "go"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	if got, want := next(), "mcp: filesystem ready"; got != want {
+		t.Errorf("second line = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Markdown renders the message for display: text blocks as-is, tool_use
+// blocks as a heading with the tool name followed by its input as fenced
+// JSON, and tool_result blocks as blockquotes. Blocks are separated by a
+// blank line.
+func (m *AssistantMessage) Markdown() string {
+	parts := make([]string, 0, len(m.Content))
+	for _, block := range m.Content {
+		switch b := block.(type) {
+		case TextBlock:
+			parts = append(parts, b.Text)
+		case ToolUseBlock:
+			parts = append(parts, toolUseMarkdown(b))
+		case ToolResultBlock:
+			parts = append(parts, toolResultMarkdown(b))
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func toolUseMarkdown(b ToolUseBlock) string {
+	return fmt.Sprintf("**Tool use: `%s`**\n\n```json\n%s\n```", b.Name, b.InputJSON())
+}
+
+func toolResultMarkdown(b ToolResultBlock) string {
+	text := toolResultText(b.Content)
+	if b.IsError {
+		text = "**Error:** " + text
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toolResultText flattens tool_result content, which is either a string or
+// a list of content blocks, into text. Anything else is rendered as JSON.
+func toolResultText(content interface{}) string {
+	switch c := content.(type) {
+	case nil:
+		return ""
+	case string:
+		return c
+	case []interface{}:
+		var texts []string
+		for _, item := range c {
+			if block, ok := item.(map[string]interface{}); ok && block["type"] == "text" {
+				if text, ok := block["text"].(string); ok {
+					texts = append(texts, text)
+					continue
+				}
+			}
+			data, _ := json.Marshal(item)
+			texts = append(texts, string(data))
+		}
+		return strings.Join(texts, "\n")
+	default:
+		data, err := json.Marshal(c)
+		if err != nil {
+			return fmt.Sprint(c)
+		}
+		return string(data)
+	}
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import "testing"
+
+func TestAssistantMessage_Markdown(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []ContentBlock
+		want    string
+	}{
+		{
+			name:    "text only",
+			content: []ContentBlock{TextBlock{Type: "text", Text: "Hello **world**"}},
+			want:    "Hello **world**",
+		},
+		{
+			name: "mixed content",
+			content: []ContentBlock{
+				TextBlock{Type: "text", Text: "Let me check."},
+				ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Bash", Input: map[string]interface{}{"command": "ls"}},
+				ToolResultBlock{Type: "tool_result", ToolUseID: "t1", Content: "a.go\n\nb.go"},
+				TextBlock{Type: "text", Text: "Two files."},
+			},
+			want: "Let me check.\n\n" +
+				"**Tool use: `Bash`**\n\n```json\n{\n  \"command\": \"ls\"\n}\n```\n\n" +
+				"> a.go\n>\n> b.go\n\n" +
+				"Two files.",
+		},
+		{
+			name: "tool use without input",
+			content: []ContentBlock{
+				ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Clock"},
+			},
+			want: "**Tool use: `Clock`**\n\n```json\n{}\n```",
+		},
+		{
+			name: "error result with content blocks",
+			content: []ContentBlock{
+				ToolResultBlock{Type: "tool_result", ToolUseID: "t1", IsError: true, Content: []interface{}{
+					map[string]interface{}{"type": "text", "text": "permission denied"},
+				}},
+			},
+			want: "> **Error:** permission denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &AssistantMessage{Role: MessageRoleAssistant, Content: tt.content}
+			if got := msg.Markdown(); got != tt.want {
+				t.Errorf("Markdown() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
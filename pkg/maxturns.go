@@ -0,0 +1,45 @@
+package pkg
+
+// MaxTurnsReached is the data of the max_turns_reached system message sent
+// when a session's assistant turns reach MaxTurns.
+type MaxTurnsReached struct {
+	MaxTurns int `json:"maxTurns"`
+	Turns    int `json:"turns"`
+}
+
+// turnCounter counts assistant turns. Messages sharing the ID of the one
+// before, as the CLI sends for each content block of a response, are one
+// turn, and streamed text deltas are not counted.
+type turnCounter struct {
+	turns  int
+	lastID string
+}
+
+// observe counts msg, reporting whether it started a turn.
+func (tc *turnCounter) observe(msg Message) bool {
+	assistant, ok := msg.(*AssistantMessage)
+	if !ok || assistant.isDelta() {
+		return false
+	}
+	if assistant.ID != "" && assistant.ID == tc.lastID {
+		return false
+	}
+	tc.lastID = assistant.ID
+	tc.turns++
+	return true
+}
+
+// checkMaxTurns counts msg and, when it is the turn that reaches MaxTurns,
+// returns the max_turns_reached notice to deliver after it. The CLI still
+// enforces the limit itself; the notice lets UIs react as soon as the last
+// turn starts. It is only called from the read loop.
+func (t *transport) checkMaxTurns(msg Message) (SystemMessage, bool) {
+	if !t.turns.observe(msg) {
+		return SystemMessage{}, false
+	}
+	limit := t.options.MaxTurns
+	if limit <= 0 || t.turns.turns != limit {
+		return SystemMessage{}, false
+	}
+	return sdkNotice(SystemMessageSubtypeMaxTurnsReached, MaxTurnsReached{MaxTurns: limit, Turns: t.turns.turns}), true
+}
@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mcpToolPrefix starts the names the CLI gives MCP tools:
+// mcp__<server>__<tool>
+const mcpToolPrefix = "mcp__"
+
+// minMCPWatchInterval bounds how often the watchdog checks for stuck calls
+const minMCPWatchInterval = 10 * time.Millisecond
+
+// splitMCPToolName returns the server and tool of an MCP tool name, or
+// false for a built-in tool.
+func splitMCPToolName(name string) (server, tool string, ok bool) {
+	rest, found := strings.CutPrefix(name, mcpToolPrefix)
+	if !found {
+		return "", "", false
+	}
+	server, tool, found = strings.Cut(rest, "__")
+	if !found || server == "" {
+		return "", "", false
+	}
+	return server, tool, true
+}
+
+// mcpWatchdog tracks MCP tool calls awaiting their results. A call is
+// stuck once neither its result nor any MCP stderr output has arrived for
+// the timeout, which each new MCP log line restarts.
+type mcpWatchdog struct {
+	timeout time.Duration
+	clock   Clock
+
+	mu           sync.Mutex
+	pending      map[string]pendingMCPCall
+	lastActivity time.Time
+}
+
+type pendingMCPCall struct {
+	server string
+	tool   string
+	since  time.Time
+}
+
+func newMCPWatchdog(timeout time.Duration, clock Clock) *mcpWatchdog {
+	return &mcpWatchdog{
+		timeout: timeout,
+		clock:   clock,
+		pending: make(map[string]pendingMCPCall),
+	}
+}
+
+// observe starts tracking the MCP tool calls of msg and stops tracking
+// those it answers.
+func (w *mcpWatchdog) observe(msg Message) {
+	var blocks []ContentBlock
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		blocks = m.Content
+	case UserMessage:
+		// The CLI echoes tool results back as user messages
+		blocks = m.Blocks
+	default:
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case ToolUseBlock:
+			if server, tool, ok := splitMCPToolName(b.Name); ok {
+				w.pending[b.ID] = pendingMCPCall{server: server, tool: tool, since: w.clock.Now()}
+			}
+		case ToolResultBlock:
+			delete(w.pending, b.ToolUseID)
+		}
+	}
+}
+
+// logged notes stderr output, which restarts the timeout if it mentions MCP
+func (w *mcpWatchdog) logged(output []byte) {
+	if !bytes.Contains(bytes.ToLower(output), []byte("mcp")) {
+		return
+	}
+	w.mu.Lock()
+	w.lastActivity = w.clock.Now()
+	w.mu.Unlock()
+}
+
+// expired stops tracking the calls stuck for the timeout and returns an
+// error for each, oldest first.
+func (w *mcpWatchdog) expired() []*MCPTimeoutError {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.clock.Now()
+	var ids []string
+	for id, call := range w.pending {
+		last := call.since
+		if w.lastActivity.After(last) {
+			last = w.lastActivity
+		}
+		if now.Sub(last) >= w.timeout {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return w.pending[ids[i]].since.Before(w.pending[ids[j]].since)
+	})
+
+	stuck := make([]*MCPTimeoutError, 0, len(ids))
+	for _, id := range ids {
+		call := w.pending[id]
+		delete(w.pending, id)
+		stuck = append(stuck, NewMCPTimeoutError(call.server, call.tool, id, w.timeout))
+	}
+	return stuck
+}
+
+// watchMCPTools reports stuck MCP tool calls on the errors channel until
+// stdout ends or the transport closes.
+func (t *transport) watchMCPTools() {
+	defer t.readers.Done()
+
+	interval := t.mcpWatch.timeout / 4
+	if interval < minMCPWatchInterval {
+		interval = minMCPWatchInterval
+	}
+
+	for {
+		timer := t.options.clock().NewTimer(interval)
+		select {
+		case <-timer.C():
+		case <-t.stdoutDone:
+			// No more results can arrive, so the calls can't be answered
+			timer.Stop()
+			return
+		case <-t.done:
+			timer.Stop()
+			return
+		}
+
+		for _, err := range t.mcpWatch.expired() {
+			select {
+			case t.errors <- err:
+			case <-t.done:
+				return
+			}
+		}
+	}
+}
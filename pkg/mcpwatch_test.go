@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSplitMCPToolName(t *testing.T) {
+	tests := []struct {
+		name       string
+		wantServer string
+		wantTool   string
+		wantOK     bool
+	}{
+		{name: "mcp__search__query", wantServer: "search", wantTool: "query", wantOK: true},
+		{name: "mcp__github__create_issue", wantServer: "github", wantTool: "create_issue", wantOK: true},
+		{name: "Bash"},
+		{name: "mcp__search"},
+		{name: "mcp____query"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, tool, ok := splitMCPToolName(tt.name)
+			if server != tt.wantServer || tool != tt.wantTool || ok != tt.wantOK {
+				t.Errorf("splitMCPToolName(%q) = %q, %q, %v, want %q, %q, %v",
+					tt.name, server, tool, ok, tt.wantServer, tt.wantTool, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMCPWatchdog(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1_700_000_000, 0))
+	w := newMCPWatchdog(10*time.Second, clock)
+
+	w.observe(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "toolu_1", Name: "mcp__search__query"},
+		ToolUseBlock{Type: "tool_use", ID: "toolu_bash", Name: "Bash"},
+	}})
+	clock.Advance(5 * time.Second)
+	w.observe(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "toolu_2", Name: "mcp__db__select"},
+		ToolUseBlock{Type: "tool_use", ID: "toolu_3", Name: "mcp__db__insert"},
+	}})
+	w.observe(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_3", Content: "ok"},
+	}})
+
+	clock.Advance(4 * time.Second)
+	if stuck := w.expired(); len(stuck) != 0 {
+		t.Fatalf("expired() after 9s = %v, want none", stuck)
+	}
+
+	// Unrelated stderr doesn't count as activity
+	w.logged([]byte("warming cache\n"))
+	clock.Advance(time.Second)
+	stuck := w.expired()
+	if len(stuck) != 1 || stuck[0].Server != "search" || stuck[0].Tool != "query" || stuck[0].ToolUseID != "toolu_1" {
+		t.Fatalf("expired() after 10s = %v, want toolu_1 on search", stuck)
+	}
+
+	// MCP log output restarts the wait for the remaining call
+	clock.Advance(4 * time.Second)
+	w.logged([]byte("[MCP db] still connecting\n"))
+	clock.Advance(9 * time.Second)
+	if stuck := w.expired(); len(stuck) != 0 {
+		t.Fatalf("expired() 9s after MCP output = %v, want none", stuck)
+	}
+	clock.Advance(time.Second)
+	stuck = w.expired()
+	if len(stuck) != 1 || stuck[0].ToolUseID != "toolu_2" {
+		t.Fatalf("expired() 10s after MCP output = %v, want toolu_2", stuck)
+	}
+
+	// Each call is reported once
+	clock.Advance(time.Minute)
+	if stuck := w.expired(); len(stuck) != 0 {
+		t.Errorf("expired() after reporting = %v, want none", stuck)
+	}
+}
+
+func TestClient_MCPToolTimeout(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+read line
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"mcp__search__query","input":{"q":"go"}}]}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{MCPToolTimeout: 100 * time.Millisecond})
+	if err := client.Connect(ctx, "Search for go"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	_, err := client.WaitForResult(ctx)
+	var timeoutErr *MCPTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("WaitForResult() error = %v, want *MCPTimeoutError", err)
+	}
+	if timeoutErr.Server != "search" || timeoutErr.Tool != "query" {
+		t.Errorf("MCPTimeoutError = %q/%q, want search/query", timeoutErr.Server, timeoutErr.Tool)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Error("MCPTimeoutError should match ErrTimeout")
+	}
+}
+
+func TestClient_MCPToolResultInUserMessage(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+read line
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"mcp__search__query","input":{"q":"go"}}]}}'
+echo '{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"3 hits"}]}}'
+sleep 0.3
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{MCPToolTimeout: 100 * time.Millisecond})
+	if err := client.Connect(ctx, "Search for go"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.WaitForResult(ctx); err != nil {
+		t.Errorf("WaitForResult() error = %v, want nil once the result is echoed", err)
+	}
+}
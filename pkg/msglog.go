@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// MessageLogEntry is the envelope written to ClaudeCodeOptions.MessageLogWriter
+// for every parsed message, one JSON object per line.
+type MessageLogEntry struct {
+	Seq       int64     `json:"seq"`
+	Timestamp time.Time `json:"timestamp"`
+	// LatencyMs is the time since the previous message, or since launch
+	// for the first one.
+	LatencyMs float64 `json:"latencyMs"`
+	// ElapsedMs is the time since the CLI was launched.
+	ElapsedMs float64 `json:"elapsedMs"`
+	Type      string  `json:"type"`
+	Message   Message `json:"message"`
+}
+
+type messageLogger struct {
+	mu      sync.Mutex
+	w       io.Writer
+	clock   Clock
+	redact  func(string) string
+	seq     int64
+	started time.Time
+	last    time.Time
+}
+
+func newMessageLogger(w io.Writer, clock Clock, redact func(string) string, started time.Time) *messageLogger {
+	return &messageLogger{
+		w:       w,
+		clock:   clock,
+		redact:  redact,
+		started: started,
+		last:    started,
+	}
+}
+
+func (l *messageLogger) log(msg Message) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.redact != nil {
+		msg = redactMessage(msg, l.redact)
+	}
+
+	now := l.clock.Now()
+	l.seq++
+	entry := MessageLogEntry{
+		Seq:       l.seq,
+		Timestamp: now,
+		LatencyMs: float64(now.Sub(l.last)) / float64(time.Millisecond),
+		ElapsedMs: float64(now.Sub(l.started)) / float64(time.Millisecond),
+		Type:      msg.GetType(),
+		Message:   msg,
+	}
+	l.last = now
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// Logging must never disrupt the stream, so write errors are dropped
+	l.w.Write(append(data, '\n'))
+}
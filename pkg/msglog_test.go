@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestMessageLogWriter(t *testing.T) {
+	setupQueryMockCLI(t, "simple")
+
+	var buf bytes.Buffer
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{MessageLogWriter: &buf})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid log line %q: %v", scanner.Text(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) != len(result.Messages) {
+		t.Fatalf("log entries = %d, want %d", len(entries), len(result.Messages))
+	}
+
+	wantTypes := []string{"assistant", "result"}
+	for i, entry := range entries {
+		if seq := entry["seq"].(float64); seq != float64(i+1) {
+			t.Errorf("entry %d seq = %v, want %d", i, seq, i+1)
+		}
+		if entry["type"] != wantTypes[i] {
+			t.Errorf("entry %d type = %v, want %v", i, entry["type"], wantTypes[i])
+		}
+		for _, key := range []string{"timestamp", "latencyMs", "elapsedMs", "message"} {
+			if _, ok := entry[key]; !ok {
+				t.Errorf("entry %d missing %q", i, key)
+			}
+		}
+	}
+
+	message := entries[0]["message"].(map[string]interface{})
+	content := message["content"].([]interface{})
+	if text := content[0].(map[string]interface{})["text"]; text != "Response to query" {
+		t.Errorf("logged assistant text = %v, want 'Response to query'", text)
+	}
+}
+
+func TestMessageLogWriter_Redactor(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Contact alice@example.com"},{"type":"tool_use","id":"t1","name":"send_mail","input":{"to":"alice@example.com"}}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"redact-session"}}}'
+`)
+
+	email := regexp.MustCompile(`[\w.]+@[\w.]+`)
+	var buf bytes.Buffer
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{
+		MessageLogWriter: &buf,
+		Redactor: func(s string) string {
+			return email.ReplaceAllString(s, "[email]")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	logged := buf.String()
+	if strings.Contains(logged, "alice@example.com") {
+		t.Errorf("log contains the unredacted email: %s", logged)
+	}
+	if strings.Count(logged, "[email]") != 2 {
+		t.Errorf("log = %s, want the email masked in text and tool input", logged)
+	}
+
+	// The application still sees the original content
+	if result.Stdout != "Contact alice@example.com" {
+		t.Errorf("Query() stdout = %q, want the unredacted text", result.Stdout)
+	}
+	assistant := result.Messages[0].(*AssistantMessage)
+	if to := assistant.Content[1].(ToolUseBlock).Input["to"]; to != "alice@example.com" {
+		t.Errorf("tool input = %v, want the unredacted email", to)
+	}
+}
+
+func TestRedactBlocks(t *testing.T) {
+	mask := func(s string) string { return strings.ReplaceAll(s, "secret", "[x]") }
+
+	got := redactBlocks([]ContentBlock{
+		TextBlock{Type: "text", Text: "a secret"},
+		TextDeltaBlock{Type: "text_delta", Delta: "secret delta"},
+		ThinkingBlock{Type: "thinking", Thinking: "the secret is", Signature: "sig"},
+		ToolResultBlock{Type: "tool_result", ToolUseID: "t1", Content: "secret output"},
+		unknownBlock{},
+	}, mask)
+
+	want := []ContentBlock{
+		TextBlock{Type: "text", Text: "a [x]"},
+		TextDeltaBlock{Type: "text_delta", Delta: "[x] delta"},
+		ThinkingBlock{Type: "thinking", Thinking: "the [x] is", Signature: "sig"},
+		ToolResultBlock{Type: "tool_result", ToolUseID: "t1", Content: "[x] output"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("redactBlocks() = %#v, want %#v", got, want)
+	}
+}
+
+// unknownBlock is a content block redactBlocks has no case for
+type unknownBlock struct{}
+
+func (unknownBlock) GetType() string { return "unknown" }
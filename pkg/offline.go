@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+var mockCLIs = struct {
+	sync.Mutex
+	paths map[string]int
+}{paths: make(map[string]int)}
+
+// RegisterMockCLI marks the executable at path as a mock CLI that may be
+// launched when OfflineOnly is set. It returns a function that undoes the
+// registration. MockCLI.Install registers its executables automatically.
+func RegisterMockCLI(path string) (unregister func()) {
+	path = cleanCLIPath(path)
+
+	mockCLIs.Lock()
+	mockCLIs.paths[path]++
+	mockCLIs.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mockCLIs.Lock()
+			defer mockCLIs.Unlock()
+			if mockCLIs.paths[path]--; mockCLIs.paths[path] <= 0 {
+				delete(mockCLIs.paths, path)
+			}
+		})
+	}
+}
+
+func isMockCLI(path string) bool {
+	mockCLIs.Lock()
+	defer mockCLIs.Unlock()
+	return mockCLIs.paths[cleanCLIPath(path)] > 0
+}
+
+// cleanCLIPath normalizes path so the same executable registered and looked
+// up through different spellings still matches.
+func cleanCLIPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path
+}
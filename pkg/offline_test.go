@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestOfflineOnly(t *testing.T) {
+	t.Run("unregistered CLI is blocked", func(t *testing.T) {
+		// Stands in for a real CLI found on PATH
+		dir := setupScriptMockCLI(t, "#!/bin/sh\ntouch \"$(dirname \"$0\")/launched\"\n")
+
+		_, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{OfflineOnly: true})
+
+		var offlineErr *OfflineLaunchError
+		if !errors.As(err, &offlineErr) {
+			t.Fatalf("Query() error = %v, want *OfflineLaunchError", err)
+		}
+		if !errors.Is(err, ErrOffline) {
+			t.Errorf("errors.Is(%v, ErrOffline) = false, want true", err)
+		}
+		if offlineErr.CLIPath != filepath.Join(dir, "claude") {
+			t.Errorf("OfflineLaunchError.CLIPath = %s, want %s", offlineErr.CLIPath, filepath.Join(dir, "claude"))
+		}
+		if matches, _ := filepath.Glob(filepath.Join(dir, "launched")); len(matches) != 0 {
+			t.Error("CLI was launched despite OfflineOnly")
+		}
+	})
+
+	t.Run("ValidateConfig does not run an unregistered CLI", func(t *testing.T) {
+		dir := setupScriptMockCLI(t, "#!/bin/sh\ntouch \"$(dirname \"$0\")/launched\"\necho 1.0.43\n")
+
+		issues := ValidateConfig(context.Background(), &ClaudeCodeOptions{OfflineOnly: true})
+		if len(issues) != 1 || issues[0].Severity != ConfigIssueError {
+			t.Errorf("ValidateConfig() = %v, want one offline launch error", issues)
+		}
+		if matches, _ := filepath.Glob(filepath.Join(dir, "launched")); len(matches) != 0 {
+			t.Error("CLI was run for its version despite OfflineOnly")
+		}
+	})
+
+	t.Run("installed mock is allowed", func(t *testing.T) {
+		CreateMockCLI(t, []interface{}{
+			CreateResultMessage("offline", 1, 1, 0.001),
+		})
+
+		if _, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{OfflineOnly: true}); err != nil {
+			t.Errorf("Query() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("registered mock is allowed", func(t *testing.T) {
+		dir := setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+`)
+		unregister := RegisterMockCLI(filepath.Join(dir, "claude"))
+
+		if _, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{OfflineOnly: true}); err != nil {
+			t.Errorf("Query() error = %v, want nil", err)
+		}
+
+		unregister()
+		if _, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{OfflineOnly: true}); !errors.Is(err, ErrOffline) {
+			t.Errorf("Query() after unregister error = %v, want ErrOffline", err)
+		}
+	})
+}
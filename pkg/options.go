@@ -0,0 +1,193 @@
+package pkg
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// logger returns the configured Logger, defaulting to slog.Default().
+func (o *ClaudeCodeOptions) logger() *slog.Logger {
+	if o == nil || o.Logger == nil {
+		return slog.Default()
+	}
+	return o.Logger
+}
+
+// promoteDeprecated returns the options with deprecated fields moved to
+// their replacements, logging a notice for each one set. The replacement
+// wins when both are set. The options are copied rather than changed, and
+// returned as is when no deprecated field is set.
+func (o *ClaudeCodeOptions) promoteDeprecated() *ClaudeCodeOptions {
+	if o.Mode == "" && len(o.OnlyTools) == 0 {
+		return o
+	}
+
+	if o.Mode != "" {
+		o.logger().Warn("ClaudeCodeOptions.Mode is deprecated, use PermissionMode",
+			"mode", o.Mode, "overridden", o.PermissionMode != "")
+	}
+	if len(o.OnlyTools) > 0 {
+		o.logger().Warn("ClaudeCodeOptions.OnlyTools is deprecated, use AllowedTools",
+			"tools", o.OnlyTools, "overridden", len(o.AllowedTools) > 0)
+	}
+
+	promoted := *o
+	promoted.normalizeDeprecated()
+	return &promoted
+}
+
+// Validate checks the options for values and combinations the CLI would
+// reject or silently misread, returning an *InvalidOptionError describing
+// the first problem found. Connect and Query call it before launching the
+// CLI.
+func (o *ClaudeCodeOptions) Validate() error {
+	if o.Cwd != "" {
+		info, err := os.Stat(o.Cwd)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return NewInvalidOptionError("Cwd", o.Cwd, "directory does not exist")
+			}
+			return NewInvalidOptionError("Cwd", o.Cwd, err.Error())
+		}
+		if !info.IsDir() {
+			return NewInvalidOptionError("Cwd", o.Cwd, "not a directory")
+		}
+	}
+
+	if o.TempDir != "" {
+		if err := checkTempDir(o.TempDir); err != nil {
+			return err
+		}
+	}
+
+	if o.Nice < -20 || o.Nice > 19 {
+		return NewInvalidOptionError("Nice", strconv.Itoa(o.Nice), "must be between -20 and 19")
+	}
+
+	// Both pick the session to continue, and the CLI doesn't say which wins
+	if o.ContinueConversation && o.Resume != "" {
+		return NewInvalidOptionError("Resume", o.Resume, "cannot be combined with ContinueConversation")
+	}
+
+	if o.MaxTokens < 0 {
+		return NewInvalidOptionError("MaxTokens", strconv.Itoa(o.MaxTokens), "must not be negative")
+	}
+	if o.Temperature < 0 || o.Temperature > 1 {
+		return NewInvalidOptionError("Temperature", strconv.FormatFloat(o.Temperature, 'f', -1, 64), "must be between 0 and 1")
+	}
+
+	if o.BaseURL != "" {
+		u, err := url.Parse(o.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return NewInvalidOptionError("BaseURL", o.BaseURL, "not an http(s) URL")
+		}
+	}
+	if o.ApiKeyName != "" && os.Getenv(o.ApiKeyName) == "" {
+		return NewInvalidOptionError("ApiKeyName", o.ApiKeyName, "environment variable is not set")
+	}
+
+	if err := o.validateToolLists(); err != nil {
+		return err
+	}
+	if err := o.validateMCPServers(); err != nil {
+		return err
+	}
+
+	if o.MaxCostUSD < 0 {
+		return NewInvalidOptionError("MaxCostUSD", strconv.FormatFloat(o.MaxCostUSD, 'f', -1, 64), "must not be negative")
+	}
+
+	if o.MaxStartRetries < 0 {
+		return NewInvalidOptionError("MaxStartRetries", strconv.Itoa(o.MaxStartRetries), "must not be negative")
+	}
+	if o.StartRetryBackoff < 0 {
+		return NewInvalidOptionError("StartRetryBackoff", o.StartRetryBackoff.String(), "must not be negative")
+	}
+	if o.ShutdownGrace < 0 {
+		return NewInvalidOptionError("ShutdownGrace", o.ShutdownGrace.String(), "must not be negative")
+	}
+	if o.MCPToolTimeout < 0 {
+		return NewInvalidOptionError("MCPToolTimeout", o.MCPToolTimeout.String(), "must not be negative")
+	}
+
+	if o.MaxMCPServers > 0 {
+		if n := o.stdioMCPServerCount(); n > o.MaxMCPServers {
+			return NewInvalidOptionError("McpServers", fmt.Sprintf("%d stdio servers", n),
+				fmt.Sprintf("exceeds MaxMCPServers limit of %d", o.MaxMCPServers))
+		}
+	}
+
+	return nil
+}
+
+// validateToolLists rejects a tool that is both allowed and disallowed.
+func (o *ClaudeCodeOptions) validateToolLists() error {
+	allowed := make(map[string]bool, len(o.AllowedTools))
+	for _, tool := range o.AllowedTools {
+		allowed[tool] = true
+	}
+	for _, tool := range o.DisallowedTools {
+		if allowed[tool] {
+			return NewInvalidOptionError("DisallowedTools", tool, "also listed in AllowedTools")
+		}
+	}
+	return nil
+}
+
+// validateMCPServers checks each MCP server has the fields its type needs,
+// in name order so the error is stable. Types the SDK doesn't know are
+// left to the CLI; ValidateConfig warns about them.
+func (o *ClaudeCodeOptions) validateMCPServers() error {
+	names := make([]string, 0, len(o.McpServers))
+	for name := range o.McpServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		server := o.McpServers[name]
+		switch server.Type {
+		case "", MCPServerTypeStdio:
+			if server.Command == "" {
+				return NewInvalidOptionError("McpServers", name, "stdio server needs a Command")
+			}
+		case MCPServerTypeSSE, MCPServerTypeHTTP:
+			if server.URL == "" {
+				return NewInvalidOptionError("McpServers", name, fmt.Sprintf("%s server needs a URL", server.Type))
+			}
+			u, err := url.Parse(server.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return NewInvalidOptionError("McpServers", name, fmt.Sprintf("URL %q is not an http(s) URL", server.URL))
+			}
+		}
+	}
+	return nil
+}
+
+// stdioMCPServerCount counts the configured MCP servers the CLI will spawn
+// as child processes. Servers without a type are stdio servers.
+func (o *ClaudeCodeOptions) stdioMCPServerCount() int {
+	count := 0
+	for _, server := range o.McpServers {
+		if server.Type == MCPServerTypeStdio || server.Type == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// checkPrompt enforces MaxPromptChars on a prompt about to be sent.
+func (o *ClaudeCodeOptions) checkPrompt(prompt string) error {
+	if o.MaxPromptChars <= 0 {
+		return nil
+	}
+	if size := utf8.RuneCountInString(prompt); size > o.MaxPromptChars {
+		return NewPromptTooLargeError(size, o.MaxPromptChars)
+	}
+	return nil
+}
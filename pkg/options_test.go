@@ -0,0 +1,360 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaudeCodeOptions_ValidateCwd(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cwd     string
+		wantErr string
+	}{
+		{name: "unset", cwd: ""},
+		{name: "existing directory", cwd: tmpDir},
+		{name: "missing directory", cwd: filepath.Join(tmpDir, "missing"), wantErr: "does not exist"},
+		{name: "regular file", cwd: file, wantErr: "not a directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&ClaudeCodeOptions{Cwd: tt.cwd}).Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var optErr *InvalidOptionError
+			if !errors.As(err, &optErr) {
+				t.Fatalf("Validate() error = %v, want *InvalidOptionError", err)
+			}
+			if optErr.Option != "Cwd" || optErr.Value != tt.cwd {
+				t.Errorf("InvalidOptionError = {%s %s}, want {Cwd %s}", optErr.Option, optErr.Value, tt.cwd)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) || !strings.Contains(err.Error(), tt.cwd) {
+				t.Errorf("error = %q, want it to name %q and mention %q", err, tt.cwd, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQuery_BogusCwd(t *testing.T) {
+	setupQueryMockCLI(t, "simple")
+
+	bogus := filepath.Join(t.TempDir(), "does", "not", "exist")
+	_, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{Cwd: bogus})
+
+	var optErr *InvalidOptionError
+	if !errors.As(err, &optErr) {
+		t.Fatalf("Query() error = %v, want *InvalidOptionError", err)
+	}
+	if !strings.Contains(err.Error(), bogus) {
+		t.Errorf("error = %q, want it to name %q", err, bogus)
+	}
+}
+
+func TestClaudeCodeOptions_ValidateMaxMCPServers(t *testing.T) {
+	servers := map[string]MCPServerConfig{
+		"files":  {Type: MCPServerTypeStdio, Command: "files-server"},
+		"git":    {Type: MCPServerTypeStdio, Command: "git-server"},
+		"legacy": {Command: "legacy-server"},
+		"remote": {Type: MCPServerTypeSSE, URL: "https://example.com/sse"},
+	}
+
+	tests := []struct {
+		name    string
+		max     int
+		wantErr bool
+	}{
+		{name: "no limit", max: 0},
+		{name: "within limit", max: 3},
+		{name: "exceeds limit", max: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&ClaudeCodeOptions{McpServers: servers, MaxMCPServers: tt.max}).Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var optErr *InvalidOptionError
+			if !errors.As(err, &optErr) {
+				t.Fatalf("Validate() error = %v, want *InvalidOptionError", err)
+			}
+			if optErr.Option != "McpServers" {
+				t.Errorf("InvalidOptionError.Option = %s, want McpServers", optErr.Option)
+			}
+			if !strings.Contains(err.Error(), "3 stdio servers") || !strings.Contains(err.Error(), "limit of 2") {
+				t.Errorf("error = %q, want it to mention the count and the limit", err)
+			}
+		})
+	}
+}
+
+func TestMaxPromptChars(t *testing.T) {
+	setupMockCLI(t)
+	ctx := context.Background()
+
+	options := &ClaudeCodeOptions{MaxPromptChars: 10}
+	oversized := strings.Repeat("é", 11)
+
+	assertTooLarge := func(name string, err error) {
+		t.Helper()
+		var tooLarge *PromptTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("%s error = %v, want *PromptTooLargeError", name, err)
+		}
+		if tooLarge.Size != 11 || tooLarge.Limit != 10 {
+			t.Errorf("%s PromptTooLargeError = {Size %d, Limit %d}, want {11, 10}", name, tooLarge.Size, tooLarge.Limit)
+		}
+	}
+
+	_, err := Query(ctx, oversized, options)
+	assertTooLarge("Query()", err)
+
+	client := NewClient(options)
+	assertTooLarge("Connect()", client.Connect(ctx, oversized))
+
+	if err := client.Connect(ctx, "short"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	assertTooLarge("SendMessage()", client.SendMessage(ctx, oversized))
+	if err := client.SendMessage(ctx, strings.Repeat("é", 10)); err != nil {
+		t.Errorf("SendMessage() at the limit error = %v", err)
+	}
+}
+
+func TestClaudeCodeOptions_ValidateStartRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    ClaudeCodeOptions
+		wantOption string
+	}{
+		{name: "unset", options: ClaudeCodeOptions{}},
+		{name: "retries with backoff", options: ClaudeCodeOptions{MaxStartRetries: 3, StartRetryBackoff: time.Second}},
+		{name: "negative retries", options: ClaudeCodeOptions{MaxStartRetries: -1}, wantOption: "MaxStartRetries"},
+		{name: "negative backoff", options: ClaudeCodeOptions{StartRetryBackoff: -time.Second}, wantOption: "StartRetryBackoff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantOption == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var optErr *InvalidOptionError
+			if !errors.As(err, &optErr) {
+				t.Fatalf("Validate() error = %v, want *InvalidOptionError", err)
+			}
+			if optErr.Option != tt.wantOption {
+				t.Errorf("InvalidOptionError.Option = %s, want %s", optErr.Option, tt.wantOption)
+			}
+		})
+	}
+}
+
+func TestClaudeCodeOptions_ValidateContinueResume(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ClaudeCodeOptions
+		wantErr bool
+	}{
+		{name: "neither", options: ClaudeCodeOptions{}},
+		{name: "continue", options: ClaudeCodeOptions{ContinueConversation: true}},
+		{name: "resume", options: ClaudeCodeOptions{Resume: "session-1"}},
+		{name: "both", options: ClaudeCodeOptions{ContinueConversation: true, Resume: "session-1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var optErr *InvalidOptionError
+			if !errors.As(err, &optErr) {
+				t.Fatalf("Validate() error = %v, want *InvalidOptionError", err)
+			}
+			if optErr.Option != "Resume" {
+				t.Errorf("InvalidOptionError.Option = %s, want Resume", optErr.Option)
+			}
+			if !strings.Contains(err.Error(), "ContinueConversation") {
+				t.Errorf("error = %q, want it to name ContinueConversation", err)
+			}
+		})
+	}
+}
+
+func TestClaudeCodeOptions_Validate(t *testing.T) {
+	t.Setenv("GO_CLAUDE_TEST_KEY", "sk-test")
+	t.Setenv("GO_CLAUDE_EMPTY_KEY", "")
+
+	tests := []struct {
+		name       string
+		options    ClaudeCodeOptions
+		wantOption string
+		wantValue  string
+	}{
+		{name: "zero value", options: ClaudeCodeOptions{}},
+		{name: "disjoint tool lists", options: ClaudeCodeOptions{AllowedTools: []string{"Read"}, DisallowedTools: []string{"Bash"}}},
+		{name: "conflicting tool lists", options: ClaudeCodeOptions{AllowedTools: []string{"Read", "Bash"}, DisallowedTools: []string{"Bash"}}, wantOption: "DisallowedTools", wantValue: "Bash"},
+		{name: "negative max tokens", options: ClaudeCodeOptions{MaxTokens: -1}, wantOption: "MaxTokens", wantValue: "-1"},
+		{name: "temperature in range", options: ClaudeCodeOptions{Temperature: 1}},
+		{name: "temperature too high", options: ClaudeCodeOptions{Temperature: 1.5}, wantOption: "Temperature", wantValue: "1.5"},
+		{name: "negative temperature", options: ClaudeCodeOptions{Temperature: -0.1}, wantOption: "Temperature", wantValue: "-0.1"},
+		{name: "base URL", options: ClaudeCodeOptions{BaseURL: "https://gateway.example.com/anthropic"}},
+		{name: "base URL without scheme", options: ClaudeCodeOptions{BaseURL: "gateway.example.com"}, wantOption: "BaseURL", wantValue: "gateway.example.com"},
+		{name: "base URL with other scheme", options: ClaudeCodeOptions{BaseURL: "ftp://gateway.example.com"}, wantOption: "BaseURL", wantValue: "ftp://gateway.example.com"},
+		{name: "API key variable set", options: ClaudeCodeOptions{ApiKeyName: "GO_CLAUDE_TEST_KEY"}},
+		{name: "API key variable empty", options: ClaudeCodeOptions{ApiKeyName: "GO_CLAUDE_EMPTY_KEY"}, wantOption: "ApiKeyName", wantValue: "GO_CLAUDE_EMPTY_KEY"},
+		{
+			name: "complete MCP servers",
+			options: ClaudeCodeOptions{McpServers: map[string]MCPServerConfig{
+				"fs":     {Command: "mcp-fs"},
+				"search": {Type: MCPServerTypeHTTP, URL: "https://mcp.example.com/search"},
+				"events": {Type: MCPServerTypeSSE, URL: "http://localhost:8080/sse"},
+				"future": {Type: "websocket"},
+			}},
+		},
+		{
+			name:       "stdio server without command",
+			options:    ClaudeCodeOptions{McpServers: map[string]MCPServerConfig{"fs": {Type: MCPServerTypeStdio}}},
+			wantOption: "McpServers", wantValue: "fs",
+		},
+		{
+			name:       "http server without URL",
+			options:    ClaudeCodeOptions{McpServers: map[string]MCPServerConfig{"search": {Type: MCPServerTypeHTTP}}},
+			wantOption: "McpServers", wantValue: "search",
+		},
+		{
+			name:       "sse server with bad URL",
+			options:    ClaudeCodeOptions{McpServers: map[string]MCPServerConfig{"events": {Type: MCPServerTypeSSE, URL: "localhost:8080"}}},
+			wantOption: "McpServers", wantValue: "events",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantOption == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var optErr *InvalidOptionError
+			if !errors.As(err, &optErr) {
+				t.Fatalf("Validate() error = %v, want *InvalidOptionError", err)
+			}
+			if optErr.Option != tt.wantOption || optErr.Value != tt.wantValue {
+				t.Errorf("InvalidOptionError = {%s %s}, want {%s %s}", optErr.Option, optErr.Value, tt.wantOption, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestClient_ConnectValidatesOptions(t *testing.T) {
+	// No mock CLI: invalid options must fail before the CLI is looked up
+	client := NewClient(&ClaudeCodeOptions{Temperature: 2})
+	err := client.Connect(context.Background(), "")
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Fatalf("Connect() error = %v, want ErrInvalidOption", err)
+	}
+}
+
+func TestClaudeCodeOptions_PromoteDeprecated(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   ClaudeCodeOptions
+		wantMode  PermissionMode
+		wantTools []string
+		wantLogs  []string
+	}{
+		{name: "unset", options: ClaudeCodeOptions{}},
+		{
+			name:     "mode",
+			options:  ClaudeCodeOptions{Mode: PermissionModeAcceptEdits},
+			wantMode: PermissionModeAcceptEdits,
+			wantLogs: []string{"Mode is deprecated"},
+		},
+		{
+			name:      "only tools",
+			options:   ClaudeCodeOptions{OnlyTools: []string{"Read"}},
+			wantTools: []string{"Read"},
+			wantLogs:  []string{"OnlyTools is deprecated"},
+		},
+		{
+			name: "replacement wins",
+			options: ClaudeCodeOptions{
+				Mode: PermissionModeAcceptEdits, PermissionMode: PermissionModeDefault,
+				OnlyTools: []string{"Read"}, AllowedTools: []string{"Bash"},
+			},
+			wantMode:  PermissionModeDefault,
+			wantTools: []string{"Bash"},
+			wantLogs:  []string{"Mode is deprecated", "OnlyTools is deprecated", "overridden=true"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			tt.options.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+			original := tt.options
+
+			got := tt.options.promoteDeprecated()
+			if got.PermissionMode != tt.wantMode {
+				t.Errorf("PermissionMode = %q, want %q", got.PermissionMode, tt.wantMode)
+			}
+			if !reflect.DeepEqual(got.AllowedTools, tt.wantTools) {
+				t.Errorf("AllowedTools = %v, want %v", got.AllowedTools, tt.wantTools)
+			}
+			if got.Mode != "" || got.OnlyTools != nil {
+				t.Errorf("deprecated fields = %q, %v, want them cleared", got.Mode, got.OnlyTools)
+			}
+			if tt.options.Mode != original.Mode || !reflect.DeepEqual(tt.options.OnlyTools, original.OnlyTools) {
+				t.Error("promoteDeprecated() changed the caller's options")
+			}
+
+			if len(tt.wantLogs) == 0 && logs.Len() > 0 {
+				t.Errorf("logged %q, want nothing", logs.String())
+			}
+			for _, want := range tt.wantLogs {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("logged %q, want it to contain %q", logs.String(), want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadOptions reads options from a JSON or YAML file, chosen by the .json,
+// .yaml or .yml extension. Fields use the same names as the options' JSON
+// encoding, and deprecated fields are promoted to their replacements.
+func LoadOptions(path string) (*ClaudeCodeOptions, error) {
+	yamlFile, err := isYAMLPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, NewInvalidOptionError("path", path, err.Error())
+	}
+
+	if yamlFile {
+		// Go through JSON so MCPServerConfig's custom decoding applies
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, NewInvalidOptionError("path", path, err.Error())
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, NewInvalidOptionError("path", path, err.Error())
+		}
+	}
+
+	options := &ClaudeCodeOptions{}
+	if err := json.Unmarshal(data, options); err != nil {
+		return nil, NewInvalidOptionError("path", path, err.Error())
+	}
+	options.normalizeDeprecated()
+	return options, nil
+}
+
+// SaveOptions writes options to a JSON or YAML file, chosen by the .json,
+// .yaml or .yml extension, in the format LoadOptions reads. Callbacks and
+// other fields without a serialized form are not saved. A new file is
+// readable only by its owner.
+func SaveOptions(path string, o *ClaudeCodeOptions) error {
+	yamlFile, err := isYAMLPath(path)
+	if err != nil {
+		return err
+	}
+	if o == nil {
+		o = &ClaudeCodeOptions{}
+	}
+
+	data, err := json.MarshalIndent(o, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode options: %w", err)
+	}
+
+	if yamlFile {
+		// JSON is valid YAML; decoding it into a node keeps the field order
+		var doc yaml.Node
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to encode options: %w", err)
+		}
+		clearNodeStyle(&doc)
+		if data, err = yaml.Marshal(&doc); err != nil {
+			return fmt.Errorf("failed to encode options: %w", err)
+		}
+	} else {
+		data = append(data, '\n')
+	}
+
+	// Env, MCP headers and API keys are often secrets
+	return os.WriteFile(path, data, 0600)
+}
+
+// isYAMLPath reports whether path names a YAML file, or fails for
+// extensions that are neither YAML nor JSON.
+func isYAMLPath(path string) (bool, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true, nil
+	case ".json":
+		return false, nil
+	default:
+		return false, NewInvalidOptionError("path", path, "extension must be .json, .yaml or .yml")
+	}
+}
+
+// clearNodeStyle switches a node decoded from JSON to block style with
+// plain scalars, which yaml.v3 quotes again where needed.
+func clearNodeStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearNodeStyle(child)
+	}
+}
+
+// normalizeDeprecated moves deprecated fields to their replacements. The
+// replacement wins when both are set.
+func (o *ClaudeCodeOptions) normalizeDeprecated() {
+	if o.PermissionMode == "" {
+		o.PermissionMode = o.Mode
+	}
+	o.Mode = ""
+
+	if len(o.AllowedTools) == 0 {
+		o.AllowedTools = o.OnlyTools
+	}
+	o.OnlyTools = nil
+}
@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveLoadOptions_RoundTrip(t *testing.T) {
+	options := &ClaudeCodeOptions{
+		Model:          "claude-opus",
+		SystemPrompt:   "Be brief: answer in one line",
+		AllowedTools:   []string{"Read", "Bash"},
+		PermissionMode: PermissionModeAcceptEdits,
+		MaxTurns:       5,
+		QueryTimeout:   2 * time.Minute,
+		McpServers: map[string]MCPServerConfig{
+			"files":  {Type: MCPServerTypeStdio, Command: "files-server", Args: []string{"--root", "/tmp"}, Env: map[string]string{"DEBUG": "1"}},
+			"remote": {Type: MCPServerTypeHTTP, URL: "https://example.com/mcp", Headers: map[string]string{"X-Key": "k"}},
+			"events": {Type: MCPServerTypeSSE, URL: "https://example.com/sse", APIKey: "secret"},
+			"legacy": {Command: "legacy-server", Args: []string{"serve"}},
+		},
+	}
+
+	for _, name := range []string{"options.json", "options.yaml", "options.yml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := SaveOptions(path, options); err != nil {
+				t.Fatalf("SaveOptions() error = %v", err)
+			}
+			if info, err := os.Stat(path); err == nil && runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+				t.Errorf("SaveOptions() file mode = %v, want 0600", info.Mode().Perm())
+			}
+
+			loaded, err := LoadOptions(path)
+			if err != nil {
+				t.Fatalf("LoadOptions() error = %v", err)
+			}
+			if !reflect.DeepEqual(loaded, options) {
+				t.Errorf("LoadOptions() = %+v, want %+v", loaded, options)
+			}
+		})
+	}
+}
+
+func TestLoadOptions_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.yaml")
+	config := `model: claude-opus
+mode: acceptEdits
+onlyTools: [Read]
+mcpServers:
+  files:
+    type: stdio
+    command: files-server
+    args: ["--root", "/tmp"]
+  legacy:
+    command: legacy-server
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	options, err := LoadOptions(path)
+	if err != nil {
+		t.Fatalf("LoadOptions() error = %v", err)
+	}
+
+	want := &ClaudeCodeOptions{
+		Model:          "claude-opus",
+		PermissionMode: PermissionModeAcceptEdits,
+		AllowedTools:   []string{"Read"},
+		McpServers: map[string]MCPServerConfig{
+			"files":  {Type: MCPServerTypeStdio, Command: "files-server", Args: []string{"--root", "/tmp"}},
+			"legacy": {Command: "legacy-server"},
+		},
+	}
+	if !reflect.DeepEqual(options, want) {
+		t.Errorf("LoadOptions() = %+v, want %+v", options, want)
+	}
+}
+
+func TestClaudeCodeOptions_NormalizeDeprecated(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   ClaudeCodeOptions
+		wantMode  PermissionMode
+		wantTools []string
+	}{
+		{name: "unset", options: ClaudeCodeOptions{}},
+		{
+			name:      "deprecated only",
+			options:   ClaudeCodeOptions{Mode: PermissionModeAcceptEdits, OnlyTools: []string{"Read"}},
+			wantMode:  PermissionModeAcceptEdits,
+			wantTools: []string{"Read"},
+		},
+		{
+			name: "replacement wins",
+			options: ClaudeCodeOptions{
+				Mode: PermissionModeAcceptEdits, PermissionMode: PermissionModeDefault,
+				OnlyTools: []string{"Read"}, AllowedTools: []string{"Bash"},
+			},
+			wantMode:  PermissionModeDefault,
+			wantTools: []string{"Bash"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.normalizeDeprecated()
+			if tt.options.PermissionMode != tt.wantMode {
+				t.Errorf("PermissionMode = %q, want %q", tt.options.PermissionMode, tt.wantMode)
+			}
+			if !reflect.DeepEqual(tt.options.AllowedTools, tt.wantTools) {
+				t.Errorf("AllowedTools = %v, want %v", tt.options.AllowedTools, tt.wantTools)
+			}
+			if tt.options.Mode != "" || tt.options.OnlyTools != nil {
+				t.Errorf("deprecated fields = %q, %v, want them cleared", tt.options.Mode, tt.options.OnlyTools)
+			}
+		})
+	}
+}
+
+func TestSaveOptions_UnknownExtension(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.toml")
+	err := SaveOptions(path, &ClaudeCodeOptions{})
+
+	var optErr *InvalidOptionError
+	if !errors.As(err, &optErr) || !strings.Contains(err.Error(), ".toml") {
+		t.Errorf("SaveOptions() error = %v, want *InvalidOptionError naming the path", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("SaveOptions() wrote %s despite the unknown extension", path)
+	}
+}
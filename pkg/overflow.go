@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// contextOverflowPatterns are lowercase fragments of the errors the API
+// and CLI report for a conversation that no longer fits the model's
+// context window.
+var contextOverflowPatterns = []string{
+	"prompt is too long",
+	"input is too long",
+	"context_length_exceeded",
+	"exceeds the context window",
+	"exceed context limit",
+	"maximum context length",
+	"context window exceeded",
+}
+
+// detectContextOverflow returns the line of text reporting a context
+// window overflow, or false if there is none.
+func detectContextOverflow(text string) (string, bool) {
+	for _, line := range strings.Split(text, "\n") {
+		lower := strings.ToLower(line)
+		for _, pattern := range contextOverflowPatterns {
+			if strings.Contains(lower, pattern) {
+				return strings.TrimSpace(line), true
+			}
+		}
+	}
+	return "", false
+}
+
+// contextOverflowError returns a ContextOverflowError for a model_error
+// system message reporting a context window overflow, or nil for any
+// other message.
+func contextOverflowError(msg SystemMessage) *ContextOverflowError {
+	if msg.Subtype != SystemMessageSubtypeModelError {
+		return nil
+	}
+
+	var payload struct {
+		Data struct {
+			Message string `json:"message"`
+			Error   string `json:"error"`
+		} `json:"data"`
+	}
+	json.Unmarshal(msg.Raw, &payload)
+
+	for _, text := range []string{payload.Data.Message, payload.Data.Error, string(msg.Raw)} {
+		if detail, ok := detectContextOverflow(text); ok {
+			return NewContextOverflowError(detail)
+		}
+	}
+	return nil
+}
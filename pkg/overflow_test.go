@@ -0,0 +1,87 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDetectContextOverflow(t *testing.T) {
+	tests := []struct {
+		name       string
+		text       string
+		wantDetail string
+		want       bool
+	}{
+		{name: "empty", text: "", want: false},
+		{name: "other model error", text: "overloaded_error: Overloaded", want: false},
+		{name: "rate limit", text: "rate_limit_error: too many requests", want: false},
+		{
+			name:       "prompt too long",
+			text:       "retrying\nAPI Error: 400 Prompt is too long: 213000 tokens > 200000 maximum\n",
+			wantDetail: "API Error: 400 Prompt is too long: 213000 tokens > 200000 maximum",
+			want:       true,
+		},
+		{
+			name:       "error code",
+			text:       `{"code":"context_length_exceeded"}`,
+			wantDetail: `{"code":"context_length_exceeded"}`,
+			want:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			detail, ok := detectContextOverflow(tt.text)
+			if ok != tt.want || detail != tt.wantDetail {
+				t.Errorf("detectContextOverflow(%q) = %q, %v, want %q, %v", tt.text, detail, ok, tt.wantDetail, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_ContextOverflowModelError(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"system","message":{"role":"system","subtype":"model_error","data":{"type":"invalid_request_error","message":"prompt is too long: 213000 tokens > 200000 maximum"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+	if err := client.SendMessage(ctx, "Hello"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+
+	_, err := client.WaitForResult(ctx)
+	var overflowErr *ContextOverflowError
+	if !errors.As(err, &overflowErr) {
+		t.Fatalf("WaitForResult() error = %v, want *ContextOverflowError", err)
+	}
+	if overflowErr.Detail != "prompt is too long: 213000 tokens > 200000 maximum" {
+		t.Errorf("ContextOverflowError.Detail = %q, want the model error's message", overflowErr.Detail)
+	}
+}
+
+func TestQuery_ContextOverflowStderr(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo "API Error: 400 input is too long for the requested model" >&2
+exit 1
+`)
+
+	_, err := Query(context.Background(), "Hello", nil)
+	if !errors.Is(err, ErrContextOverflow) {
+		t.Fatalf("Query() error = %v, want ErrContextOverflow", err)
+	}
+	var procErr *ProcessError
+	if errors.As(err, &procErr) {
+		t.Errorf("Query() error = %T, want it distinct from a generic *ProcessError", err)
+	}
+}
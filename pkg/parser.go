@@ -1,16 +1,50 @@
 package pkg
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 )
 
-type messageParser struct{}
+type messageParser struct {
+	// toolResultInterceptor, if set, rewrites every tool_result block of
+	// an assistant or user message as it is parsed
+	toolResultInterceptor func(ToolResultBlock) ToolResultBlock
+}
 
 func newMessageParser() *messageParser {
 	return &messageParser{}
 }
 
+// ParseLine parses a single line of the CLI's stream-json output into a
+// Message using the same rules as the SDK's own read loop. Blank lines,
+// empty messages and control responses yield a nil Message and nil error;
+// use IsControlResponse to detect the latter.
+func ParseLine(line []byte) (Message, error) {
+	return newMessageParser().parseLine(line)
+}
+
+// IsControlResponse reports whether line is a control_response emitted by
+// the CLI in reply to a control request such as an interrupt.
+func IsControlResponse(line []byte) bool {
+	return newMessageParser().isControlResponse(line)
+}
+
+func (p *messageParser) parseLine(line []byte) (Message, error) {
+	if len(bytes.TrimSpace(line)) == 0 || p.isControlResponse(line) {
+		return nil, nil
+	}
+
+	streamMsg, err := p.parseStreamMessage(line)
+	if err != nil {
+		return nil, err
+	}
+	if streamMsg.Type == "stream_event" && len(streamMsg.Event) > 0 {
+		return p.parseMessage(streamMsg.Type, streamMsg.Event)
+	}
+	return p.parseMessage(streamMsg.Type, streamMsg.Message)
+}
+
 func (p *messageParser) parseStreamMessage(data []byte) (*StreamMessage, error) {
 	var msg StreamMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
@@ -29,7 +63,7 @@ func (p *messageParser) parseControlResponse(data []byte) (*ControlResponse, err
 
 func (p *messageParser) parseMessage(msgType string, data json.RawMessage) (Message, error) {
 	// Skip empty or null messages gracefully
-	if len(data) == 0 || string(data) == "null" || string(data) == "{}" {
+	if isEmptyMessage(data) {
 		return nil, nil
 	}
 
@@ -39,6 +73,13 @@ func (p *messageParser) parseMessage(msgType string, data json.RawMessage) (Mess
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return nil, NewMessageParseError(msgType, string(data), err)
 		}
+		if p.toolResultInterceptor != nil {
+			for i, block := range msg.Blocks {
+				if result, ok := block.(ToolResultBlock); ok {
+					msg.Blocks[i] = p.toolResultInterceptor(result)
+				}
+			}
+		}
 		return msg, nil
 
 	case "assistant":
@@ -46,6 +87,13 @@ func (p *messageParser) parseMessage(msgType string, data json.RawMessage) (Mess
 		if err := json.Unmarshal(data, &msg); err != nil {
 			return nil, NewMessageParseError(msgType, string(data), err)
 		}
+		if p.toolResultInterceptor != nil {
+			for i, block := range msg.Content {
+				if result, ok := block.(ToolResultBlock); ok {
+					msg.Content[i] = p.toolResultInterceptor(result)
+				}
+			}
+		}
 		return &msg, nil
 
 	case "system":
@@ -56,6 +104,12 @@ func (p *messageParser) parseMessage(msgType string, data json.RawMessage) (Mess
 			return nil, NewMessageParseError(msgType, string(data), err)
 		}
 
+		// Without a subtype there is nothing to act on, so a degenerate
+		// system message is skipped like an empty one
+		if base.Subtype == "" {
+			return nil, nil
+		}
+
 		if base.Subtype == "result" {
 			var msg ResultMessage
 			if err := json.Unmarshal(data, &msg); err != nil {
@@ -66,16 +120,68 @@ func (p *messageParser) parseMessage(msgType string, data json.RawMessage) (Mess
 
 		var msg SystemMessage
 		if err := json.Unmarshal(data, &msg); err != nil {
-			return nil, NewMessageParseError(msgType, string(data), err)
+			// Don't lose a message we can't fully decode; the raw payload
+			// is still useful for subtypes the SDK doesn't model.
+			msg = SystemMessage{
+				Role:    MessageRoleSystem,
+				Subtype: SystemMessageSubtype(base.Subtype),
+			}
 		}
+		msg.Raw = data
 		return msg, nil
 
+	case "stream_event":
+		return p.parseStreamEvent(data)
+
 	default:
 		return nil, NewMessageParseError(msgType, string(data), 
 			fmt.Errorf("unknown message type: %s", msgType))
 	}
 }
 
+// parseStreamEvent turns a text delta streamed for a partial message into
+// an assistant message holding a TextDeltaBlock. Other streaming events
+// carry nothing the complete messages don't, so they are skipped.
+func (p *messageParser) parseStreamEvent(data json.RawMessage) (Message, error) {
+	var event struct {
+		Type  string `json:"type"`
+		Index int    `json:"index"`
+		Delta struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"delta"`
+	}
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, NewMessageParseError("stream_event", string(data), err)
+	}
+	if event.Type != "content_block_delta" || event.Delta.Type != "text_delta" {
+		return nil, nil
+	}
+
+	return &AssistantMessage{
+		Role: MessageRoleAssistant,
+		Content: []ContentBlock{TextDeltaBlock{
+			Type:  "text_delta",
+			Index: event.Index,
+			Delta: event.Delta.Text,
+		}},
+	}, nil
+}
+
+// isEmptyMessage reports whether a message body is missing, null or an
+// object without fields, in any spacing.
+func isEmptyMessage(data json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || string(trimmed) == "null" {
+		return true
+	}
+	if trimmed[0] != '{' {
+		return false
+	}
+	var fields map[string]json.RawMessage
+	return json.Unmarshal(trimmed, &fields) == nil && len(fields) == 0
+}
+
 func (p *messageParser) isControlResponse(data []byte) bool {
 	var check struct {
 		Type string `json:"type"`
@@ -84,4 +190,52 @@ func (p *messageParser) isControlResponse(data []byte) bool {
 		return false
 	}
 	return check.Type == "control_response"
-}
\ No newline at end of file
+}
+
+// initField returns the named field of an init system message, which the
+// CLI sends at the start of a session, or "" for other messages. The field
+// may sit at the top level or under data.
+func initField(msg Message, name string) string {
+	system, ok := msg.(SystemMessage)
+	if !ok || system.Subtype != SystemMessageSubtypeInit {
+		return ""
+	}
+
+	var payload struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	var top map[string]json.RawMessage
+	if json.Unmarshal(system.Raw, &payload) != nil || json.Unmarshal(system.Raw, &top) != nil {
+		return ""
+	}
+	for _, fields := range []map[string]json.RawMessage{payload.Data, top} {
+		var value string
+		if json.Unmarshal(fields[name], &value) == nil && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// messageSessionID returns the session ID carried by an init system
+// message or a result, or "" for other messages.
+func messageSessionID(msg Message) string {
+	if result, ok := msg.(ResultMessage); ok {
+		return result.Data.SessionID
+	}
+	if id := initField(msg, "session_id"); id != "" {
+		return id
+	}
+	return initField(msg, "sessionId")
+}
+
+// initModel returns the model reported by an init system message.
+func initModel(msg Message) string {
+	return initField(msg, "model")
+}
+
+// initCwd returns the working directory reported by an init system message,
+// as the CLI resolved it.
+func initCwd(msg Message) string {
+	return initField(msg, "cwd")
+}
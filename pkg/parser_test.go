@@ -0,0 +1,224 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		wantType string
+		wantNil  bool
+		wantErr  bool
+	}{
+		{
+			name:     "user message",
+			line:     `{"type":"user","message":{"role":"user","content":"hi"}}`,
+			wantType: "user",
+		},
+		{
+			name:     "assistant message",
+			line:     `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hello"}]}}`,
+			wantType: "assistant",
+		},
+		{
+			name:     "system message",
+			line:     `{"type":"system","message":{"role":"system","subtype":"usage","data":{"tokens":1}}}`,
+			wantType: "system",
+		},
+		{
+			name:     "result message",
+			line:     `{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"abc"}}}`,
+			wantType: "result",
+		},
+		{
+			name:    "control response",
+			line:    `{"type":"control_response","request_id":"req_1","response":{"success":true}}`,
+			wantNil: true,
+		},
+		{
+			name:    "blank line",
+			line:    "   ",
+			wantNil: true,
+		},
+		{
+			name:    "empty message",
+			line:    `{"type":"assistant","message":{}}`,
+			wantNil: true,
+		},
+		{
+			name:    "empty message with spacing",
+			line:    `{"type":"user","message":{ }}`,
+			wantNil: true,
+		},
+		{
+			name:    "empty system message",
+			line:    `{"type":"system","message":{}}`,
+			wantNil: true,
+		},
+		{
+			name:    "system message without subtype",
+			line:    `{"type":"system","message":{"role":"system","data":{"tokens":1}}}`,
+			wantNil: true,
+		},
+		{
+			name:    "malformed json",
+			line:    `{"type":"assistant","message":`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			line:    `{"type":"bogus","message":{"role":"user"}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseLine([]byte(tt.line))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr || tt.wantNil {
+				if msg != nil {
+					t.Errorf("ParseLine() = %+v, want nil", msg)
+				}
+				return
+			}
+			if msg == nil {
+				t.Fatal("ParseLine() returned nil message")
+			}
+			if got := msg.GetType(); got != tt.wantType {
+				t.Errorf("GetType() = %v, want %v", got, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestParseLine_ErrorTypes(t *testing.T) {
+	_, err := ParseLine([]byte(`not json`))
+	var decodeErr *CLIJSONDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("ParseLine() error = %T, want *CLIJSONDecodeError", err)
+	}
+
+	_, err = ParseLine([]byte(`{"type":"assistant","message":{"content":"not a list"}}`))
+	var parseErr *MessageParseError
+	if !errors.As(err, &parseErr) {
+		t.Errorf("ParseLine() error = %T, want *MessageParseError", err)
+	}
+}
+
+func TestIsControlResponse(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want bool
+	}{
+		{"control response", `{"type":"control_response","request_id":"req_1","response":{"success":true}}`, true},
+		{"assistant message", `{"type":"assistant","message":{"role":"assistant","content":[]}}`, false},
+		{"malformed", `{"type":`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsControlResponse([]byte(tt.line)); got != tt.want {
+				t.Errorf("IsControlResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLine_SystemMessageRaw(t *testing.T) {
+	tests := []struct {
+		name        string
+		line        string
+		wantSubtype SystemMessageSubtype
+		wantRaw     string
+	}{
+		{
+			name:        "unmodeled subtype",
+			line:        `{"type":"system","message":{"role":"system","subtype":"compaction_started","data":{"reason":"auto","tokens":12345}}}`,
+			wantSubtype: "compaction_started",
+			wantRaw:     `{"role":"system","subtype":"compaction_started","data":{"reason":"auto","tokens":12345}}`,
+		},
+		{
+			name:        "partially undecodable",
+			line:        `{"type":"system","message":{"role":7,"subtype":"new_thing","data":{"x":1}}}`,
+			wantSubtype: "new_thing",
+			wantRaw:     `{"role":7,"subtype":"new_thing","data":{"x":1}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := ParseLine([]byte(tt.line))
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+
+			sys, ok := msg.(SystemMessage)
+			if !ok {
+				t.Fatalf("ParseLine() = %T, want SystemMessage", msg)
+			}
+			if sys.Subtype != tt.wantSubtype {
+				t.Errorf("Subtype = %v, want %v", sys.Subtype, tt.wantSubtype)
+			}
+			if string(sys.Raw) != tt.wantRaw {
+				t.Errorf("Raw = %s, want %s", sys.Raw, tt.wantRaw)
+			}
+
+			var payload map[string]interface{}
+			if err := json.Unmarshal(sys.Raw, &payload); err != nil {
+				t.Errorf("Raw is not valid JSON: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseLine_TextDeltas(t *testing.T) {
+	lines := []string{
+		`{"type":"stream_event","event":{"type":"message_start","message":{"id":"msg_1"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hel"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"lo"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\""}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":2,"delta":{"type":"text_delta","text":"World"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_stop","index":0}}`,
+		`{"type":"stream_event","event":{"type":"message_stop"}}`,
+	}
+
+	texts := make(map[int]string)
+	deltas := 0
+	for _, line := range lines {
+		msg, err := ParseLine([]byte(line))
+		if err != nil {
+			t.Fatalf("ParseLine(%s) error = %v", line, err)
+		}
+		if msg == nil {
+			continue
+		}
+
+		assistant, ok := msg.(*AssistantMessage)
+		if !ok || len(assistant.Content) != 1 {
+			t.Fatalf("ParseLine(%s) = %#v, want an assistant message with one block", line, msg)
+		}
+		delta, ok := assistant.Content[0].(TextDeltaBlock)
+		if !ok {
+			t.Fatalf("ParseLine(%s) block = %T, want TextDeltaBlock", line, assistant.Content[0])
+		}
+		texts[delta.Index] += delta.Delta
+		deltas++
+	}
+
+	if deltas != 3 {
+		t.Errorf("parsed %d text deltas, want 3", deltas)
+	}
+	want := map[int]string{0: "Hello", 2: "World"}
+	if len(texts) != len(want) || texts[0] != want[0] || texts[2] != want[2] {
+		t.Errorf("accumulated deltas = %v, want %v", texts, want)
+	}
+}
@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout bounds CheckClientAlive's wait for a control response
+const healthCheckTimeout = 5 * time.Second
+
+// ClientPool is a fixed set of clients sharing the same options, handed out
+// round-robin. Clients are connected by WaitReady.
+type ClientPool struct {
+	// HealthCheck decides whether a connected client is ready. Nil uses
+	// CheckClientAlive.
+	HealthCheck func(ctx context.Context, client *Client) error
+
+	clients []*Client
+	mu      sync.Mutex
+	next    int
+}
+
+// NewClientPool creates a pool of size unconnected clients.
+func NewClientPool(size int, options *ClaudeCodeOptions) *ClientPool {
+	clients := make([]*Client, size)
+	for i := range clients {
+		clients[i] = NewClient(options)
+	}
+	return &ClientPool{clients: clients}
+}
+
+// Clients returns the pooled clients.
+func (p *ClientPool) Clients() []*Client {
+	return append([]*Client(nil), p.clients...)
+}
+
+// Get returns the next client in round-robin order, or nil for an empty
+// pool.
+func (p *ClientPool) Get() *Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.clients) == 0 {
+		return nil
+	}
+	client := p.clients[p.next%len(p.clients)]
+	p.next++
+	return client
+}
+
+// WaitReady connects every client not yet connected and blocks until all of
+// them pass the health check, so a server can refuse to start on a broken
+// CLI environment. Clients are checked in parallel; the returned error
+// joins the failure of every client that is not ready.
+func (p *ClientPool) WaitReady(ctx context.Context) error {
+	check := p.HealthCheck
+	if check == nil {
+		check = CheckClientAlive
+	}
+
+	errs := make([]error, len(p.clients))
+	var wg sync.WaitGroup
+	for i, client := range p.clients {
+		wg.Add(1)
+		go func(i int, client *Client) {
+			defer wg.Done()
+
+			client.mu.Lock()
+			connected := client.connected
+			client.mu.Unlock()
+
+			if !connected {
+				if err := client.Connect(ctx, ""); err != nil {
+					errs[i] = fmt.Errorf("pool client %d: %w", i, err)
+					return
+				}
+			}
+			if err := check(ctx, client); err != nil {
+				errs[i] = fmt.Errorf("pool client %d: %w", i, err)
+			}
+		}(i, client)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// Close closes every pooled client.
+func (p *ClientPool) Close() error {
+	var errs []error
+	for _, client := range p.clients {
+		if err := client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckClientAlive is the default pool health check: the client must be
+// connected, its CLI must not have closed stdout, and the CLI must answer a
+// control request within healthCheckTimeout. A started process alone may
+// still be stuck before reading stdin, e.g. on a login prompt.
+func CheckClientAlive(ctx context.Context, client *Client) error {
+	client.mu.Lock()
+	connected, transport := client.connected, client.transport
+	client.mu.Unlock()
+
+	if !connected || transport == nil {
+		return fmt.Errorf("client is not connected")
+	}
+
+	select {
+	case <-transport.stdoutDone:
+		return NewCLIConnectionError("Claude Code CLI exited", nil)
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	// Any response will do, a refusal included; only silence is unhealthy
+	if _, err := transport.sendControlRequest(ctx, ControlRequestTypeInitialize, "", healthCheckTimeout); err != nil {
+		if errors.Is(err, errControlTimeout) {
+			return NewCLIConnectionError(fmt.Sprintf("Claude Code CLI did not answer a control request within %s", healthCheckTimeout), nil)
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// controlMockScript is a CLI that answers every control request and
+// ignores everything else
+const controlMockScript = `#!/bin/sh
+while IFS= read -r line; do
+    id=$(echo "$line" | sed -n 's/.*"request_id":"\([^"]*\)".*/\1/p')
+    if [ -n "$id" ]; then
+        echo '{"type":"control_response","request_id":"'"$id"'","response":{"success":true}}'
+    fi
+done
+`
+
+func TestClientPool_WaitReady(t *testing.T) {
+	setupScriptMockCLI(t, controlMockScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := NewClientPool(3, nil)
+	defer pool.Close()
+
+	var healthy atomic.Int32
+	pool.HealthCheck = func(ctx context.Context, client *Client) error {
+		// Slow checks must still be waited for
+		time.Sleep(50 * time.Millisecond)
+		if err := CheckClientAlive(ctx, client); err != nil {
+			return err
+		}
+		healthy.Add(1)
+		return nil
+	}
+
+	if err := pool.WaitReady(ctx); err != nil {
+		t.Fatalf("WaitReady() error = %v", err)
+	}
+	if got := healthy.Load(); got != 3 {
+		t.Errorf("WaitReady() returned after %d healthy clients, want 3", got)
+	}
+	for i, client := range pool.Clients() {
+		if err := CheckClientAlive(ctx, client); err != nil {
+			t.Errorf("client %d CheckClientAlive() error = %v", i, err)
+		}
+	}
+
+	first, second := pool.Get(), pool.Get()
+	if first == second || pool.Get() == pool.Get() {
+		t.Error("Get() did not rotate through the pooled clients")
+	}
+}
+
+func TestClientPool_WaitReadyConnectFailure(t *testing.T) {
+	setupScriptMockCLI(t, controlMockScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := NewClientPool(3, nil)
+	defer pool.Close()
+
+	// A closed client can never connect
+	pool.Clients()[1].Close()
+
+	err := pool.WaitReady(ctx)
+	if err == nil {
+		t.Fatal("WaitReady() error = nil, want error")
+	}
+	if !strings.Contains(err.Error(), "pool client 1") {
+		t.Errorf("WaitReady() error = %q, want it to name pool client 1", err)
+	}
+}
+
+func TestCheckClientAlive_Unresponsive(t *testing.T) {
+	// Reads stdin but never answers, like a CLI stuck before its loop
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	checkCtx, checkCancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer checkCancel()
+	if err := CheckClientAlive(checkCtx, client); err == nil {
+		t.Error("CheckClientAlive() error = nil, want error for a CLI that never answers")
+	}
+}
@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"strings"
+	"sync"
+)
+
+// ModelPricing is the list price of a model in USD per million tokens
+type ModelPricing struct {
+	InputPer1M      float64
+	OutputPer1M     float64
+	CacheWritePer1M float64
+	CacheReadPer1M  float64
+}
+
+var (
+	opus45Pricing  = ModelPricing{InputPer1M: 5, OutputPer1M: 25, CacheWritePer1M: 6.25, CacheReadPer1M: 0.50}
+	opus4Pricing   = ModelPricing{InputPer1M: 15, OutputPer1M: 75, CacheWritePer1M: 18.75, CacheReadPer1M: 1.50}
+	sonnetPricing  = ModelPricing{InputPer1M: 3, OutputPer1M: 15, CacheWritePer1M: 3.75, CacheReadPer1M: 0.30}
+	haiku45Pricing = ModelPricing{InputPer1M: 1, OutputPer1M: 5, CacheWritePer1M: 1.25, CacheReadPer1M: 0.10}
+	haiku35Pricing = ModelPricing{InputPer1M: 0.80, OutputPer1M: 4, CacheWritePer1M: 1, CacheReadPer1M: 0.08}
+	haiku3Pricing  = ModelPricing{InputPer1M: 0.25, OutputPer1M: 1.25, CacheWritePer1M: 0.30, CacheReadPer1M: 0.03}
+)
+
+// modelPricing is the built-in pricing table. Keys are model names or
+// prefixes of dated model IDs; the longest matching key wins, so a family
+// prefix such as "claude-opus-4" prices its newer releases and older ones
+// at other prices need their own keys. The aliases follow the latest model
+// of each family. Keep this the only place prices are defined.
+var modelPricing = struct {
+	sync.RWMutex
+	byModel map[string]ModelPricing
+}{
+	byModel: map[string]ModelPricing{
+		"opus":                   opus45Pricing,
+		"sonnet":                 sonnetPricing,
+		"haiku":                  haiku45Pricing,
+		"claude-opus-4":          opus45Pricing,
+		"claude-opus-4-0":        opus4Pricing,
+		"claude-opus-4-20250514": opus4Pricing,
+		"claude-opus-4-1":        opus4Pricing,
+		"claude-3-opus":          opus4Pricing,
+		"claude-sonnet-4":        sonnetPricing,
+		"claude-3-7-sonnet":      sonnetPricing,
+		"claude-3-5-sonnet":      sonnetPricing,
+		"claude-haiku-4":         haiku45Pricing,
+		"claude-3-5-haiku":       haiku35Pricing,
+		"claude-3-haiku":         haiku3Pricing,
+	},
+}
+
+// SetModelPricing adds or overrides the pricing for a model name or model
+// ID prefix, e.g. for a newly released model or negotiated rates.
+func SetModelPricing(model string, pricing ModelPricing) {
+	modelPricing.Lock()
+	defer modelPricing.Unlock()
+	modelPricing.byModel[model] = pricing
+}
+
+// LookupPricing returns the pricing for model, matching an exact name or
+// the longest known prefix, so dated IDs such as
+// "claude-sonnet-4-20250514" resolve to their family.
+func LookupPricing(model string) (ModelPricing, bool) {
+	modelPricing.RLock()
+	defer modelPricing.RUnlock()
+
+	if pricing, ok := modelPricing.byModel[model]; ok {
+		return pricing, true
+	}
+
+	var best string
+	for key := range modelPricing.byModel {
+		if strings.HasPrefix(model, key+"-") && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return ModelPricing{}, false
+	}
+	return modelPricing.byModel[best], true
+}
+
+// EstimateCost prices usage at model's list price, for budgeting before a
+// request or reconciling against the cost the CLI reports. Background
+// tokens are served by a different model and are not priced. Unknown
+// models yield a zero cost; use LookupPricing to tell them apart.
+func EstimateCost(model string, usage ResultUsage) ResultCost {
+	pricing, ok := LookupPricing(model)
+	if !ok {
+		return ResultCost{}
+	}
+
+	cost := ResultCost{
+		InputTokenCost:    float64(usage.InputTokens) * pricing.InputPer1M / 1e6,
+		OutputTokenCost:   float64(usage.OutputTokens) * pricing.OutputPer1M / 1e6,
+		CacheCreationCost: float64(usage.CacheCreationTokens) * pricing.CacheWritePer1M / 1e6,
+		CacheReadCost:     float64(usage.CacheReadTokens) * pricing.CacheReadPer1M / 1e6,
+	}
+	cost.TotalCost = cost.InputTokenCost + cost.OutputTokenCost + cost.CacheCreationCost + cost.CacheReadCost
+	return cost
+}
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLookupPricing(t *testing.T) {
+	tests := []struct {
+		model  string
+		want   ModelPricing
+		wantOK bool
+	}{
+		{"sonnet", sonnetPricing, true},
+		{"claude-sonnet-4-20250514", sonnetPricing, true},
+		{"claude-3-5-haiku-20241022", haiku35Pricing, true},
+		{"claude-3-haiku-20240307", haiku3Pricing, true},
+		{"haiku", haiku45Pricing, true},
+		{"claude-haiku-4-5-20251001", haiku45Pricing, true},
+		{"opus", opus45Pricing, true},
+		{"claude-opus-4-5-20251101", opus45Pricing, true},
+		{"claude-opus-4-6", opus45Pricing, true},
+		{"claude-opus-4-1-20250805", opus4Pricing, true},
+		{"claude-opus-4-20250514", opus4Pricing, true},
+		{"claude-opus-4-0", opus4Pricing, true},
+		{"gpt-4", ModelPricing{}, false},
+		{"claude-sonnet-40", ModelPricing{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := LookupPricing(tt.model)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("LookupPricing(%q) = %+v, %v, want %+v, %v", tt.model, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	// 1M input, 100k output, 200k cache writes and 1M cache reads on Sonnet:
+	// $3 + $1.50 + $0.75 + $0.30
+	usage := ResultUsage{
+		InputTokens:         1_000_000,
+		OutputTokens:        100_000,
+		CacheCreationTokens: 200_000,
+		CacheReadTokens:     1_000_000,
+	}
+	got := EstimateCost("claude-sonnet-4-20250514", usage)
+
+	want := ResultCost{
+		InputTokenCost:    3,
+		OutputTokenCost:   1.5,
+		CacheCreationCost: 0.75,
+		CacheReadCost:     0.3,
+		TotalCost:         5.55,
+	}
+	approx := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+	if !approx(got.InputTokenCost, want.InputTokenCost) ||
+		!approx(got.OutputTokenCost, want.OutputTokenCost) ||
+		!approx(got.CacheCreationCost, want.CacheCreationCost) ||
+		!approx(got.CacheReadCost, want.CacheReadCost) ||
+		!approx(got.TotalCost, want.TotalCost) {
+		t.Errorf("EstimateCost() = %+v, want %+v", got, want)
+	}
+
+	if got := EstimateCost("unknown-model", usage); got != (ResultCost{}) {
+		t.Errorf("EstimateCost() for unknown model = %+v, want zero", got)
+	}
+}
+
+func TestSetModelPricing(t *testing.T) {
+	custom := ModelPricing{InputPer1M: 1, OutputPer1M: 2}
+	SetModelPricing("claude-test", custom)
+
+	got := EstimateCost("claude-test-20260101", ResultUsage{InputTokens: 500_000, OutputTokens: 500_000})
+	if math.Abs(got.TotalCost-1.5) > 1e-9 {
+		t.Errorf("EstimateCost() with custom pricing TotalCost = %v, want 1.5", got.TotalCost)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package pkg
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// limitedCommand returns the command that runs the CLI under options'
+// address space limit. The limit has to be set by the child before it
+// execs the CLI, which a shell does with ulimit; -v counts KiB, so
+// RLimitAS is rounded down to a whole KiB.
+func limitedCommand(cliPath string, args []string, options *ClaudeCodeOptions) (string, []string) {
+	if options.RLimitAS == 0 {
+		return cliPath, args
+	}
+	script := fmt.Sprintf(`ulimit -v %d && exec "$0" "$@"`, options.RLimitAS/1024)
+	return "/bin/sh", append([]string{"-c", script, cliPath}, args...)
+}
+
+// startLimited starts cmd at options' niceness. Linux keeps niceness per
+// thread and a child inherits it from the thread that forks it, so cmd is
+// started from a locked thread that is reniced and then discarded, and the
+// CLI never runs at the inherited priority.
+func startLimited(cmd *exec.Cmd, options *ClaudeCodeOptions) error {
+	if options.Nice == 0 {
+		return startCommand(cmd)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		// Never unlocked, so the thread exits with this goroutine
+		runtime.LockOSThread()
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, syscall.Gettid(), options.Nice); err != nil {
+			errc <- fmt.Errorf("failed to set niceness %d: %w", options.Nice, err)
+			return
+		}
+		errc <- startCommand(cmd)
+	}()
+	return <-errc
+}
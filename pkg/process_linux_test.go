@@ -0,0 +1,65 @@
+//go:build linux
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_ProcessLimits(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+	setupScriptMockCLI(t, `#!/bin/sh
+touch '`+started+`'
+while IFS= read -r line; do :; done
+`)
+
+	const limit = 4 << 30
+	client := NewClient(&ClaudeCodeOptions{Nice: 10, RLimitAS: limit})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	// The limits must already hold once the CLI itself runs
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the CLI to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pid := client.transport.cmd.Process.Pid
+
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		t.Fatalf("Failed to read process stat: %v", err)
+	}
+	// Fields after the parenthesized command name; nice is field 19 overall
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	if nice := fields[16]; nice != "10" {
+		t.Errorf("process nice = %s, want 10", nice)
+	}
+
+	limits, err := os.ReadFile(fmt.Sprintf("/proc/%d/limits", pid))
+	if err != nil {
+		t.Fatalf("Failed to read process limits: %v", err)
+	}
+	want := fmt.Sprintf("%d", uint64(limit))
+	for _, line := range strings.Split(string(limits), "\n") {
+		if strings.HasPrefix(line, "Max address space") {
+			if fields := strings.Fields(line); fields[3] != want {
+				t.Errorf("address space limit = %s, want %s", fields[3], want)
+			}
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package pkg
+
+import "os/exec"
+
+// limitedCommand returns the CLI command unchanged; Nice and RLimitAS are
+// ignored on platforms other than Linux.
+func limitedCommand(cliPath string, args []string, options *ClaudeCodeOptions) (string, []string) {
+	return cliPath, args
+}
+
+// startLimited starts cmd without applying any limits.
+func startLimited(cmd *exec.Cmd, options *ClaudeCodeOptions) error {
+	return startCommand(cmd)
+}
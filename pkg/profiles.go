@@ -0,0 +1,89 @@
+package pkg
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var profiles = struct {
+	sync.RWMutex
+	byName map[string]*ClaudeCodeOptions
+}{
+	byName: make(map[string]*ClaudeCodeOptions),
+}
+
+// RegisterProfile stores opts as a named preset, such as "readonly" or
+// "thorough", for ClaudeCodeOptions.FromProfile. Registering a name again
+// replaces the preset. opts is copied, so later changes to it don't affect
+// the profile.
+func RegisterProfile(name string, opts *ClaudeCodeOptions) {
+	preset := &ClaudeCodeOptions{}
+	if opts != nil {
+		mergeOptions(preset, opts, nil)
+	}
+
+	profiles.Lock()
+	defer profiles.Unlock()
+	profiles.byName[name] = preset
+}
+
+// FromProfile merges the named profile into o field by field: each field o
+// leaves at its zero value takes the profile's value, and fields o already
+// sets are kept. A zero value can't say whether it was set on purpose, so
+// keep names the fields o sets to their zero value, such as a bool turned
+// off, which the profile then leaves alone. Slices, maps and the ToolPolicy
+// are copied, so o never aliases the profile. Profiles can be layered by
+// calling FromProfile repeatedly, most specific first.
+func (o *ClaudeCodeOptions) FromProfile(name string, keep ...string) error {
+	profiles.RLock()
+	preset, ok := profiles.byName[name]
+	profiles.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown profile %q", name)
+	}
+
+	kept := make(map[string]bool, len(keep))
+	optionsType := reflect.TypeOf(*o)
+	for _, field := range keep {
+		if _, ok := optionsType.FieldByName(field); !ok {
+			return fmt.Errorf("unknown option %q to keep", field)
+		}
+		kept[field] = true
+	}
+
+	mergeOptions(o, preset, kept)
+	return nil
+}
+
+// mergeOptions copies each non-zero field of src into dst where dst's field
+// is zero and not named in keep.
+func mergeOptions(dst, src *ClaudeCodeOptions, keep map[string]bool) {
+	dv := reflect.ValueOf(dst).Elem()
+	sv := reflect.ValueOf(src).Elem()
+
+	for i := 0; i < dv.NumField(); i++ {
+		df, sf := dv.Field(i), sv.Field(i)
+		if !df.CanSet() || !df.IsZero() || sf.IsZero() || keep[dv.Type().Field(i).Name] {
+			continue
+		}
+
+		switch sf.Kind() {
+		case reflect.Slice:
+			df.Set(reflect.AppendSlice(reflect.MakeSlice(sf.Type(), 0, sf.Len()), sf))
+		case reflect.Map:
+			m := reflect.MakeMapWithSize(sf.Type(), sf.Len())
+			iter := sf.MapRange()
+			for iter.Next() {
+				m.SetMapIndex(iter.Key(), iter.Value())
+			}
+			df.Set(m)
+		default:
+			if policy, ok := sf.Interface().(*ToolPolicy); ok {
+				df.Set(reflect.ValueOf(policy.clone()))
+				continue
+			}
+			df.Set(sf)
+		}
+	}
+}
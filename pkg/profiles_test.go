@@ -0,0 +1,101 @@
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClaudeCodeOptions_FromProfile(t *testing.T) {
+	RegisterProfile("readonly", &ClaudeCodeOptions{
+		AllowedTools:   []string{"Read", "Grep"},
+		PermissionMode: PermissionModeAcceptEdits,
+		Model:          "claude-haiku",
+		MaxTurns:       5,
+	})
+	RegisterProfile("logged", &ClaudeCodeOptions{
+		MaxTurns:        20,
+		StderrLogFormat: LogFormatJSON,
+	})
+
+	opts := &ClaudeCodeOptions{Model: "claude-opus", Cwd: "/tmp"}
+	if err := opts.FromProfile("readonly"); err != nil {
+		t.Fatalf("FromProfile() error = %v", err)
+	}
+	if err := opts.FromProfile("logged"); err != nil {
+		t.Fatalf("FromProfile() error = %v", err)
+	}
+
+	// Explicit fields win, then earlier profiles, then later ones
+	if opts.Model != "claude-opus" {
+		t.Errorf("Model = %q, want explicit claude-opus", opts.Model)
+	}
+	if opts.Cwd != "/tmp" {
+		t.Errorf("Cwd = %q, want /tmp", opts.Cwd)
+	}
+	if opts.MaxTurns != 5 {
+		t.Errorf("MaxTurns = %d, want 5 from the first profile", opts.MaxTurns)
+	}
+	if opts.PermissionMode != PermissionModeAcceptEdits {
+		t.Errorf("PermissionMode = %q, want %q", opts.PermissionMode, PermissionModeAcceptEdits)
+	}
+	if opts.StderrLogFormat != LogFormatJSON {
+		t.Errorf("StderrLogFormat = %q, want %q", opts.StderrLogFormat, LogFormatJSON)
+	}
+	if !reflect.DeepEqual(opts.AllowedTools, []string{"Read", "Grep"}) {
+		t.Errorf("AllowedTools = %v, want [Read Grep]", opts.AllowedTools)
+	}
+
+	// The merged options must not alias the registered profile
+	opts.AllowedTools[0] = "Write"
+	other := &ClaudeCodeOptions{}
+	if err := other.FromProfile("readonly"); err != nil {
+		t.Fatalf("FromProfile() error = %v", err)
+	}
+	if other.AllowedTools[0] != "Read" {
+		t.Errorf("profile AllowedTools modified through merged options: %v", other.AllowedTools)
+	}
+}
+
+func TestClaudeCodeOptions_FromProfileUnknown(t *testing.T) {
+	opts := &ClaudeCodeOptions{}
+	if err := opts.FromProfile("does-not-exist"); err == nil {
+		t.Error("FromProfile() error = nil, want error for unknown profile")
+	}
+}
+
+func TestClaudeCodeOptions_FromProfileKeep(t *testing.T) {
+	RegisterProfile("strict", &ClaudeCodeOptions{
+		TreatInterruptAsError: true,
+		MaxTurns:              3,
+		ToolPolicy:            &ToolPolicy{Default: ToolDeny, Rules: []ToolRule{AllowToolRule("Read", "")}},
+	})
+
+	// An explicit false survives only when kept
+	opts := &ClaudeCodeOptions{TreatInterruptAsError: false}
+	if err := opts.FromProfile("strict", "TreatInterruptAsError"); err != nil {
+		t.Fatalf("FromProfile() error = %v", err)
+	}
+	if opts.TreatInterruptAsError {
+		t.Error("TreatInterruptAsError = true, want the kept false")
+	}
+	if opts.MaxTurns != 3 {
+		t.Errorf("MaxTurns = %d, want 3 from the profile", opts.MaxTurns)
+	}
+
+	// The policy is copied rather than shared with the profile
+	opts.ToolPolicy.Rules[0] = DenyToolRule("Bash", "")
+	other := &ClaudeCodeOptions{}
+	if err := other.FromProfile("strict"); err != nil {
+		t.Fatalf("FromProfile() error = %v", err)
+	}
+	if !other.TreatInterruptAsError {
+		t.Error("TreatInterruptAsError = false, want true from the profile")
+	}
+	if rule := other.ToolPolicy.Rules[0]; rule.Tool != "Read" {
+		t.Errorf("profile ToolPolicy modified through merged options: %v", rule)
+	}
+
+	if err := opts.FromProfile("strict", "NoSuchOption"); err == nil {
+		t.Error("FromProfile() with unknown keep field error = nil, want error")
+	}
+}
@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// maxRunningProgress caps the estimate of a turn still in progress, since
+// limits are ceilings and most turns finish well before reaching them.
+const maxRunningProgress = 0.99
+
+// Progress is a rough estimate of how far the current turn has come, for
+// showing a progress bar. It is a heuristic: the CLI gives no real
+// estimate, so Fraction is the larger of output tokens against MaxTokens
+// and model turns against MaxTurns. With neither limit set, Fraction stays
+// 0 until the turn finishes.
+type Progress struct {
+	// Fraction is the estimate between 0 and 1. It only reaches 1 once
+	// the turn's result has arrived.
+	Fraction float64
+	// TokenFraction is OutputTokens / MaxTokens, or 0 without MaxTokens
+	TokenFraction float64
+	// TurnFraction is ModelTurns / MaxTurns, or 0 without MaxTurns
+	TurnFraction float64
+
+	OutputTokens int
+	// ModelTurns counts the model's responses in the turn, counting the
+	// messages the CLI sends for each content block of one response once
+	ModelTurns int
+	Elapsed    time.Duration
+	Done       bool
+}
+
+// turnProgress is the per-turn state behind Client.Progress
+type turnProgress struct {
+	startedAt    time.Time
+	outputTokens int
+	// c.turns when the turn started
+	turnsAtStart int
+	done         bool
+}
+
+// Progress estimates the progress of the current turn. See Progress for
+// how the estimate is made and its caveats.
+func (c *Client) Progress() Progress {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p := Progress{
+		OutputTokens: c.progress.outputTokens,
+		ModelTurns:   c.turns.turns - c.progress.turnsAtStart,
+		Done:         c.progress.done,
+	}
+	if !c.progress.startedAt.IsZero() {
+		p.Elapsed = c.options.clock().Now().Sub(c.progress.startedAt)
+	}
+
+	if c.options.MaxTokens > 0 {
+		p.TokenFraction = clampFraction(float64(p.OutputTokens) / float64(c.options.MaxTokens))
+	}
+	if c.options.MaxTurns > 0 {
+		p.TurnFraction = clampFraction(float64(p.ModelTurns) / float64(c.options.MaxTurns))
+	}
+
+	switch {
+	case p.Done:
+		p.Fraction = 1
+	case p.TokenFraction > p.TurnFraction:
+		p.Fraction = p.TokenFraction
+	default:
+		p.Fraction = p.TurnFraction
+	}
+	if !p.Done && p.Fraction > maxRunningProgress {
+		p.Fraction = maxRunningProgress
+	}
+	return p
+}
+
+// startProgress resets progress for a turn starting now. It must be called
+// with c.mu held.
+func (c *Client) startProgress() {
+	c.progress = turnProgress{startedAt: c.options.clock().Now(), turnsAtStart: c.turns.turns}
+}
+
+// trackProgress updates the current turn's progress from msg; model turns
+// come from c.turns. It must be called with c.mu held.
+func (c *Client) trackProgress(msg Message) {
+	switch m := msg.(type) {
+	case SystemMessage:
+		if m.Subtype != SystemMessageSubtypeUsage {
+			return
+		}
+		var payload struct {
+			Data ResultUsage `json:"data"`
+		}
+		if err := json.Unmarshal(m.Raw, &payload); err == nil {
+			// Usage updates are cumulative for the turn
+			c.progress.outputTokens = payload.Data.OutputTokens
+		}
+	case ResultMessage:
+		c.progress.outputTokens = m.Data.Usage.OutputTokens
+		c.progress.done = true
+	}
+}
+
+func clampFraction(f float64) float64 {
+	if f > 1 {
+		return 1
+	}
+	return f
+}
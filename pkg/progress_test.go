@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestClient_Progress(t *testing.T) {
+	usage := func(outputTokens int) SystemMessage {
+		raw, _ := json.Marshal(map[string]interface{}{
+			"role":    "system",
+			"subtype": "usage",
+			"data":    map[string]int{"outputTokens": outputTokens},
+		})
+		return SystemMessage{Role: MessageRoleSystem, Subtype: SystemMessageSubtypeUsage, Raw: raw}
+	}
+	assistant := &AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Read"},
+	}}
+
+	tests := []struct {
+		name         string
+		options      ClaudeCodeOptions
+		messages     []Message
+		wantFraction float64
+		wantDone     bool
+	}{
+		{
+			name:         "tokens dominate",
+			options:      ClaudeCodeOptions{MaxTokens: 1000, MaxTurns: 10},
+			messages:     []Message{assistant, usage(200), usage(400)},
+			wantFraction: 0.4,
+		},
+		{
+			name:         "turns dominate",
+			options:      ClaudeCodeOptions{MaxTokens: 1000, MaxTurns: 4},
+			messages:     []Message{assistant, usage(100), assistant, assistant},
+			wantFraction: 0.75,
+		},
+		{
+			name:    "content blocks of one response",
+			options: ClaudeCodeOptions{MaxTurns: 4},
+			messages: []Message{
+				&AssistantMessage{ID: "m1", Content: []ContentBlock{TextBlock{Text: "Reading"}}},
+				&AssistantMessage{ID: "m1", Content: []ContentBlock{ToolUseBlock{ID: "t1", Name: "Read"}}},
+				&AssistantMessage{ID: "m2", Content: []ContentBlock{TextBlock{Text: "Done"}}},
+			},
+			wantFraction: 0.5,
+		},
+		{
+			name:         "capped while running",
+			options:      ClaudeCodeOptions{MaxTokens: 100},
+			messages:     []Message{usage(150)},
+			wantFraction: maxRunningProgress,
+		},
+		{
+			name:         "no limits",
+			options:      ClaudeCodeOptions{},
+			messages:     []Message{assistant, usage(500)},
+			wantFraction: 0,
+		},
+		{
+			name:    "finished",
+			options: ClaudeCodeOptions{MaxTokens: 1000},
+			messages: []Message{assistant, ResultMessage{Role: MessageRoleSystem, Data: ResultMessageData{
+				Usage: ResultUsage{OutputTokens: 300},
+			}}},
+			wantFraction: 1,
+			wantDone:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := NewFakeClock(time.Unix(1700000000, 0))
+			options := tt.options
+			options.Clock = clock
+			client := NewClient(&options)
+
+			client.mu.Lock()
+			client.startTurn()
+			client.mu.Unlock()
+
+			for _, msg := range tt.messages {
+				client.record(msg)
+			}
+			clock.Advance(3 * time.Second)
+
+			progress := client.Progress()
+			if math.Abs(progress.Fraction-tt.wantFraction) > 1e-9 {
+				t.Errorf("Progress().Fraction = %v, want %v (%+v)", progress.Fraction, tt.wantFraction, progress)
+			}
+			if progress.Done != tt.wantDone {
+				t.Errorf("Progress().Done = %v, want %v", progress.Done, tt.wantDone)
+			}
+			if progress.Elapsed != 3*time.Second {
+				t.Errorf("Progress().Elapsed = %v, want 3s", progress.Elapsed)
+			}
+		})
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode"
 )
 
+// defaultQueryTimeout bounds a Query when QueryTimeout is unset
+const defaultQueryTimeout = 30 * time.Minute
+
 type QueryResult struct {
 	Messages []Message
 	Result   *ResultMessage
@@ -19,6 +23,67 @@ func Query(ctx context.Context, prompt string, options *ClaudeCodeOptions) (*Que
 		options = &ClaudeCodeOptions{}
 	}
 
+	if err := options.checkPrompt(prompt); err != nil {
+		return nil, err
+	}
+
+	if !queryCacheable(options) {
+		return tracedQuery(ctx, prompt, options)
+	}
+
+	key, err := queryCacheKey(prompt, options)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := options.QueryCache.Get(key); ok {
+		return cached, nil
+	}
+
+	result, err := tracedQuery(ctx, prompt, options)
+	if err != nil {
+		return nil, err
+	}
+	// Only completed queries are worth replaying
+	if result.Result != nil && !result.Result.Data.InterruptRequested && !result.Result.Data.IsError {
+		options.QueryCache.Put(key, result)
+	}
+	return result, nil
+}
+
+// QueryStream runs a query like Query, also passing each message to
+// onMessage as it arrives. onMessage runs synchronously in the read loop,
+// after any OnMessage in options, so it sees messages in order and slows
+// the query if it blocks. A result served from the QueryCache is returned
+// without calling onMessage.
+func QueryStream(ctx context.Context, prompt string, options *ClaudeCodeOptions, onMessage func(Message)) (*QueryResult, error) {
+	if options == nil {
+		options = &ClaudeCodeOptions{}
+	}
+
+	streamed := *options
+	streamed.OnMessage = func(msg Message) {
+		if options.OnMessage != nil {
+			options.OnMessage(msg)
+		}
+		if onMessage != nil {
+			onMessage(msg)
+		}
+	}
+	return Query(ctx, prompt, &streamed)
+}
+
+// tracedQuery runs the query inside a span when options has a Tracer.
+func tracedQuery(ctx context.Context, prompt string, options *ClaudeCodeOptions) (*QueryResult, error) {
+	span := startTurnSpan(ctx, options.Tracer, SpanNameQuery)
+	if span != nil {
+		ctx = span.ctx
+	}
+	result, err := runQuery(ctx, prompt, options, span)
+	span.end(err)
+	return result, err
+}
+
+func runQuery(ctx context.Context, prompt string, options *ClaudeCodeOptions, span *turnSpan) (*QueryResult, error) {
 	// For query, we want non-streaming mode with prompt passed via --print flag
 	transport, err := newTransportForQuery(ctx, options, prompt)
 	if err != nil {
@@ -36,6 +101,33 @@ func Query(ctx context.Context, prompt string, options *ClaudeCodeOptions) (*Que
 		Messages: make([]Message, 0),
 	}
 
+	echoFiltered := options.IncludePromptEcho
+	sessionKnown := false
+	collect := func(msg Message) {
+		// Some CLI versions echo the --print prompt back as a user message
+		if !echoFiltered {
+			if user, isUser := msg.(UserMessage); isUser && strings.TrimSpace(user.Content) == strings.TrimSpace(prompt) {
+				echoFiltered = true
+				return
+			}
+		}
+
+		span.observe(msg)
+		result.Messages = append(result.Messages, msg)
+		if id := messageSessionID(msg); id != "" && !sessionKnown {
+			sessionKnown = true
+			if options.OnSessionID != nil {
+				options.OnSessionID(id)
+			}
+		}
+		if options.OnMessage != nil {
+			options.OnMessage(msg)
+		}
+		if res, isResult := msg.(ResultMessage); isResult {
+			result.Result = &res
+		}
+	}
+
 	messageChan := transport.messages
 	errorChan := transport.errors
 	
@@ -44,7 +136,11 @@ func Query(ctx context.Context, prompt string, options *ClaudeCodeOptions) (*Que
 		waitDone <- transport.wait()
 	}()
 
-	timeout := time.NewTimer(30 * time.Minute)
+	queryTimeout := options.QueryTimeout
+	if queryTimeout <= 0 {
+		queryTimeout = defaultQueryTimeout
+	}
+	timeout := options.clock().NewTimer(queryTimeout)
 	defer timeout.Stop()
 
 Loop:
@@ -52,24 +148,31 @@ Loop:
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
-		case <-timeout.C:
-			return nil, fmt.Errorf("query timeout after 30 minutes")
+		case <-timeout.C():
+			result.Stderr = transport.stderrOutput()
+			result.setStdout(options.PreserveStdoutWhitespace)
+			return nil, NewQueryTimeoutError(queryTimeout, result)
 		case err := <-errorChan:
 			if err != nil {
 				return nil, err
 			}
 		case msg, ok := <-messageChan:
 			if ok {
-				result.Messages = append(result.Messages, msg)
-				if res, isResult := msg.(ResultMessage); isResult {
-					result.Result = &res
-				}
+				collect(msg)
 			}
 		case err := <-waitDone:
 			if err != nil {
 				return nil, err
 			}
-			break Loop
+			// The readers have finished, so anything left is already buffered
+			for {
+				select {
+				case msg := <-messageChan:
+					collect(msg)
+				default:
+					break Loop
+				}
+			}
 		}
 	}
 
@@ -78,8 +181,19 @@ Loop:
 		result.Stderr = stderr
 	}
 
+	if options.TreatInterruptAsError && result.Result != nil && result.Result.Data.InterruptRequested {
+		return nil, NewInterruptedError(result.Result)
+	}
+
+	result.setStdout(options.PreserveStdoutWhitespace)
+
+	return result, nil
+}
+
+// setStdout fills Stdout from the text blocks of the assistant messages.
+func (r *QueryResult) setStdout(preserveWhitespace bool) {
 	var textParts []string
-	for _, msg := range result.Messages {
+	for _, msg := range r.Messages {
 		switch m := msg.(type) {
 		case *AssistantMessage:
 			for _, block := range m.Content {
@@ -89,10 +203,67 @@ Loop:
 			}
 		}
 	}
-	
+
 	if len(textParts) > 0 {
-		result.Stdout = strings.Join(textParts, "\n")
+		r.Stdout = joinTextParts(textParts, preserveWhitespace)
 	}
+}
+
+// joinTextParts assembles text blocks into display output. Unless preserve
+// is set, trailing whitespace is trimmed from each block so blocks ending in
+// newlines don't produce doubled blank lines, and blocks left empty are
+// dropped.
+func joinTextParts(parts []string, preserve bool) string {
+	if preserve {
+		return strings.Join(parts, "\n")
+	}
+
+	cleaned := make([]string, 0, len(parts))
+	for _, part := range parts {
+		part = strings.TrimRightFunc(part, unicode.IsSpace)
+		if part != "" {
+			cleaned = append(cleaned, part)
+		}
+	}
+	return strings.Join(cleaned, "\n")
+}
+
+// QueryConversation runs several prompts as consecutive turns of one
+// session, waiting for each turn's result before sending the next prompt.
+// The returned QueryResult holds every message of the conversation, the
+// last turn's result, and each turn's text in Stdout, separated by
+// newlines.
+func QueryConversation(ctx context.Context, prompts []string, options *ClaudeCodeOptions) (*QueryResult, error) {
+	if len(prompts) == 0 {
+		return nil, fmt.Errorf("no prompts given")
+	}
+
+	client := NewClient(options)
+	if err := client.Connect(ctx, ""); err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	result := &QueryResult{}
+	var turnTexts []string
+	for _, prompt := range prompts {
+		if err := client.SendMessage(ctx, prompt); err != nil {
+			return nil, err
+		}
+		turnResult, err := client.WaitForResult(ctx)
+		if err != nil {
+			return nil, err
+		}
+		result.Result = turnResult
+		if text := client.ResponseText(); text != "" {
+			turnTexts = append(turnTexts, text)
+		}
+	}
+
+	result.Messages = client.GetMessages()
+	result.Stdout = joinTextParts(turnTexts, client.options.PreserveStdoutWhitespace)
+
+	result.Stderr = client.transport.stderrOutput()
 
 	return result, nil
 }
@@ -2,8 +2,10 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -36,6 +38,17 @@ echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"us
 		script = `#!/bin/sh
 echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Let me calculate that"},{"type":"tool_use","id":"calc1","name":"calculator","input":{"a":5,"b":3}},{"type":"tool_result","tool_use_id":"calc1","content":"8"}]}}'
 echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":10,"outputTokens":15,"backgroundTokens":0},"cost":{"inputTokenCost":0.001,"outputTokenCost":0.003,"backgroundTokenCost":0,"totalCost":0.004},"sessionId":"tool-session","interruptRequested":false}}}'
+`
+	case "echo":
+		script = `#!/bin/sh
+echo '{"type":"user","message":{"role":"user","content":"Echo this prompt"}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Echoed response"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":5,"outputTokens":3,"backgroundTokens":0},"cost":{"inputTokenCost":0.0005,"outputTokenCost":0.0006,"backgroundTokenCost":0,"totalCost":0.0011},"sessionId":"echo-session","interruptRequested":false}}}'
+`
+	case "trailing-newlines":
+		script = `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"First line\\n\\n"},{"type":"text","text":"Second line  \\n"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":5,"outputTokens":6,"backgroundTokens":0},"cost":{"inputTokenCost":0.0005,"outputTokenCost":0.0012,"backgroundTokenCost":0,"totalCost":0.0017},"sessionId":"trim-session","interruptRequested":false}}}'
 `
 	case "error":
 		script = `#!/bin/sh
@@ -319,4 +332,400 @@ echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"us
 	if len(result.Messages) != 1 {
 		t.Errorf("Messages length = %d, want 1", len(result.Messages))
 	}
-}
\ No newline at end of file
+}
+func TestQuery_PromptEcho(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   *ClaudeCodeOptions
+		wantCount int
+		wantEcho  bool
+	}{
+		{
+			name:      "echo filtered by default",
+			options:   nil,
+			wantCount: 2,
+			wantEcho:  false,
+		},
+		{
+			name:      "echo kept when requested",
+			options:   &ClaudeCodeOptions{IncludePromptEcho: true},
+			wantCount: 3,
+			wantEcho:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupQueryMockCLI(t, "echo")
+
+			result, err := Query(context.Background(), "Echo this prompt", tt.options)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+
+			if len(result.Messages) != tt.wantCount {
+				t.Errorf("Messages length = %d, want %d", len(result.Messages), tt.wantCount)
+			}
+
+			gotEcho := false
+			for _, msg := range result.Messages {
+				if _, isUser := msg.(UserMessage); isUser {
+					gotEcho = true
+				}
+			}
+			if gotEcho != tt.wantEcho {
+				t.Errorf("Messages contain echoed prompt = %v, want %v", gotEcho, tt.wantEcho)
+			}
+
+			if result.Stdout != "Echoed response" {
+				t.Errorf("Query() stdout = %v, want 'Echoed response'", result.Stdout)
+			}
+		})
+	}
+}
+
+func TestQuery_StdoutWhitespace(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    *ClaudeCodeOptions
+		wantStdout string
+	}{
+		{
+			name:       "trimmed by default",
+			options:    nil,
+			wantStdout: "First line\nSecond line",
+		},
+		{
+			name:       "preserved when requested",
+			options:    &ClaudeCodeOptions{PreserveStdoutWhitespace: true},
+			wantStdout: "First line\n\n\nSecond line  \n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupQueryMockCLI(t, "trailing-newlines")
+
+			result, err := Query(context.Background(), "Hello", tt.options)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+
+			if result.Stdout != tt.wantStdout {
+				t.Errorf("Query() stdout = %q, want %q", result.Stdout, tt.wantStdout)
+			}
+
+			assistant, ok := result.Messages[0].(*AssistantMessage)
+			if !ok {
+				t.Fatalf("Messages[0] = %T, want *AssistantMessage", result.Messages[0])
+			}
+			if text := assistant.Content[0].(TextBlock).Text; text != "First line\n\n" {
+				t.Errorf("Messages text = %q, want it unchanged", text)
+			}
+		})
+	}
+}
+
+func TestQuery_UsedModel(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{
+			name: "reported in result",
+			script: `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1,"backgroundTokens":0},"cost":{"totalCost":0.001},"sessionId":"model-session","interruptRequested":false,"model":"claude-sonnet-fallback"}}}'
+`,
+			want: "claude-sonnet-fallback",
+		},
+		{
+			name: "reported in init",
+			script: `#!/bin/sh
+echo '{"type":"system","message":{"role":"system","subtype":"init","data":{"model":"claude-opus-resolved"}}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1,"backgroundTokens":0},"cost":{"totalCost":0.001},"sessionId":"model-session","interruptRequested":false}}}'
+`,
+			want: "claude-opus-resolved",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, tt.script)
+
+			result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{Model: "claude-opus"})
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if result.Result == nil {
+				t.Fatal("Query() result is nil")
+			}
+			if got := result.Result.UsedModel(); got != tt.want {
+				t.Errorf("UsedModel() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_UsedModelFromInit(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"system","message":{"role":"system","subtype":"init","data":{"model":"claude-opus-resolved"}}}'
+read -r line
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"model-session"}}}'
+while IFS= read -r line; do :; done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, "Hello"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	// Every path sees the init model, not just WaitForResult
+	var result *ResultMessage
+	for msg := range client.ReceiveResponse(ctx) {
+		if r, ok := msg.(ResultMessage); ok {
+			result = &r
+		}
+	}
+	if result == nil {
+		t.Fatal("ReceiveResponse() delivered no result")
+	}
+	if got := result.UsedModel(); got != "claude-opus-resolved" {
+		t.Errorf("UsedModel() = %q, want claude-opus-resolved", got)
+	}
+}
+
+func TestQuery_TreatInterruptAsError(t *testing.T) {
+	tests := []struct {
+		name    string
+		options *ClaudeCodeOptions
+		wantErr bool
+	}{
+		{name: "result by default", options: nil, wantErr: false},
+		{name: "error when requested", options: &ClaudeCodeOptions{TreatInterruptAsError: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Partial"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"int-session","interruptRequested":true}}}'
+`)
+
+			result, err := Query(context.Background(), "Hello", tt.options)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("Query() error = %v", err)
+				}
+				if !result.Result.Data.InterruptRequested {
+					t.Error("Query() InterruptRequested = false, want true")
+				}
+				return
+			}
+
+			var interrupted *InterruptedError
+			if !errors.As(err, &interrupted) {
+				t.Fatalf("Query() error = %v, want *InterruptedError", err)
+			}
+			if result != nil {
+				t.Errorf("Query() result = %v, want nil", result)
+			}
+			if interrupted.Result == nil || interrupted.Result.Data.SessionID != "int-session" {
+				t.Errorf("InterruptedError.Result = %+v, want the interrupted result", interrupted.Result)
+			}
+		})
+	}
+}
+
+func TestQueryConversation(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+turn=0
+while IFS= read -r line; do
+    turn=$((turn + 1))
+    content=$(echo "$line" | sed -n 's/.*"content":"\([^"]*\)".*/\1/p')
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Reply to: '"$content"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"turn-'$turn'"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := QueryConversation(ctx, []string{"one", "two", "three"}, nil)
+	if err != nil {
+		t.Fatalf("QueryConversation() error = %v", err)
+	}
+
+	turns := 0
+	for _, msg := range result.Messages {
+		if _, ok := msg.(ResultMessage); ok {
+			turns++
+		}
+	}
+	if turns != 3 {
+		t.Errorf("QueryConversation() turns = %d, want 3", turns)
+	}
+	if result.Result == nil || result.Result.Data.SessionID != "turn-3" {
+		t.Errorf("QueryConversation() Result = %+v, want the last turn's result", result.Result)
+	}
+	if want := "Reply to: one\nReply to: two\nReply to: three"; result.Stdout != want {
+		t.Errorf("QueryConversation() stdout = %q, want %q", result.Stdout, want)
+	}
+
+	if _, err := QueryConversation(ctx, nil, nil); err == nil {
+		t.Error("QueryConversation() with no prompts error = nil, want error")
+	}
+}
+
+func TestQuery_ToolResultInterceptor(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Listing"},{"type":"tool_result","tool_use_id":"tool-1","content":"0123456789abcdefghij"}]}}'
+echo '{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tool-2","content":"klmnopqrstuvwxyz"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+`)
+
+	truncate := func(block ToolResultBlock) ToolResultBlock {
+		if content, ok := block.Content.(string); ok && len(content) > 10 {
+			block.Content = content[:10] + "..."
+		}
+		return block
+	}
+
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{ToolResultInterceptor: truncate})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	var got []interface{}
+	for _, msg := range result.Messages {
+		var blocks []ContentBlock
+		switch m := msg.(type) {
+		case *AssistantMessage:
+			blocks = m.Content
+		case UserMessage:
+			blocks = m.Blocks
+		}
+		for _, block := range blocks {
+			if toolResult, ok := block.(ToolResultBlock); ok {
+				got = append(got, toolResult.Content)
+			}
+		}
+	}
+	if len(got) != 2 || got[0] != "0123456789..." || got[1] != "klmnopqrst..." {
+		t.Errorf("tool result contents = %v, want [0123456789... klmnopqrst...]", got)
+	}
+}
+
+func TestQuery_MaxBackgroundTokens(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"system","message":{"role":"system","subtype":"usage","data":{"backgroundTokens":400}}}'
+echo '{"type":"system","message":{"role":"system","subtype":"usage","data":{"backgroundTokens":1500}}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"backgroundTokens":1500},"sessionId":"s1"}}}'
+`)
+
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{MaxBackgroundTokens: 1000})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	var notices []int
+	for i, msg := range result.Messages {
+		if err := backgroundTokenLimitError(msg); err != nil {
+			var limitErr *BackgroundTokenLimitError
+			if !errors.As(err, &limitErr) || limitErr.Used != 1500 || limitErr.Limit != 1000 {
+				t.Errorf("notice = %v, want 1500 used of 1000", err)
+			}
+			notices = append(notices, i)
+		}
+	}
+	// The notice follows the usage message that crossed the limit
+	if len(notices) != 1 || notices[0] != 2 {
+		t.Errorf("background_token_limit_exceeded at %v, want once at index 2", notices)
+	}
+}
+
+func TestQuery_QueryTimeout(t *testing.T) {
+	setupQueryMockCLI(t, "timeout")
+
+	start := time.Now()
+	_, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{QueryTimeout: 200 * time.Millisecond})
+
+	var timeoutErr *QueryTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Query() error = %v, want *QueryTimeoutError", err)
+	}
+	if timeoutErr.Timeout != 200*time.Millisecond {
+		t.Errorf("QueryTimeoutError.Timeout = %v, want 200ms", timeoutErr.Timeout)
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("errors.Is(%v, ErrTimeout) = false, want true", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Query() took %v, want it to stop at QueryTimeout", elapsed)
+	}
+}
+
+func TestQuery_QueryTimeoutPartialResult(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Partial answer"}]}}'
+echo "still working" >&2
+exec sleep 30
+`)
+
+	_, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{QueryTimeout: 300 * time.Millisecond})
+
+	var timeoutErr *QueryTimeoutError
+	if !errors.As(err, &timeoutErr) {
+		t.Fatalf("Query() error = %v, want *QueryTimeoutError", err)
+	}
+	partial := timeoutErr.Partial
+	if partial == nil {
+		t.Fatal("QueryTimeoutError.Partial = nil, want the messages received before the deadline")
+	}
+	if len(partial.Messages) != 1 || partial.Result != nil {
+		t.Errorf("Partial = %d messages, result %v, want 1 message and no result", len(partial.Messages), partial.Result)
+	}
+	if partial.Stdout != "Partial answer" {
+		t.Errorf("Partial.Stdout = %q, want %q", partial.Stdout, "Partial answer")
+	}
+	if !strings.Contains(partial.Stderr, "still working") {
+		t.Errorf("Partial.Stderr = %q, want it to contain the CLI's stderr", partial.Stderr)
+	}
+}
+
+func TestQueryStream(t *testing.T) {
+	setupQueryMockCLI(t, "simple")
+
+	var hooked, streamed []Message
+	options := &ClaudeCodeOptions{
+		OnMessage: func(msg Message) { hooked = append(hooked, msg) },
+	}
+	result, err := QueryStream(context.Background(), "Hello", options, func(msg Message) {
+		streamed = append(streamed, msg)
+	})
+	if err != nil {
+		t.Fatalf("QueryStream() error = %v", err)
+	}
+	if result.Result == nil {
+		t.Fatal("QueryStream() Result = nil, want the result message")
+	}
+
+	if len(streamed) == 0 || len(streamed) != len(result.Messages) {
+		t.Fatalf("callback called %d times, want once per each of %d messages", len(streamed), len(result.Messages))
+	}
+	for i := range streamed {
+		if !reflect.DeepEqual(streamed[i], result.Messages[i]) {
+			t.Errorf("callback %d = %v, want %v", i, streamed[i], result.Messages[i])
+		}
+	}
+	if len(hooked) != len(streamed) {
+		t.Errorf("options.OnMessage called %d times, want %d", len(hooked), len(streamed))
+	}
+}
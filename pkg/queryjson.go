@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// QueryJSON runs Query and decodes the assistant's final answer, the text
+// of its last message, as JSON into a T, for prompts that ask for
+// structured output. The JSON may be bare or in a fenced code block; with
+// several blocks the first tagged json, or else the first one, is used. A
+// result that reports an error gives a ResultError, and text that doesn't
+// decode into a T a JSONOutputError holding it.
+func QueryJSON[T any](ctx context.Context, prompt string, options *ClaudeCodeOptions) (T, error) {
+	var value T
+	result, err := Query(ctx, prompt, options)
+	if err != nil {
+		return value, err
+	}
+	if result.Result != nil && result.Result.Data.IsError {
+		return value, NewResultError(result.Result)
+	}
+
+	answer := lastAssistantText(result.Messages)
+	if err := json.Unmarshal([]byte(extractJSON(answer)), &value); err != nil {
+		var zero T
+		return zero, NewJSONOutputError(answer, err)
+	}
+	return value, nil
+}
+
+// lastAssistantText returns the text of the last assistant message that
+// has any, ignoring streamed deltas.
+func lastAssistantText(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		assistant, ok := messages[i].(*AssistantMessage)
+		if !ok || assistant.isDelta() {
+			continue
+		}
+		var text strings.Builder
+		for _, block := range assistant.Content {
+			if b, ok := block.(TextBlock); ok {
+				text.WriteString(b.Text)
+			}
+		}
+		if text.Len() > 0 {
+			return text.String()
+		}
+	}
+	return ""
+}
+
+// extractJSON returns the JSON in assistant text: the content of its json
+// code block, or else of its first code block, or else the whole text.
+func extractJSON(text string) string {
+	blocks := parseCodeBlocks(text)
+	for _, block := range blocks {
+		if strings.EqualFold(block.Language, "json") {
+			return block.Content
+		}
+	}
+	if len(blocks) > 0 {
+		return blocks[0].Content
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setupTextMockCLI installs a mock CLI whose answer is the given text
+func setupTextMockCLI(t *testing.T, text string) {
+	t.Helper()
+	line, err := json.Marshal(map[string]interface{}{
+		"type": "assistant",
+		"message": map[string]interface{}{
+			"role":    "assistant",
+			"content": []map[string]string{{"type": "text", "text": text}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode mock answer: %v", err)
+	}
+	setupScriptMockCLI(t, `#!/bin/sh
+cat <<'EOF'
+`+string(line)+`
+{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}
+EOF
+`)
+}
+
+func TestQueryJSON(t *testing.T) {
+	type language struct {
+		Name  string   `json:"name"`
+		Years []int    `json:"years"`
+		Tags  []string `json:"tags,omitempty"`
+	}
+	want := language{Name: "Go", Years: []int{2009, 2012}}
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "bare", text: `{"name": "Go", "years": [2009, 2012]}`},
+		{name: "bare with whitespace", text: "\n  {\"name\": \"Go\", \"years\": [2009, 2012]}\n"},
+		{name: "fenced", text: "Here it is:\n\n```json\n{\"name\": \"Go\", \"years\": [2009, 2012]}\n```\n\nAnything else?"},
+		{name: "untagged fence", text: "```\n{\"name\": \"Go\", \"years\": [2009, 2012]}\n```"},
+		{name: "json fence after another", text: "```sh\ngo version\n```\n\n```JSON\n{\"name\": \"Go\", \"years\": [2009, 2012]}\n```"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTextMockCLI(t, tt.text)
+
+			got, err := QueryJSON[language](context.Background(), "Describe Go as JSON", nil)
+			if err != nil {
+				t.Fatalf("QueryJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("QueryJSON() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestQueryJSON_InvalidOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "prose", text: "Go is a programming language."},
+		{name: "truncated", text: "```json\n{\"name\": \"Go\",\n```"},
+		{name: "wrong shape", text: `["Go"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTextMockCLI(t, tt.text)
+
+			got, err := QueryJSON[map[string]string](context.Background(), "Describe Go as JSON", nil)
+			var outputErr *JSONOutputError
+			if !errors.As(err, &outputErr) {
+				t.Fatalf("QueryJSON() error = %v, want *JSONOutputError", err)
+			}
+			if !strings.Contains(outputErr.Text, strings.TrimSpace(tt.text)) {
+				t.Errorf("JSONOutputError.Text = %q, want the assistant text", outputErr.Text)
+			}
+			if !errors.Is(err, ErrParse) {
+				t.Error("JSONOutputError should match ErrParse")
+			}
+			if got != nil {
+				t.Errorf("QueryJSON() = %v, want the zero value", got)
+			}
+		})
+	}
+}
+
+func TestQueryJSON_LastMessage(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+cat <<'EOF'
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Checking {\"name\": \"draft\"} first"},{"type":"tool_use","id":"t1","name":"Read","input":{}}]}}
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"{\"name\": \"Go\"}"}]}}
+{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}
+EOF
+`)
+
+	got, err := QueryJSON[map[string]string](context.Background(), "Describe Go as JSON", nil)
+	if err != nil {
+		t.Fatalf("QueryJSON() error = %v", err)
+	}
+	if got["name"] != "Go" {
+		t.Errorf("QueryJSON() = %v, want the last message's answer", got)
+	}
+}
+
+func TestQueryJSON_ErrorResult(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+cat <<'EOF'
+{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"{\"name\": \"Go\"}"}]}}
+{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1","isError":true}}}
+EOF
+`)
+
+	_, err := QueryJSON[map[string]string](context.Background(), "Describe Go as JSON", nil)
+	var resultErr *ResultError
+	if !errors.As(err, &resultErr) {
+		t.Fatalf("QueryJSON() error = %v, want *ResultError", err)
+	}
+	if !resultErr.Result.Data.IsError {
+		t.Error("ResultError.Result should be the failed result")
+	}
+}
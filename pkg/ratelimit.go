@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitInfo is the rate-limit state an HTTP server reported in its
+// response headers. Limit and Remaining are -1 when not reported; Reset
+// and RetryAfter are zero.
+type RateLimitInfo struct {
+	// Limit is X-RateLimit-Limit, the requests allowed per window
+	Limit int
+	// Remaining is X-RateLimit-Remaining, the requests left in the window
+	Remaining int
+	// Reset is X-RateLimit-Reset, when the window resets
+	Reset time.Time
+	// RetryAfter is Retry-After, how long to wait before retrying
+	RetryAfter time.Duration
+}
+
+// resetEpochThreshold separates X-RateLimit-Reset values given as Unix
+// times from ones given as seconds until the reset.
+const resetEpochThreshold = 1_000_000_000
+
+// ParseRateLimitHeaders reads the rate-limit headers of an HTTP response,
+// such as one from an HTTP MCP server, resolving relative values against
+// now. It reports false when the response carries none of them.
+// X-RateLimit-Reset may be a Unix time or seconds from now; Retry-After
+// may be seconds or an HTTP date.
+func ParseRateLimitHeaders(header http.Header, now time.Time) (RateLimitInfo, bool) {
+	info := RateLimitInfo{Limit: -1, Remaining: -1}
+	found := false
+
+	if n, ok := headerInt(header, "X-RateLimit-Limit"); ok {
+		info.Limit = n
+		found = true
+	}
+	if n, ok := headerInt(header, "X-RateLimit-Remaining"); ok {
+		info.Remaining = n
+		found = true
+	}
+	if n, ok := headerInt(header, "X-RateLimit-Reset"); ok {
+		if n >= resetEpochThreshold {
+			info.Reset = time.Unix(int64(n), 0)
+		} else {
+			info.Reset = now.Add(time.Duration(n) * time.Second)
+		}
+		found = true
+	}
+
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+			info.RetryAfter = time.Duration(seconds) * time.Second
+			found = true
+		} else if at, err := http.ParseTime(value); err == nil {
+			if wait := at.Sub(now); wait > 0 {
+				info.RetryAfter = wait
+			}
+			found = true
+		}
+	}
+
+	return info, found
+}
+
+func headerInt(header http.Header, name string) (int, bool) {
+	value := strings.TrimSpace(header.Get(name))
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
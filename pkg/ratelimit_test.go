@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimitHeaders(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		want      RateLimitInfo
+		wantFound bool
+	}{
+		{
+			name:      "window headers",
+			headers:   map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "7", "X-RateLimit-Reset": "1748779260"},
+			want:      RateLimitInfo{Limit: 100, Remaining: 7, Reset: time.Unix(1748779260, 0)},
+			wantFound: true,
+		},
+		{
+			name:      "relative reset",
+			headers:   map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "30"},
+			want:      RateLimitInfo{Limit: -1, Remaining: 0, Reset: now.Add(30 * time.Second)},
+			wantFound: true,
+		},
+		{
+			name:      "retry after seconds",
+			headers:   map[string]string{"Retry-After": "120"},
+			want:      RateLimitInfo{Limit: -1, Remaining: -1, RetryAfter: 2 * time.Minute},
+			wantFound: true,
+		},
+		{
+			name:      "retry after date",
+			headers:   map[string]string{"Retry-After": now.Add(90 * time.Second).Format(http.TimeFormat)},
+			want:      RateLimitInfo{Limit: -1, Remaining: -1, RetryAfter: 90 * time.Second},
+			wantFound: true,
+		},
+		{
+			name:    "no headers",
+			headers: map[string]string{"Content-Type": "application/json"},
+			want:    RateLimitInfo{Limit: -1, Remaining: -1},
+		},
+		{
+			name:    "malformed",
+			headers: map[string]string{"X-RateLimit-Remaining": "lots", "Retry-After": "soon"},
+			want:    RateLimitInfo{Limit: -1, Remaining: -1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Go through a real response so header canonicalization applies
+			recorder := httptest.NewRecorder()
+			for name, value := range tt.headers {
+				recorder.Header().Set(name, value)
+			}
+			recorder.WriteHeader(http.StatusTooManyRequests)
+			resp := recorder.Result()
+
+			got, found := ParseRateLimitHeaders(resp.Header, now)
+			if found != tt.wantFound {
+				t.Errorf("ParseRateLimitHeaders() found = %v, want %v", found, tt.wantFound)
+			}
+			if got.Limit != tt.want.Limit || got.Remaining != tt.want.Remaining ||
+				!got.Reset.Equal(tt.want.Reset) || got.RetryAfter != tt.want.RetryAfter {
+				t.Errorf("ParseRateLimitHeaders() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
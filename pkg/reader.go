@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// responseReader is the io.ReadCloser returned by Client.ResponseReader.
+// Closing it stops the goroutine feeding the pipe.
+type responseReader struct {
+	*io.PipeReader
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (r *responseReader) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	return r.PipeReader.Close()
+}
+
+// ResponseReader returns the current turn's assistant text as a byte
+// stream. Reads block until more text arrives and return io.EOF once the
+// turn's ResultMessage is received. Text blocks are separated by newlines,
+// and AutoContinueOnTruncation continues a truncated turn, as in
+// ResponseText. Messages are consumed from the stream and recorded in
+// the history, so don't read the stream concurrently by other means.
+// Close the reader if you stop reading before EOF.
+func (c *Client) ResponseReader(ctx context.Context) io.ReadCloser {
+	pr, pw := io.Pipe()
+	reader := &responseReader{PipeReader: pr, stop: make(chan struct{})}
+
+	c.mu.Lock()
+	if !c.connected || c.transport == nil {
+		c.mu.Unlock()
+		pw.CloseWithError(fmt.Errorf("client is not connected, call Connect() first"))
+		return reader
+	}
+	msgChan := c.transport.messages
+	errChan := c.transport.errors
+	c.mu.Unlock()
+
+	go func() {
+		wroteText := false
+		// Continuations pick up mid-sentence, so they are joined directly
+		continuing := false
+		for {
+			select {
+			case <-ctx.Done():
+				pw.CloseWithError(ctx.Err())
+				return
+			case <-reader.stop:
+				return
+			case err := <-errChan:
+				pw.CloseWithError(err)
+				return
+			case msg, ok := <-msgChan:
+				if !ok {
+					pw.CloseWithError(io.ErrUnexpectedEOF)
+					return
+				}
+
+				c.record(msg)
+
+				switch m := msg.(type) {
+				case *AssistantMessage:
+					for _, block := range m.Content {
+						text, ok := block.(TextBlock)
+						if !ok {
+							continue
+						}
+						if wroteText && !continuing {
+							text.Text = "\n" + text.Text
+						}
+						// Fails only once the reader has been closed
+						if _, err := io.WriteString(pw, text.Text); err != nil {
+							return
+						}
+						wroteText = true
+						continuing = false
+					}
+				case ResultMessage:
+					// A truncated turn that is continued hasn't ended the text
+					continued, err := c.maybeContinue(ctx, m)
+					if err != nil {
+						pw.CloseWithError(err)
+						return
+					}
+					if continued {
+						continuing = true
+						continue
+					}
+					pw.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	return reader
+}
@@ -0,0 +1,96 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestClient_ResponseReader(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"First paragraph."}]}}'
+    sleep 0.1
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Read","input":{}},{"type":"text","text":"Second paragraph."}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"reader-session"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(nil)
+	if err := client.Connect(ctx, "Write two paragraphs"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	reader := client.ResponseReader(ctx)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if want := "First paragraph.\nSecond paragraph."; string(data) != want {
+		t.Errorf("ResponseReader() text = %q, want %q", data, want)
+	}
+
+	if n := len(client.GetMessages()); n != 3 {
+		t.Errorf("GetMessages() length = %d, want 3", n)
+	}
+
+	// A second turn gets a fresh reader
+	if err := client.SendMessage(ctx, "Again"); err != nil {
+		t.Fatalf("SendMessage() error = %v", err)
+	}
+	second := client.ResponseReader(ctx)
+	defer second.Close()
+	line, err := bufio.NewReader(second).ReadString('.')
+	if err != nil || line != "First paragraph." {
+		t.Errorf("second turn ReadString() = %q, %v", line, err)
+	}
+}
+
+func TestClient_ResponseReaderAutoContinue(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    if echo "$line" | grep -q '"content":"continue"'; then
+        echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":" and then it finished."}]}}'
+        echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"trunc","stopReason":"end_turn"}}}'
+    else
+        echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"The story started"}]}}'
+        echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"trunc","stopReason":"max_tokens"}}}'
+    fi
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{AutoContinueOnTruncation: true})
+	if err := client.Connect(ctx, "Tell me a story"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	reader := client.ResponseReader(ctx)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if want := "The story started and then it finished."; string(data) != want {
+		t.Errorf("ResponseReader() text = %q, want %q", data, want)
+	}
+}
+
+func TestClient_ResponseReaderNotConnected(t *testing.T) {
+	client := NewClient(nil)
+	if _, err := io.ReadAll(client.ResponseReader(context.Background())); err == nil {
+		t.Error("ReadAll() error = nil, want not connected error")
+	}
+}
@@ -0,0 +1,85 @@
+package pkg
+
+// redactMessage returns a copy of msg with redact applied to its text:
+// text and thinking blocks, tool inputs and results, user prompts and
+// system message data. The original message is left untouched so that only
+// logging sinks see the redacted form.
+func redactMessage(msg Message, redact func(string) string) Message {
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		return &AssistantMessage{
+			ID:      m.ID,
+			Role:    m.Role,
+			Content: redactBlocks(m.Content, redact),
+		}
+	case UserMessage:
+		m.Content = redact(m.Content)
+		m.Blocks = redactBlocks(m.Blocks, redact)
+		return m
+	case SystemMessage:
+		m.Data = redactValue(m.Data, redact)
+		m.Raw = nil
+		return m
+	default:
+		return msg
+	}
+}
+
+func redactBlocks(blocks []ContentBlock, redact func(string) string) []ContentBlock {
+	if blocks == nil {
+		return nil
+	}
+
+	result := make([]ContentBlock, 0, len(blocks))
+	for _, block := range blocks {
+		switch b := block.(type) {
+		case TextBlock:
+			b.Text = redact(b.Text)
+			result = append(result, b)
+		case TextDeltaBlock:
+			b.Delta = redact(b.Delta)
+			result = append(result, b)
+		case ThinkingBlock:
+			b.Thinking = redact(b.Thinking)
+			result = append(result, b)
+		case ToolUseBlock:
+			if input, ok := redactValue(b.Input, redact).(map[string]interface{}); ok {
+				b.Input = input
+			}
+			result = append(result, b)
+		case ToolResultBlock:
+			b.Content = redactValue(b.Content, redact)
+			result = append(result, b)
+		case ImageBlock:
+			// Image data has no text to redact
+			result = append(result, b)
+		default:
+			// A block of unknown shape could carry anything, so it is
+			// dropped rather than logged unredacted
+		}
+	}
+	return result
+}
+
+// redactValue applies redact to every string in a decoded JSON value,
+// copying maps and slices rather than modifying them.
+func redactValue(v interface{}, redact func(string) string) interface{} {
+	switch val := v.(type) {
+	case string:
+		return redact(val)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			result[k] = redactValue(item, redact)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, item := range val {
+			result[i] = redactValue(item, redact)
+		}
+		return result
+	default:
+		return v
+	}
+}
@@ -0,0 +1,125 @@
+package pkg
+
+import (
+	"fmt"
+	"time"
+)
+
+// SessionReport is a compact summary of a client session, suitable for
+// logging or for showing the user a receipt.
+type SessionReport struct {
+	Turns       int
+	Usage       ResultUsage
+	Cost        ResultCost
+	ToolUses    map[string]int
+	Duration    time.Duration
+	Interrupted bool
+	CloseReason CloseReason
+	// ShutdownDuration is how long Close took to tear down the CLI; see
+	// Client.LastShutdownDuration.
+	ShutdownDuration time.Duration
+}
+
+// CloseReason records why a client was closed, for attributing closes in
+// logs and metrics.
+type CloseReason string
+
+const (
+	CloseReasonUnspecified CloseReason = ""
+	CloseReasonUserQuit    CloseReason = "user_quit"
+	CloseReasonError       CloseReason = "error"
+	CloseReasonTimeout     CloseReason = "timeout"
+	CloseReasonCompleted   CloseReason = "completed"
+)
+
+// SessionReport aggregates the messages received so far into a summary.
+// Each ResultMessage counts as one turn; the duration runs from Connect
+// until Close, or until now while the session is still open.
+func (c *Client) SessionReport() SessionReport {
+	messages := c.GetMessages()
+
+	c.mu.Lock()
+	startedAt, closedAt := c.startedAt, c.closedAt
+	closeReason := c.closeReason
+	shutdownDuration := c.shutdownDuration
+	c.mu.Unlock()
+
+	report := SessionReport{
+		ToolUses:         make(map[string]int),
+		CloseReason:      closeReason,
+		ShutdownDuration: shutdownDuration,
+	}
+
+	if !startedAt.IsZero() {
+		end := closedAt
+		if end.IsZero() {
+			end = c.options.clock().Now()
+		}
+		report.Duration = end.Sub(startedAt)
+	}
+
+	for _, msg := range messages {
+		switch m := msg.(type) {
+		case *AssistantMessage:
+			for _, block := range m.Content {
+				if toolUse, ok := block.(ToolUseBlock); ok {
+					report.ToolUses[toolUse.Name]++
+				}
+			}
+		case SystemMessage:
+			if m.Subtype == SystemMessageSubtypeInterrupted {
+				report.Interrupted = true
+			}
+		case ResultMessage:
+			report.Turns++
+			report.Usage = addUsage(report.Usage, m.Data.Usage)
+			report.Cost = addCost(report.Cost, m.Data.Cost)
+			if m.Data.InterruptRequested {
+				report.Interrupted = true
+			}
+		}
+	}
+
+	return report
+}
+
+// String renders the report as a single line receipt.
+func (r SessionReport) String() string {
+	tools := 0
+	for _, n := range r.ToolUses {
+		tools += n
+	}
+
+	s := fmt.Sprintf("%d turns, %d in / %d out tokens (%d cache write, %d cache read), $%.4f, %d tool calls, %s",
+		r.Turns, r.Usage.InputTokens, r.Usage.OutputTokens,
+		r.Usage.CacheCreationTokens, r.Usage.CacheReadTokens,
+		r.Cost.TotalCost, tools, r.Duration.Round(time.Millisecond))
+	if r.Interrupted {
+		s += ", interrupted"
+	}
+	if r.CloseReason != CloseReasonUnspecified {
+		s += ", closed: " + string(r.CloseReason)
+	}
+	return s
+}
+
+func addUsage(a, b ResultUsage) ResultUsage {
+	return ResultUsage{
+		InputTokens:         a.InputTokens + b.InputTokens,
+		OutputTokens:        a.OutputTokens + b.OutputTokens,
+		BackgroundTokens:    a.BackgroundTokens + b.BackgroundTokens,
+		CacheCreationTokens: a.CacheCreationTokens + b.CacheCreationTokens,
+		CacheReadTokens:     a.CacheReadTokens + b.CacheReadTokens,
+	}
+}
+
+func addCost(a, b ResultCost) ResultCost {
+	return ResultCost{
+		InputTokenCost:      a.InputTokenCost + b.InputTokenCost,
+		OutputTokenCost:     a.OutputTokenCost + b.OutputTokenCost,
+		BackgroundTokenCost: a.BackgroundTokenCost + b.BackgroundTokenCost,
+		CacheCreationCost:   a.CacheCreationCost + b.CacheCreationCost,
+		CacheReadCost:       a.CacheReadCost + b.CacheReadCost,
+		TotalCost:           a.TotalCost + b.TotalCost,
+	}
+}
@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_SessionReport(t *testing.T) {
+	client := NewClient(nil)
+	client.startedAt = time.Now().Add(-2 * time.Minute)
+	client.closedAt = client.startedAt.Add(90 * time.Second)
+	client.messages = []Message{
+		&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+			TextBlock{Type: "text", Text: "Let me look"},
+			ToolUseBlock{Type: "tool_use", ID: "t1", Name: "Read"},
+			ToolUseBlock{Type: "tool_use", ID: "t2", Name: "Bash"},
+		}},
+		&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+			ToolUseBlock{Type: "tool_use", ID: "t3", Name: "Read"},
+		}},
+		ResultMessage{Role: MessageRoleSystem, Data: ResultMessageData{
+			Usage: ResultUsage{InputTokens: 100, OutputTokens: 50, CacheCreationTokens: 10, CacheReadTokens: 5},
+			Cost:  ResultCost{TotalCost: 0.01},
+		}},
+		&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+			TextBlock{Type: "text", Text: "Done"},
+		}},
+		SystemMessage{Role: MessageRoleSystem, Subtype: SystemMessageSubtypeInterrupted},
+		ResultMessage{Role: MessageRoleSystem, Data: ResultMessageData{
+			Usage: ResultUsage{InputTokens: 200, OutputTokens: 25, CacheReadTokens: 20},
+			Cost:  ResultCost{TotalCost: 0.02},
+		}},
+	}
+
+	report := client.SessionReport()
+
+	if report.Turns != 2 {
+		t.Errorf("Turns = %d, want 2", report.Turns)
+	}
+	wantUsage := ResultUsage{InputTokens: 300, OutputTokens: 75, CacheCreationTokens: 10, CacheReadTokens: 25}
+	if report.Usage != wantUsage {
+		t.Errorf("Usage = %+v, want %+v", report.Usage, wantUsage)
+	}
+	if math.Abs(report.Cost.TotalCost-0.03) > 1e-9 {
+		t.Errorf("Cost.TotalCost = %v, want 0.03", report.Cost.TotalCost)
+	}
+	wantTools := map[string]int{"Read": 2, "Bash": 1}
+	if !reflect.DeepEqual(report.ToolUses, wantTools) {
+		t.Errorf("ToolUses = %v, want %v", report.ToolUses, wantTools)
+	}
+	if report.Duration != 90*time.Second {
+		t.Errorf("Duration = %v, want 1m30s", report.Duration)
+	}
+	if !report.Interrupted {
+		t.Error("Interrupted = false, want true")
+	}
+
+	if s := report.String(); !strings.Contains(s, "2 turns") || !strings.Contains(s, "interrupted") {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestClient_SessionReport_Empty(t *testing.T) {
+	report := NewClient(nil).SessionReport()
+	if report.Turns != 0 || report.Duration != 0 || report.Interrupted {
+		t.Errorf("SessionReport() on unused client = %+v, want zero values", report)
+	}
+}
+
+func TestClient_CloseWithReason(t *testing.T) {
+	setupMockCLI(t)
+
+	tests := []struct {
+		name   string
+		close  func(c *Client) error
+		reason CloseReason
+	}{
+		{name: "unspecified", close: (*Client).Close, reason: CloseReasonUnspecified},
+		{name: "user quit", close: func(c *Client) error { return c.CloseWithReason(CloseReasonUserQuit) }, reason: CloseReasonUserQuit},
+		{name: "timeout", close: func(c *Client) error { return c.CloseWithReason(CloseReasonTimeout) }, reason: CloseReasonTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []SessionReport
+			client := NewClient(&ClaudeCodeOptions{OnClose: func(report SessionReport) {
+				reports = append(reports, report)
+			}})
+			if err := client.Connect(context.Background(), ""); err != nil {
+				t.Fatalf("Connect() error = %v", err)
+			}
+
+			if err := tt.close(client); err != nil {
+				t.Fatalf("close error = %v", err)
+			}
+			// A second close must not report again or change the reason
+			client.CloseWithReason(CloseReasonError)
+
+			if len(reports) != 1 {
+				t.Fatalf("OnClose called %d times, want 1", len(reports))
+			}
+			if reports[0].CloseReason != tt.reason {
+				t.Errorf("OnClose report CloseReason = %q, want %q", reports[0].CloseReason, tt.reason)
+			}
+			if got := client.SessionReport().CloseReason; got != tt.reason {
+				t.Errorf("SessionReport().CloseReason = %q, want %q", got, tt.reason)
+			}
+
+			wantSuffix := ", closed: " + string(tt.reason)
+			if hasSuffix := strings.HasSuffix(reports[0].String(), wantSuffix); hasSuffix != (tt.reason != "") {
+				t.Errorf("String() = %q, want reason suffix only for a specified reason", reports[0].String())
+			}
+		})
+	}
+}
+
+func TestClient_LastShutdownDuration(t *testing.T) {
+	// The mock ignores SIGTERM, so Close has to wait out the grace and kill it
+	setupScriptMockCLI(t, `#!/bin/sh
+trap '' TERM
+while :; do sleep 0.05; done
+`)
+
+	const grace = 150 * time.Millisecond
+	var report SessionReport
+	client := NewClient(&ClaudeCodeOptions{
+		ShutdownGrace: grace,
+		OnClose:       func(r SessionReport) { report = r },
+	})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if got := client.LastShutdownDuration(); got != 0 {
+		t.Errorf("LastShutdownDuration() before Close = %v, want 0", got)
+	}
+
+	// Let the shell install its trap
+	time.Sleep(100 * time.Millisecond)
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got := client.LastShutdownDuration()
+	if got < grace {
+		t.Errorf("LastShutdownDuration() = %v, want at least %v", got, grace)
+	}
+	if report.ShutdownDuration != got {
+		t.Errorf("OnClose report ShutdownDuration = %v, want %v", report.ShutdownDuration, got)
+	}
+}
@@ -0,0 +1,32 @@
+package pkg
+
+import "sync"
+
+// activeSessions tracks the session IDs held by connected clients in this
+// process, so two clients can't append to the same transcript at once.
+var activeSessions = struct {
+	sync.Mutex
+	owners map[string]*Client
+}{
+	owners: make(map[string]*Client),
+}
+
+func claimSession(sessionID string, c *Client) error {
+	activeSessions.Lock()
+	defer activeSessions.Unlock()
+
+	if owner, ok := activeSessions.owners[sessionID]; ok && owner != c {
+		return NewSessionInUseError(sessionID)
+	}
+	activeSessions.owners[sessionID] = c
+	return nil
+}
+
+func releaseSession(sessionID string, c *Client) {
+	activeSessions.Lock()
+	defer activeSessions.Unlock()
+
+	if activeSessions.owners[sessionID] == c {
+		delete(activeSessions.owners, sessionID)
+	}
+}
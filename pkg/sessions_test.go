@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClient_DuplicateSessionID(t *testing.T) {
+	setupMockCLI(t)
+	ctx := context.Background()
+
+	options := &ClaudeCodeOptions{SessionID: "shared-session", ContinueConversation: true}
+	first := NewClient(options)
+	if err := first.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	second := NewClient(options)
+	err := second.Connect(ctx, "")
+	var inUse *SessionInUseError
+	if !errors.As(err, &inUse) {
+		second.Close()
+		t.Fatalf("second Connect() error = %v, want *SessionInUseError", err)
+	}
+	if inUse.SessionID != "shared-session" {
+		t.Errorf("SessionInUseError.SessionID = %s, want shared-session", inUse.SessionID)
+	}
+
+	// Closing the owner frees the session for the next client
+	first.Close()
+	third := NewClient(options)
+	if err := third.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() after Close() error = %v", err)
+	}
+	third.Close()
+}
+
+func TestClient_AllowSharedSession(t *testing.T) {
+	setupMockCLI(t)
+	ctx := context.Background()
+
+	options := &ClaudeCodeOptions{SessionID: "opt-out-session", AllowSharedSession: true}
+	for i := 0; i < 2; i++ {
+		client := NewClient(options)
+		if err := client.Connect(ctx, ""); err != nil {
+			t.Fatalf("Connect() #%d error = %v", i+1, err)
+		}
+		defer client.Close()
+	}
+}
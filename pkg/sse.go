@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// sseEvent is a single event dispatched from a Server-Sent Events stream.
+type sseEvent struct {
+	Event string
+	Data  string
+	ID    string
+}
+
+// sseScanner reads events from a Server-Sent Events stream such as the one
+// served by HTTP/SSE MCP servers. Comment lines (": ping" keep-alives) are
+// skipped so only data-bearing events are yielded.
+type sseScanner struct {
+	scanner *bufio.Scanner
+	event   sseEvent
+}
+
+func newSSEScanner(r io.Reader) *sseScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBufferSize)
+	return &sseScanner{scanner: scanner}
+}
+
+// Scan advances to the next event, returning false at the end of the stream
+// or on a read error. An event left incomplete at EOF is not dispatched.
+func (s *sseScanner) Scan() bool {
+	var data []string
+	var event sseEvent
+
+	for s.scanner.Scan() {
+		line := strings.TrimSuffix(s.scanner.Text(), "\r")
+
+		if line == "" {
+			// A blank line dispatches the event, if it carried any data
+			if data == nil {
+				event = sseEvent{}
+				continue
+			}
+			event.Data = strings.Join(data, "\n")
+			s.event = event
+			return true
+		}
+
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		case "id":
+			event.ID = value
+		}
+	}
+
+	return false
+}
+
+// Event returns the event read by the last successful call to Scan.
+func (s *sseScanner) Event() sseEvent {
+	return s.event
+}
+
+// Err returns the first non-EOF error encountered while reading.
+func (s *sseScanner) Err() error {
+	return s.scanner.Err()
+}
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSSEScanner_SkipsComments(t *testing.T) {
+	stream := strings.Join([]string{
+		": ping",
+		"",
+		"event: message",
+		"data: {\"a\":1}",
+		"",
+		": ping",
+		"data: first line",
+		": keep-alive between fields",
+		"data: second line",
+		"id: 7",
+		"",
+		":",
+		"",
+		"data: incomplete at eof",
+	}, "\n")
+
+	scanner := newSSEScanner(strings.NewReader(stream))
+
+	var got []sseEvent
+	for scanner.Scan() {
+		got = append(got, scanner.Event())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+
+	want := []sseEvent{
+		{Event: "message", Data: `{"a":1}`},
+		{Data: "first line\nsecond line", ID: "7"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+}
+
+func TestSSEScanner_CRLF(t *testing.T) {
+	scanner := newSSEScanner(strings.NewReader(": ping\r\n\r\ndata: hello\r\n\r\n"))
+
+	if !scanner.Scan() {
+		t.Fatal("Scan() = false, want an event")
+	}
+	if got := scanner.Event().Data; got != "hello" {
+		t.Errorf("Data = %q, want %q", got, "hello")
+	}
+	if scanner.Scan() {
+		t.Errorf("Scan() yielded unexpected event %+v", scanner.Event())
+	}
+}
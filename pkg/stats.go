@@ -0,0 +1,64 @@
+package pkg
+
+import "sync"
+
+// StreamStats counts what the read loop made of the CLI's stdout. Lines
+// that are neither parsed nor counted as errors were skipped, such as
+// blank lines and empty messages.
+type StreamStats struct {
+	// Messages counts parsed messages by type, such as "assistant" and
+	// "result". Control responses count as "control_response".
+	Messages map[string]int
+	// ParseErrors counts lines that failed to parse
+	ParseErrors int
+	// SkippedLines counts lines that yielded no message
+	SkippedLines int
+	// BytesRead counts stdout bytes, including line endings
+	BytesRead int64
+}
+
+// streamStats accumulates StreamStats for the read loop
+type streamStats struct {
+	mu    sync.Mutex
+	stats StreamStats
+}
+
+func (s *streamStats) lineRead(n int) {
+	s.mu.Lock()
+	s.stats.BytesRead += int64(n)
+	s.mu.Unlock()
+}
+
+func (s *streamStats) parsed(msgType string) {
+	s.mu.Lock()
+	if s.stats.Messages == nil {
+		s.stats.Messages = make(map[string]int)
+	}
+	s.stats.Messages[msgType]++
+	s.mu.Unlock()
+}
+
+func (s *streamStats) parseError() {
+	s.mu.Lock()
+	s.stats.ParseErrors++
+	s.mu.Unlock()
+}
+
+func (s *streamStats) skipped() {
+	s.mu.Lock()
+	s.stats.SkippedLines++
+	s.mu.Unlock()
+}
+
+// snapshot returns a copy that later reads don't change
+func (s *streamStats) snapshot() StreamStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.stats
+	stats.Messages = make(map[string]int, len(s.stats.Messages))
+	for msgType, n := range s.stats.Messages {
+		stats.Messages[msgType] = n
+	}
+	return stats
+}
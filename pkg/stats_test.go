@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClient_Stats(t *testing.T) {
+	lines := []string{
+		`{"type":"system","message":{"role":"system","subtype":"init","data":{"session_id":"s1"}}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hello"}]}}`,
+		``,
+		`{"type":"assistant","message":null}`,
+		`{"type":"assistant","message":`,
+		`{"type":"control_response","request_id":"req_unknown","response":{"success":true}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"world"}]}}`,
+		`{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}`,
+	}
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\nread line\n")
+	var bytesRead int64
+	for _, line := range lines {
+		script.WriteString("echo '" + line + "'\n")
+		bytesRead += int64(len(line) + 1)
+	}
+	script.WriteString("while IFS= read -r line; do :; done\n")
+	setupScriptMockCLI(t, script.String())
+
+	ctx := context.Background()
+	client := NewClient(nil)
+	if got := client.Stats(); len(got.Messages) != 0 || got.BytesRead != 0 {
+		t.Errorf("Stats() before Connect = %+v, want zero", got)
+	}
+	if err := client.Connect(ctx, "Hi"); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	for range client.ReceiveResponse(ctx) {
+	}
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	got := client.Stats()
+	wantMessages := map[string]int{"system": 1, "assistant": 2, "control_response": 1, "result": 1}
+	if !reflect.DeepEqual(got.Messages, wantMessages) {
+		t.Errorf("Stats().Messages = %v, want %v", got.Messages, wantMessages)
+	}
+	if got.ParseErrors != 1 {
+		t.Errorf("Stats().ParseErrors = %d, want 1", got.ParseErrors)
+	}
+	if got.SkippedLines != 2 {
+		t.Errorf("Stats().SkippedLines = %d, want 2", got.SkippedLines)
+	}
+	if got.BytesRead != bytesRead {
+		t.Errorf("Stats().BytesRead = %d, want %d", got.BytesRead, bytesRead)
+	}
+
+	// A snapshot is a copy
+	got.Messages["assistant"] = 100
+	if n := client.Stats().Messages["assistant"]; n != 2 {
+		t.Errorf("Stats().Messages[assistant] = %d after modifying an earlier snapshot, want 2", n)
+	}
+}
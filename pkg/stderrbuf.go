@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// stderrBuffer keeps the start and the end of a CLI's stderr within a
+// fixed size: the first headSize bytes, and after those the most recent
+// tailSize bytes in a ring. A crashing CLI's final error survives however
+// much it logged before.
+type stderrBuffer struct {
+	headSize int
+	tailSize int
+	head     []byte
+	// tail is a ring once full, with its oldest byte at next
+	tail    []byte
+	next    int
+	written int
+}
+
+func newStderrBuffer(size int) *stderrBuffer {
+	headSize := size / 2
+	return &stderrBuffer{headSize: headSize, tailSize: size - headSize}
+}
+
+func (b *stderrBuffer) Write(p []byte) (int, error) {
+	total := len(p)
+	b.written += total
+
+	if room := b.headSize - len(b.head); room > 0 {
+		n := len(p)
+		if n > room {
+			n = room
+		}
+		b.head = append(b.head, p[:n]...)
+		p = p[n:]
+	}
+	if len(p) == 0 || b.tailSize == 0 {
+		return total, nil
+	}
+
+	if len(p) >= b.tailSize {
+		b.tail = append(b.tail[:0], p[len(p)-b.tailSize:]...)
+		b.next = 0
+		return total, nil
+	}
+	if room := b.tailSize - len(b.tail); room > 0 {
+		n := len(p)
+		if n > room {
+			n = room
+		}
+		b.tail = append(b.tail, p[:n]...)
+		p = p[n:]
+	}
+	for len(p) > 0 {
+		n := copy(b.tail[b.next:], p)
+		p = p[n:]
+		b.next = (b.next + n) % b.tailSize
+	}
+	return total, nil
+}
+
+// Len returns the number of bytes written, including any dropped.
+func (b *stderrBuffer) Len() int { return b.written }
+
+// String returns the retained stderr. When bytes were dropped between the
+// head and the tail a marker says how many, and the tail starts at its
+// first full line.
+func (b *stderrBuffer) String() string {
+	tail := append(append(make([]byte, 0, len(b.tail)), b.tail[b.next:]...), b.tail[:b.next]...)
+
+	dropped := b.written - len(b.head) - len(b.tail)
+	if dropped == 0 {
+		return string(b.head) + string(tail)
+	}
+
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i+1 < len(tail) {
+		dropped += i + 1
+		tail = tail[i+1:]
+	}
+	return fmt.Sprintf("%s\n... %d bytes of stderr omitted ...\n%s", b.head, dropped, tail)
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestStderrBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		writes []string
+		want   string
+	}{
+		{name: "under the limit", size: 64, writes: []string{"starting\n", "ready\n"}, want: "starting\nready\n"},
+		{name: "exactly full", size: 8, writes: []string{"abcd", "efgh"}, want: "abcdefgh"},
+		{
+			name:   "tail wraps",
+			size:   16,
+			writes: []string{"head1\nhe", "ad2\n", "noise\n", "tail1\n", "tail2\n"},
+			want:   "head1\nhe\n... 16 bytes of stderr omitted ...\ntail2\n",
+		},
+		{
+			name:   "write larger than the tail",
+			size:   16,
+			writes: []string{"12345678", strings.Repeat("x", 40) + "\nfatal\n"},
+			want:   "12345678\n... 41 bytes of stderr omitted ...\nfatal\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newStderrBuffer(tt.size)
+			total := 0
+			for _, w := range tt.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v, want %d, nil", w, n, err, len(w))
+				}
+				total += len(w)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+			if b.Len() != total {
+				t.Errorf("Len() = %d, want %d", b.Len(), total)
+			}
+		})
+	}
+}
+
+func TestStderrBuffer_FloodKeepsFinalLine(t *testing.T) {
+	const size = 4096
+	b := newStderrBuffer(size)
+
+	b.Write([]byte("cli v1.2.3 starting\n"))
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(b, "debug: polling tool %d\n", i)
+	}
+	b.Write([]byte("Error: ENOSPC: no space left on device\n"))
+
+	got := b.String()
+	if !strings.HasPrefix(got, "cli v1.2.3 starting\n") {
+		t.Errorf("String() lost the head: %q", got[:64])
+	}
+	if !strings.HasSuffix(got, "Error: ENOSPC: no space left on device\n") {
+		t.Errorf("String() lost the final error: %q", got[len(got)-64:])
+	}
+	if !strings.Contains(got, "bytes of stderr omitted") {
+		t.Error("String() does not mark the omitted middle")
+	}
+	if len(got) > size+64 {
+		t.Errorf("len(String()) = %d, want about %d", len(got), size)
+	}
+}
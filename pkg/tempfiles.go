@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"os"
+)
+
+// checkTempDir verifies that dir exists and that files can be created in
+// it, so a locked-down directory fails at launch rather than midway.
+func checkTempDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewInvalidOptionError("TempDir", dir, "directory does not exist")
+		}
+		return NewInvalidOptionError("TempDir", dir, err.Error())
+	}
+	if !info.IsDir() {
+		return NewInvalidOptionError("TempDir", dir, "not a directory")
+	}
+
+	probe, err := os.CreateTemp(dir, ".claude-sdk-probe-*")
+	if err != nil {
+		return NewInvalidOptionError("TempDir", dir, "directory is not writable")
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// createTempFile writes data to a new file in dir, or the system temp
+// directory when dir is empty, and returns its path. pattern is as for
+// os.CreateTemp.
+func createTempFile(dir, pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	path := f.Name()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// writeTempFile writes data to a new file in the configured TempDir and
+// tracks it for removal when the transport closes.
+func (t *transport) writeTempFile(pattern string, data []byte) (string, error) {
+	path, err := createTempFile(t.options.TempDir, pattern, data)
+	if err != nil {
+		return "", err
+	}
+
+	t.mu.Lock()
+	t.tempFiles = append(t.tempFiles, path)
+	t.mu.Unlock()
+	return path, nil
+}
+
+// removeTempFiles deletes every file created by writeTempFile.
+func (t *transport) removeTempFiles() {
+	t.mu.Lock()
+	files := t.tempFiles
+	t.tempFiles = nil
+	t.mu.Unlock()
+
+	for _, path := range files {
+		os.Remove(path)
+	}
+}
@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTransport_TempFiles(t *testing.T) {
+	setupMockCLI(t)
+	tempDir := t.TempDir()
+
+	transport, err := newTransport(context.Background(), &ClaudeCodeOptions{TempDir: tempDir}, true)
+	if err != nil {
+		t.Fatalf("newTransport() error = %v", err)
+	}
+
+	path, err := transport.writeTempFile("claude-test-*.json", []byte(`{"ok":true}`))
+	if err != nil {
+		t.Fatalf("writeTempFile() error = %v", err)
+	}
+	if filepath.Dir(path) != tempDir {
+		t.Errorf("writeTempFile() path = %s, want it in %s", path, tempDir)
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != `{"ok":true}` {
+		t.Errorf("temp file content = %q, %v, want the written data", data, err)
+	}
+
+	transport.close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("temp file still exists after close: %v", err)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("TempDir has %d leftover entries, want 0", len(entries))
+	}
+}
+
+func TestClaudeCodeOptions_ValidateTempDir(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(file, []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	readOnly := filepath.Join(tmpDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		dir     string
+		wantErr bool
+		// Root can write anywhere, so permissions can't make it fail
+		skipAsRoot bool
+	}{
+		{name: "unset", dir: ""},
+		{name: "writable directory", dir: tmpDir},
+		{name: "missing directory", dir: filepath.Join(tmpDir, "missing"), wantErr: true},
+		{name: "regular file", dir: file, wantErr: true},
+		{name: "read-only directory", dir: readOnly, wantErr: true, skipAsRoot: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.skipAsRoot && os.Geteuid() == 0 {
+				t.Skip("running as root")
+			}
+
+			err := (&ClaudeCodeOptions{TempDir: tt.dir}).Validate()
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var optErr *InvalidOptionError
+			if !errors.As(err, &optErr) || optErr.Option != "TempDir" {
+				t.Errorf("Validate() error = %v, want *InvalidOptionError for TempDir", err)
+			}
+		})
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // MockCLIResponse represents a response from the mock CLI
@@ -16,44 +20,91 @@ type MockCLIResponse struct {
 
 // CreateMockCLI creates a mock CLI that responds with the given messages
 func CreateMockCLI(t *testing.T, responses []interface{}) {
+	NewMockCLI(t, responses...).Install()
+}
+
+// MockCLI is a scriptable stand-in for the Claude CLI. It writes its
+// responses to stdout in order, optionally pausing before some of them.
+type MockCLI struct {
+	t         *testing.T
+	responses []interface{}
+	delays    map[int]time.Duration
+	clock     *FakeClock
+}
+
+// NewMockCLI creates a mock CLI that responds with the given messages.
+// Call Install to put it on PATH.
+func NewMockCLI(t *testing.T, responses ...interface{}) *MockCLI {
+	return &MockCLI{
+		t:         t,
+		responses: responses,
+		delays:    make(map[int]time.Duration),
+	}
+}
+
+// WithDelay makes the mock wait d before writing response idx, measured
+// from the previous response (or from launch for the first).
+func (m *MockCLI) WithDelay(idx int, d time.Duration) *MockCLI {
+	m.delays[idx] = d
+	return m
+}
+
+// WithClock makes delays elapse on clock instead of in real time: a delayed
+// response is only written once the test advances clock past it. Pass the
+// same clock as ClaudeCodeOptions.Clock so the SDK observes the same time.
+// Delays are scheduled from the clock's time at Install.
+func (m *MockCLI) WithClock(clock *FakeClock) *MockCLI {
+	m.clock = clock
+	return m
+}
+
+// Install writes the mock as both 'claude' and 'claude-code' and prepends
+// it to PATH for the rest of the test.
+func (m *MockCLI) Install() {
+	t := m.t
 	tmpDir := t.TempDir()
-	
-	// Create response file with properly formatted JSON
-	responsesFile := filepath.Join(tmpDir, "responses.json")
-	var jsonLines []string
-	
-	for _, resp := range responses {
+
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n# Mock Claude CLI for testing\n")
+
+	var offset time.Duration
+	for i, resp := range m.responses {
 		data, err := json.Marshal(resp)
 		if err != nil {
 			t.Fatalf("Failed to marshal response: %v", err)
 		}
-		jsonLines = append(jsonLines, string(data))
-	}
-	
-	responseContent := ""
-	for _, line := range jsonLines {
-		responseContent += line + "\n"
-	}
-	
-	if err := os.WriteFile(responsesFile, []byte(responseContent), 0644); err != nil {
-		t.Fatalf("Failed to write responses file: %v", err)
+		respFile := filepath.Join(tmpDir, fmt.Sprintf("response_%d.json", i))
+		if err := os.WriteFile(respFile, append(data, '\n'), 0644); err != nil {
+			t.Fatalf("Failed to write response file: %v", err)
+		}
+
+		if d, ok := m.delays[i]; ok && d > 0 {
+			if m.clock != nil {
+				// Poll for a gate file the fake clock creates when due
+				offset += d
+				gate := filepath.Join(tmpDir, fmt.Sprintf("gate_%d", i))
+				m.clock.AfterFunc(offset, func() {
+					os.WriteFile(gate, nil, 0644)
+				})
+				fmt.Fprintf(&script, "while [ ! -e %s ]; do sleep 0.01; done\n", gate)
+			} else {
+				fmt.Fprintf(&script, "sleep %.3f\n", d.Seconds())
+			}
+		}
+		fmt.Fprintf(&script, "cat %s\n", respFile)
 	}
-	
-	// Create mock CLI script
-	script := fmt.Sprintf(`#!/bin/sh
-# Mock Claude CLI for testing
-# Read responses from file and output them
-cat %s
-`, responsesFile)
-	
+
 	// Create both 'claude' and 'claude-code' executables
 	for _, name := range []string{"claude", "claude-code"} {
 		mockPath := filepath.Join(tmpDir, name)
-		if err := os.WriteFile(mockPath, []byte(script), 0755); err != nil {
+		if err := os.WriteFile(mockPath, []byte(script.String()), 0755); err != nil {
 			t.Fatalf("Failed to create mock %s: %v", name, err)
 		}
 	}
-	
+
+	t.Cleanup(RegisterMockCLI(filepath.Join(tmpDir, "claude")))
+	t.Cleanup(RegisterMockCLI(filepath.Join(tmpDir, "claude-code")))
+
 	// Update PATH
 	oldPath := os.Getenv("PATH")
 	os.Setenv("PATH", tmpDir+":"+oldPath)
@@ -62,6 +113,99 @@ cat %s
 	})
 }
 
+// FakeClock is a Clock that only moves when Advance is called
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFakeClock creates a FakeClock set to start
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	return c.addTimer(d, nil)
+}
+
+// AfterFunc calls f once the clock has been advanced by d
+func (c *FakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.addTimer(d, f)
+}
+
+func (c *FakeClock) addTimer(d time.Duration, f func()) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{
+		clock:    c,
+		deadline: c.now.Add(d),
+		ch:       make(chan time.Time, 1),
+		fn:       f,
+	}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward by d, firing every timer that comes due
+// in deadline order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+
+	var due, pending []*fakeTimer
+	for _, timer := range c.timers {
+		if timer.deadline.After(now) {
+			pending = append(pending, timer)
+		} else {
+			due = append(due, timer)
+		}
+	}
+	c.timers = pending
+	c.mu.Unlock()
+
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].deadline.Before(due[j].deadline)
+	})
+	for _, timer := range due {
+		if timer.fn != nil {
+			timer.fn()
+		} else {
+			timer.ch <- now
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	ch       chan time.Time
+	fn       func()
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, timer := range t.clock.timers {
+		if timer == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // CreateAssistantMessage creates a properly formatted assistant message
 func CreateAssistantMessage(content []ContentBlock) interface{} {
 	msg := AssistantMessage{
@@ -94,7 +238,11 @@ func CreateResultMessage(sessionID string, inputTokens, outputTokens int, totalC
 		},
 	}
 	
-	data, _ := json.Marshal(msg)
+	// The parser recognizes results by their subtype
+	data, _ := json.Marshal(struct {
+		ResultMessage
+		Subtype string `json:"subtype"`
+	}{msg, "result"})
 	return MockCLIResponse{
 		Type:    "system",
 		Message: data,
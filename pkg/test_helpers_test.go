@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Second)
+	var fired bool
+	clock.AfterFunc(2*time.Second, func() { fired = true })
+	stopped := clock.NewTimer(time.Second)
+	if !stopped.Stop() {
+		t.Error("Stop() = false, want true for a pending timer")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired before its deadline")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case got := <-timer.C():
+		if want := start.Add(time.Second); !got.Equal(want) {
+			t.Errorf("timer fired at %v, want %v", got, want)
+		}
+	default:
+		t.Fatal("timer did not fire at its deadline")
+	}
+	select {
+	case <-stopped.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if fired {
+		t.Error("AfterFunc ran before its deadline")
+	}
+
+	clock.Advance(time.Second)
+	if !fired {
+		t.Error("AfterFunc did not run at its deadline")
+	}
+	if got := clock.Now(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("Now() = %v, want %v", got, start.Add(2*time.Second))
+	}
+}
+
+func TestMockCLI_WithDelay(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	NewMockCLI(t,
+		CreateAssistantMessage([]ContentBlock{TextBlock{Type: "text", Text: "Thinking..."}}),
+		CreateResultMessage("delay-session", 5, 10, 0.01),
+	).WithDelay(1, 5*time.Second).WithClock(clock).Install()
+
+	var log bytes.Buffer
+	client := NewClient(&ClaudeCodeOptions{Clock: clock, MessageLogWriter: &log})
+	if err := client.Connect(context.Background(), ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	sub, unsubscribe := client.Subscribe(10)
+	defer unsubscribe()
+
+	next := func() (Message, bool) {
+		select {
+		case msg := <-sub:
+			return msg, true
+		case <-time.After(200 * time.Millisecond):
+			return nil, false
+		}
+	}
+
+	if msg, ok := next(); !ok || msg.GetType() != "assistant" {
+		t.Fatalf("first message = %v, want the assistant message", msg)
+	}
+
+	// The result is held back until the fake clock reaches the delay
+	clock.Advance(4 * time.Second)
+	if msg, ok := next(); ok {
+		t.Fatalf("got %v before the delay elapsed", msg)
+	}
+	clock.Advance(time.Second)
+	if msg, ok := next(); !ok || msg.GetType() != "result" {
+		t.Fatalf("message after delay = %v, want the result", msg)
+	}
+
+	client.Close()
+
+	// The SDK timestamps messages with the same clock
+	var latencies []float64
+	scanner := bufio.NewScanner(&log)
+	for scanner.Scan() {
+		var entry struct {
+			LatencyMs float64 `json:"latencyMs"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Invalid log line: %v", err)
+		}
+		latencies = append(latencies, entry.LatencyMs)
+	}
+	if len(latencies) != 2 || latencies[0] != 0 || latencies[1] != 5000 {
+		t.Errorf("logged latencies = %v, want [0 5000]", latencies)
+	}
+}
@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"path"
+	"strings"
+)
+
+type ToolEffect string
+
+const (
+	ToolAllow ToolEffect = "allow"
+	ToolDeny  ToolEffect = "deny"
+)
+
+// ToolRule allows or denies a tool, optionally only for inputs matching
+// Pattern. For Bash, Pattern matches the command: "git:*" matches any
+// command starting with "git", anything else must match exactly. For other
+// tools it is a glob on the file path input, where a trailing "/**"
+// matches everything below a directory. An empty Pattern or a Tool of "*"
+// matches any input or tool respectively.
+type ToolRule struct {
+	Tool    string
+	Pattern string
+	Effect  ToolEffect
+}
+
+// AllowToolRule returns a rule allowing tool for inputs matching pattern
+func AllowToolRule(tool, pattern string) ToolRule {
+	return ToolRule{Tool: tool, Pattern: pattern, Effect: ToolAllow}
+}
+
+// DenyToolRule returns a rule denying tool for inputs matching pattern
+func DenyToolRule(tool, pattern string) ToolRule {
+	return ToolRule{Tool: tool, Pattern: pattern, Effect: ToolDeny}
+}
+
+// String formats the rule the way the CLI's tool flags expect, e.g.
+// "Bash(git:*)".
+func (r ToolRule) String() string {
+	if r.Pattern == "" {
+		return r.Tool
+	}
+	return r.Tool + "(" + r.Pattern + ")"
+}
+
+// ToolPolicy is a structured alternative to AllowedTools and
+// DisallowedTools. Precedence follows the CLI: a matching deny rule always
+// wins, then a matching allow rule, then Default. Rule order only
+// determines the order of the compiled flags.
+type ToolPolicy struct {
+	// Default applies to tools no rule matches. The CLI has no flag for
+	// "allow everything else", so ToolAllow also needs a PermissionMode
+	// that approves unlisted tools.
+	Default ToolEffect
+	Rules   []ToolRule
+}
+
+// clone returns a copy of p that shares no rules with it.
+func (p *ToolPolicy) clone() *ToolPolicy {
+	c := *p
+	c.Rules = append([]ToolRule(nil), p.Rules...)
+	return &c
+}
+
+// Compile converts the policy into the CLI's allowed and disallowed tool
+// lists.
+func (p *ToolPolicy) Compile() (allowed, disallowed []string) {
+	for _, rule := range p.Rules {
+		switch rule.Effect {
+		case ToolAllow:
+			allowed = append(allowed, rule.String())
+		case ToolDeny:
+			disallowed = append(disallowed, rule.String())
+		}
+	}
+	return allowed, disallowed
+}
+
+// IsToolAllowed evaluates the policy for a call to tool with the given
+// input, as the CLI would.
+func (p *ToolPolicy) IsToolAllowed(tool string, input map[string]interface{}) bool {
+	allowed := false
+	for _, rule := range p.Rules {
+		if !rule.matches(tool, input) {
+			continue
+		}
+		if rule.Effect == ToolDeny {
+			return false
+		}
+		if rule.Effect == ToolAllow {
+			allowed = true
+		}
+	}
+	return allowed || p.Default == ToolAllow
+}
+
+func (r ToolRule) matches(tool string, input map[string]interface{}) bool {
+	if r.Tool != "*" && r.Tool != tool {
+		return false
+	}
+	if r.Pattern == "" {
+		return true
+	}
+
+	if tool == "Bash" {
+		command, _ := input["command"].(string)
+		if prefix, ok := strings.CutSuffix(r.Pattern, ":*"); ok {
+			return strings.HasPrefix(command, prefix)
+		}
+		return command == r.Pattern
+	}
+
+	for _, key := range []string{"file_path", "path", "notebook_path"} {
+		if p, ok := input[key].(string); ok {
+			return matchPathPattern(r.Pattern, p)
+		}
+	}
+	return false
+}
+
+func matchPathPattern(pattern, p string) bool {
+	if dir, ok := strings.CutSuffix(pattern, "/**"); ok {
+		return p == dir || strings.HasPrefix(p, dir+"/")
+	}
+	matched, err := path.Match(pattern, p)
+	return err == nil && matched
+}
@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func examplePolicy() *ToolPolicy {
+	return &ToolPolicy{
+		Default: ToolDeny,
+		Rules: []ToolRule{
+			AllowToolRule("Read", ""),
+			AllowToolRule("Bash", "git:*"),
+			AllowToolRule("Write", ""),
+			DenyToolRule("Write", "/etc/**"),
+		},
+	}
+}
+
+func TestToolPolicy_Compile(t *testing.T) {
+	allowed, disallowed := examplePolicy().Compile()
+
+	if want := []string{"Read", "Bash(git:*)", "Write"}; !reflect.DeepEqual(allowed, want) {
+		t.Errorf("Compile() allowed = %v, want %v", allowed, want)
+	}
+	if want := []string{"Write(/etc/**)"}; !reflect.DeepEqual(disallowed, want) {
+		t.Errorf("Compile() disallowed = %v, want %v", disallowed, want)
+	}
+}
+
+func TestToolPolicy_IsToolAllowed(t *testing.T) {
+	policy := examplePolicy()
+
+	tests := []struct {
+		name  string
+		tool  string
+		input map[string]interface{}
+		want  bool
+	}{
+		{"read anywhere", "Read", map[string]interface{}{"file_path": "/etc/passwd"}, true},
+		{"git command", "Bash", map[string]interface{}{"command": "git status"}, true},
+		{"other command", "Bash", map[string]interface{}{"command": "rm -rf /"}, false},
+		{"write in project", "Write", map[string]interface{}{"file_path": "/src/main.go"}, true},
+		{"write under /etc", "Write", map[string]interface{}{"file_path": "/etc/hosts"}, false},
+		{"write /etc itself", "Write", map[string]interface{}{"file_path": "/etc"}, false},
+		{"unlisted tool falls back to default", "WebFetch", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.IsToolAllowed(tt.tool, tt.input); got != tt.want {
+				t.Errorf("IsToolAllowed(%s, %v) = %v, want %v", tt.tool, tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolPolicy_Precedence(t *testing.T) {
+	// Deny wins regardless of order, and wildcards match every tool
+	policy := &ToolPolicy{
+		Default: ToolAllow,
+		Rules: []ToolRule{
+			AllowToolRule("Edit", "*.go"),
+			DenyToolRule("*", ""),
+		},
+	}
+	if policy.IsToolAllowed("Edit", map[string]interface{}{"file_path": "main.go"}) {
+		t.Error("IsToolAllowed() = true, want deny to take precedence over an earlier allow")
+	}
+
+	policy = &ToolPolicy{Default: ToolAllow, Rules: []ToolRule{DenyToolRule("Bash", "curl:*")}}
+	if !policy.IsToolAllowed("Bash", map[string]interface{}{"command": "ls"}) {
+		t.Error("IsToolAllowed() = false, want default allow for unmatched input")
+	}
+	if !policy.IsToolAllowed("Edit", map[string]interface{}{"file_path": "main.go"}) {
+		t.Error("IsToolAllowed() = false, want default allow for unmatched tool")
+	}
+}
+
+func TestOptionArgs_ToolPolicy(t *testing.T) {
+	args := optionArgs(&ClaudeCodeOptions{
+		AllowedTools: []string{"Grep"},
+		ToolPolicy:   examplePolicy(),
+	})
+	joined := strings.Join(args, " ")
+
+	if !strings.Contains(joined, "--allowed-tools Grep,Read,Bash(git:*),Write") {
+		t.Errorf("optionArgs() = %v, want policy rules merged into --allowed-tools", args)
+	}
+	if !strings.Contains(joined, "--disallowed-tools Write(/etc/**)") {
+		t.Errorf("optionArgs() = %v, want policy deny rules in --disallowed-tools", args)
+	}
+}
@@ -0,0 +1,150 @@
+package pkg
+
+import "context"
+
+// Tracer starts spans for queries, turns and tool calls. It mirrors the
+// shape of an OpenTelemetry trace.Tracer so one can be adapted in a few
+// lines without this package depending on OpenTelemetry.
+type Tracer interface {
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...SpanAttribute)
+	RecordError(err error)
+	End()
+}
+
+// SpanAttribute is a key/value pair set on a Span. Values are strings,
+// ints, float64s or bools.
+type SpanAttribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Span names and attribute keys used by the SDK.
+const (
+	SpanNameQuery = "claude.query"
+	SpanNameTurn  = "claude.turn"
+	SpanNameTool  = "claude.tool"
+
+	AttrModel        = "claude.model"
+	AttrSessionID    = "claude.session_id"
+	AttrInputTokens  = "claude.input_tokens"
+	AttrOutputTokens = "claude.output_tokens"
+	AttrCostUSD      = "claude.cost_usd"
+	AttrToolCount    = "claude.tool_count"
+	AttrInterrupted  = "claude.interrupted"
+	AttrToolName     = "claude.tool.name"
+	AttrToolID       = "claude.tool.id"
+	AttrToolIsError  = "claude.tool.is_error"
+)
+
+// turnSpan traces one query or turn, with a child span per tool call. All
+// methods are no-ops on a nil *turnSpan, which is what startTurnSpan
+// returns without a Tracer.
+type turnSpan struct {
+	tracer    Tracer
+	ctx       context.Context
+	span      Span
+	tools     map[string]Span
+	toolCount int
+	model     string
+	ended     bool
+}
+
+func startTurnSpan(ctx context.Context, tracer Tracer, name string) *turnSpan {
+	if tracer == nil {
+		return nil
+	}
+	spanCtx, span := tracer.Start(ctx, name)
+	return &turnSpan{
+		tracer: tracer,
+		ctx:    spanCtx,
+		span:   span,
+		tools:  make(map[string]Span),
+	}
+}
+
+// observe updates the span from a message of the traced turn: tool_use
+// blocks start tool spans, tool_result blocks end them, and the result
+// sets the turn's attributes.
+func (s *turnSpan) observe(msg Message) {
+	if s == nil || s.ended {
+		return
+	}
+
+	if model := initModel(msg); model != "" {
+		s.model = model
+	}
+
+	switch m := msg.(type) {
+	case *AssistantMessage:
+		for _, block := range m.Content {
+			switch b := block.(type) {
+			case ToolUseBlock:
+				if _, open := s.tools[b.ID]; open {
+					continue
+				}
+				_, span := s.tracer.Start(s.ctx, SpanNameTool)
+				span.SetAttributes(
+					SpanAttribute{Key: AttrToolName, Value: b.Name},
+					SpanAttribute{Key: AttrToolID, Value: b.ID},
+				)
+				s.tools[b.ID] = span
+				s.toolCount++
+			case ToolResultBlock:
+				s.endTool(b)
+			}
+		}
+	case UserMessage:
+		// The CLI echoes tool results back as user messages
+		for _, block := range m.Blocks {
+			if b, ok := block.(ToolResultBlock); ok {
+				s.endTool(b)
+			}
+		}
+	case ResultMessage:
+		model := m.Data.Model
+		if model == "" {
+			model = s.model
+		}
+		s.span.SetAttributes(
+			SpanAttribute{Key: AttrModel, Value: model},
+			SpanAttribute{Key: AttrSessionID, Value: m.Data.SessionID},
+			SpanAttribute{Key: AttrInputTokens, Value: m.Data.Usage.InputTokens},
+			SpanAttribute{Key: AttrOutputTokens, Value: m.Data.Usage.OutputTokens},
+			SpanAttribute{Key: AttrCostUSD, Value: m.Data.Cost.TotalCost},
+			SpanAttribute{Key: AttrToolCount, Value: s.toolCount},
+			SpanAttribute{Key: AttrInterrupted, Value: m.Data.InterruptRequested},
+		)
+	}
+}
+
+// endTool ends the span of the tool call that result answers
+func (s *turnSpan) endTool(result ToolResultBlock) {
+	if span, open := s.tools[result.ToolUseID]; open {
+		span.SetAttributes(SpanAttribute{Key: AttrToolIsError, Value: result.IsError})
+		span.End()
+		delete(s.tools, result.ToolUseID)
+	}
+}
+
+// end finishes any open tool spans and then the turn span, recording err
+// if the turn failed. Only the first call has any effect.
+func (s *turnSpan) end(err error) {
+	if s == nil || s.ended {
+		return
+	}
+	s.ended = true
+
+	for id, span := range s.tools {
+		span.End()
+		delete(s.tools, id)
+	}
+	if err != nil {
+		s.span.RecordError(err)
+	}
+	s.span.End()
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedSpan struct {
+	name   string
+	parent *recordedSpan
+	attrs  map[string]interface{}
+	err    error
+	ended  bool
+}
+
+type recordedSpanKey struct{}
+
+func (s *recordedSpan) SetAttributes(attrs ...SpanAttribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	parent, _ := ctx.Value(recordedSpanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, parent: parent, attrs: make(map[string]interface{})}
+	r.spans = append(r.spans, span)
+	return context.WithValue(ctx, recordedSpanKey{}, span), span
+}
+
+func (r *recordingTracer) named(name string) []*recordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var spans []*recordedSpan
+	for _, span := range r.spans {
+		if span.name == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestQuery_Tracer(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tool-1","name":"Read","input":{}},{"type":"tool_use","id":"tool-2","name":"Bash","input":{}}]}}'
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_result","tool_use_id":"tool-1","content":"ok"},{"type":"tool_result","tool_use_id":"tool-2","content":"failed","is_error":true}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":12,"outputTokens":34},"cost":{"totalCost":0.05},"sessionId":"s1","model":"claude-test"}}}'
+`)
+
+	tracer := &recordingTracer{}
+	if _, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{Tracer: tracer}); err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	queries := tracer.named(SpanNameQuery)
+	if len(queries) != 1 {
+		t.Fatalf("got %d query spans, want 1", len(queries))
+	}
+	query := queries[0]
+	if !query.ended || query.err != nil {
+		t.Errorf("query span ended = %v, err = %v, want ended without error", query.ended, query.err)
+	}
+
+	wantAttrs := map[string]interface{}{
+		AttrModel:        "claude-test",
+		AttrSessionID:    "s1",
+		AttrInputTokens:  12,
+		AttrOutputTokens: 34,
+		AttrCostUSD:      0.05,
+		AttrToolCount:    2,
+		AttrInterrupted:  false,
+	}
+	for key, want := range wantAttrs {
+		if got := query.attrs[key]; got != want {
+			t.Errorf("query span %s = %v, want %v", key, got, want)
+		}
+	}
+
+	tools := tracer.named(SpanNameTool)
+	if len(tools) != 2 {
+		t.Fatalf("got %d tool spans, want 2", len(tools))
+	}
+	wantTools := []struct {
+		name    string
+		isError bool
+	}{{"Read", false}, {"Bash", true}}
+	for i, tool := range tools {
+		if tool.parent != query {
+			t.Errorf("tool span %d is not a child of the query span", i)
+		}
+		if !tool.ended {
+			t.Errorf("tool span %d was not ended", i)
+		}
+		if tool.attrs[AttrToolName] != wantTools[i].name || tool.attrs[AttrToolIsError] != wantTools[i].isError {
+			t.Errorf("tool span %d attrs = %v, want name %s is_error %v", i, tool.attrs, wantTools[i].name, wantTools[i].isError)
+		}
+	}
+}
+
+func TestClient_TracerTurns(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+while IFS= read -r line; do
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Hi"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":2},"cost":{"totalCost":0.01},"sessionId":"s1"}}}'
+done
+`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tracer := &recordingTracer{}
+	client := NewClient(&ClaudeCodeOptions{Tracer: tracer})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if err := client.SendMessage(ctx, "Hello"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+		if _, err := client.WaitForResult(ctx); err != nil {
+			t.Fatalf("WaitForResult() error = %v", err)
+		}
+	}
+
+	turns := tracer.named(SpanNameTurn)
+	if len(turns) != 2 {
+		t.Fatalf("got %d turn spans, want 2", len(turns))
+	}
+	for i, turn := range turns {
+		if !turn.ended {
+			t.Errorf("turn span %d was not ended", i)
+		}
+		if turn.attrs[AttrOutputTokens] != 2 {
+			t.Errorf("turn span %d %s = %v, want 2", i, AttrOutputTokens, turn.attrs[AttrOutputTokens])
+		}
+	}
+}
+
+func TestTurnSpan_ToolResultInUserMessage(t *testing.T) {
+	tracer := &recordingTracer{}
+	span := startTurnSpan(context.Background(), tracer, SpanNameQuery)
+
+	span.observe(&AssistantMessage{Role: MessageRoleAssistant, Content: []ContentBlock{
+		ToolUseBlock{Type: "tool_use", ID: "tool-1", Name: "Read"},
+	}})
+	span.observe(UserMessage{Role: MessageRoleUser, Blocks: []ContentBlock{
+		ToolResultBlock{Type: "tool_result", ToolUseID: "tool-1", Content: "failed", IsError: true},
+	}})
+
+	// The tool span ends with its result, not with the turn
+	tools := tracer.named(SpanNameTool)
+	if len(tools) != 1 || !tools[0].ended {
+		t.Fatalf("tool spans = %+v, want one ended by the user message's tool_result", tools)
+	}
+	if tools[0].attrs[AttrToolIsError] != true {
+		t.Errorf("tool span is_error = %v, want true", tools[0].attrs[AttrToolIsError])
+	}
+	span.end(nil)
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// writeTranscript copies a line of CLI output to RawTranscript. It is only
+// called from the read loop.
+func (t *transport) writeTranscript(line []byte) {
+	if t.options.RawTranscript == nil {
+		return
+	}
+	if t.options.Redactor != nil {
+		line = []byte(t.options.Redactor(string(line)))
+	}
+	// Recording must never disrupt the stream, so write errors are dropped
+	t.options.RawTranscript.Write(append(line[:len(line):len(line)], '\n'))
+}
+
+// ReplayClient returns a client that plays back a transcript recorded with
+// RawTranscript instead of launching the CLI, for deterministic tests. It
+// is used like any client: Connect opens the transcript, and each response
+// is read from it in turn. Messages sent to it are discarded, and
+// interrupts are never acknowledged.
+func ReplayClient(transcriptPath string) *Client {
+	c := NewClient(nil)
+	c.replayPath = transcriptPath
+	return c
+}
+
+// newReplayTransport builds a transport reading a recorded transcript as
+// if it were the CLI's stdout.
+func newReplayTransport(options *ClaudeCodeOptions, transcriptPath string) (*transport, error) {
+	f, err := os.Open(transcriptPath)
+	if err != nil {
+		return nil, NewCLIConnectionError("Failed to open transcript", err)
+	}
+
+	t := newProcessTransport(options, &process{
+		stdin:  nopWriteCloser{io.Discard},
+		stdout: f,
+		stderr: io.NopCloser(strings.NewReader("")),
+	}, true)
+	t.startReaders()
+	return t, nil
+}
+
+// nopWriteCloser is an io.WriteCloser whose Close does nothing.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
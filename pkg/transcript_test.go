@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplayClient(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+n=0
+while IFS= read -r line; do
+    n=$((n + 1))
+    echo '{"type":"system","message":{"role":"system","subtype":"usage","data":{"outputTokens":'"$n"'}}}'
+    echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"answer '"$n"'"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"cost":{"totalCost":0.01},"sessionId":"s1"}}}'
+done
+`)
+	prompts := []string{"first", "second"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runSession := func(t *testing.T, client *Client) [][]Message {
+		t.Helper()
+		if err := client.Connect(ctx, ""); err != nil {
+			t.Fatalf("Connect() error = %v", err)
+		}
+		defer client.Close()
+
+		var turns [][]Message
+		for _, prompt := range prompts {
+			if err := client.SendMessage(ctx, prompt); err != nil {
+				t.Fatalf("SendMessage() error = %v", err)
+			}
+			var turn []Message
+			for msg := range client.ReceiveResponse(ctx) {
+				turn = append(turn, msg)
+			}
+			turns = append(turns, turn)
+		}
+		return turns
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	transcript, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create transcript: %v", err)
+	}
+	recorded := runSession(t, NewClient(&ClaudeCodeOptions{RawTranscript: transcript}))
+	transcript.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read transcript: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 6 {
+		t.Errorf("transcript holds %d lines, want the 6 the CLI wrote:\n%s", lines, data)
+	}
+
+	// No CLI is needed to replay
+	t.Setenv("PATH", "")
+	replayed := runSession(t, ReplayClient(path))
+
+	if len(recorded) != 2 || len(recorded[0]) != 3 {
+		t.Fatalf("recorded session = %v, want 2 turns of 3 messages", recorded)
+	}
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed session = %v, want %v", replayed, recorded)
+	}
+}
+
+func TestReplayClient_MissingTranscript(t *testing.T) {
+	client := ReplayClient(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err := client.Connect(context.Background(), ""); err == nil {
+		client.Close()
+		t.Error("Connect() with a missing transcript succeeded, want an error")
+	}
+}
@@ -5,39 +5,129 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 const (
 	maxBufferSize = 1024 * 1024      // 1MB
-	maxStderrSize = 10 * 1024 * 1024 // 10MB
+	maxStderrSize = 10 * 1024 * 1024 // 10MB, split between head and tail
 	stderrTimeout = 10 * time.Second
+
+	interruptTimeout = 5 * time.Second
 )
 
+// errControlTimeout marks a control request that got no response in time
+var errControlTimeout = errors.New("no control response")
+
+// defaultStartRetryBackoff is the first retry delay when MaxStartRetries is
+// set without StartRetryBackoff
+const defaultStartRetryBackoff = 100 * time.Millisecond
+
+// stderrDrainTimeout bounds how long Close waits, after a failed CLI
+// exits, for the rest of its stderr
+const stderrDrainTimeout = 500 * time.Millisecond
+
+// defaultShutdownGrace is how long Close waits for the CLI to exit after
+// SIGTERM when ShutdownGrace is unset
+const defaultShutdownGrace = 2 * time.Second
+
 type transport struct {
-	cmd         *exec.Cmd
-	stdin       io.WriteCloser
-	stdout      io.ReadCloser
-	stderr      io.ReadCloser
-	parser      *messageParser
-	stderrBuf   *bytes.Buffer
-	messages    chan Message
-	errors      chan error
-	done        chan struct{}
-	closeOnce   sync.Once
-	requestID   atomic.Int64
-	controlResp map[string]chan *ControlResponse
-	controlMu   sync.Mutex
-	isStreaming bool
-	mu          sync.Mutex
+	cmd          *exec.Cmd
+	stdin        io.WriteCloser
+	stdout       io.ReadCloser
+	stderr       io.ReadCloser
+	parser       *messageParser
+	stderrBuf    *stderrBuffer
+	messages     chan Message
+	errors       chan error
+	costWarnings chan CostWarning
+	logs         chan LogLine
+	stderrLines  chan string
+	logPartial   []byte
+	done         chan struct{}
+	closeOnce    sync.Once
+	closeErr     error
+	requestID    atomic.Int64
+	controlResp  map[string]chan *ControlResponse
+	controlMu    sync.Mutex
+	isStreaming  bool
+	mu           sync.Mutex
+	// Non-nil, guarded by mu, while an interrupt awaits its control
+	// response; closed when it arrives or the wait gives up
+	interrupting chan struct{}
+	subsMu       sync.Mutex
+	subs         map[*subscriber]struct{}
+	readers      sync.WaitGroup
+	waitOnce     sync.Once
+	waitErr      error
+	options      *ClaudeCodeOptions
+	startedAt    time.Time
+	msgLog       *messageLogger
+	command      *launchCommand
+	// Count of interrupted system messages seen, to tell a lost interrupt
+	// from one whose acknowledgment was merely late
+	interruptsSeen atomic.Int64
+	// Closed once stdout produces its first line or ends, disarming the
+	// AuthTimeout watchdog
+	stdoutActive     chan struct{}
+	stdoutActiveOnce sync.Once
+	// Closed when the read loop stops, i.e. the CLI closed stdout
+	stdoutDone chan struct{}
+	// Closed when the stderr reader has finished
+	stderrDone chan struct{}
+	authErr    *AuthRequiredError
+	// Session cost from results, checked against MaxCostUSD by the read loop
+	totalCost    float64
+	costExceeded bool
+	// Background tokens of completed turns and of the turn in progress,
+	// checked against MaxBackgroundTokens by the read loop
+	backgroundTokens     int
+	turnBackgroundTokens int
+	backgroundExceeded   bool
+	// Assistant turns, checked against MaxTurns by the read loop
+	turns turnCounter
+	// What the read loop made of stdout, for Client.Stats
+	stats streamStats
+	// MCP tool calls awaiting results, when MCPToolTimeout is set
+	mcpWatch *mcpWatchdog
+	// Model from the init message, for results that don't name one
+	initModel string
+	// The turn in progress, for EmitTurnSummary
+	summary turnSummarizer
+	// Files generated for this session, removed on close
+	tempFiles []string
+}
+
+// subscriber is a single fan-out consumer registered via subscribe.
+type subscriber struct {
+	ch       chan Message
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// resolveCLI returns options.CLIPath when set, without searching, or
+// else the result of findCLI.
+func resolveCLI(options *ClaudeCodeOptions) (string, error) {
+	if options.CLIPath == "" {
+		return findCLI()
+	}
+
+	info, err := os.Stat(options.CLIPath)
+	if err != nil || info.IsDir() {
+		return "", NewCLINotFoundError([]string{options.CLIPath})
+	}
+	return options.CLIPath, nil
 }
 
 func findCLI() (string, error) {
@@ -75,15 +165,47 @@ func findCLI() (string, error) {
 }
 
 func newTransport(ctx context.Context, options *ClaudeCodeOptions, streaming bool) (*transport, error) {
-	cliPath, err := findCLI()
-	if err != nil {
+	options = options.promoteDeprecated()
+	if err := options.Validate(); err != nil {
 		return nil, err
 	}
 
 	// Build command args matching Python SDK
 	args := []string{"--output-format", "stream-json", "--verbose"}
-	
-	// Add options as individual flags (matching Python SDK)
+	args = append(args, optionArgs(options)...)
+
+	// Add streaming-specific flags
+	if streaming {
+		args = append(args, "--input-format", "stream-json")
+	}
+
+	// Set environment variable to match Python SDK
+	return startTransport(ctx, options, args, "sdk-go", streaming)
+}
+
+// newTransportForQuery creates a transport specifically for the Query function
+// This matches Python's query() behavior with close_stdin_after_prompt=True
+func newTransportForQuery(ctx context.Context, options *ClaudeCodeOptions, prompt string) (*transport, error) {
+	options = options.promoteDeprecated()
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	// Build command args matching Python SDK query mode
+	args := []string{"--output-format", "stream-json", "--verbose"}
+
+	// Add the prompt using --print flag (Python string mode)
+	args = append(args, "--print", prompt)
+	args = append(args, optionArgs(options)...)
+
+	// Set environment variable to match Python SDK query mode
+	return startTransport(ctx, options, args, "sdk-go-query", false)
+}
+
+// optionArgs translates options into individual CLI flags (matching Python SDK)
+func optionArgs(options *ClaudeCodeOptions) []string {
+	var args []string
+
 	if options.Model != "" {
 		args = append(args, "--model", options.Model)
 	}
@@ -93,17 +215,27 @@ func newTransport(ctx context.Context, options *ClaudeCodeOptions, streaming boo
 	if options.MaxThinkingTokens > 0 {
 		args = append(args, "--max-thinking-tokens", fmt.Sprintf("%d", options.MaxThinkingTokens))
 	}
+	// Zero leaves the CLI's default temperature in effect
+	if options.Temperature != 0 {
+		args = append(args, "--temperature", strconv.FormatFloat(options.Temperature, 'f', -1, 64))
+	}
 	if options.SystemPrompt != "" {
 		args = append(args, "--system-prompt", options.SystemPrompt)
 	}
 	if options.AppendSystemPrompt != "" {
 		args = append(args, "--append-system-prompt", options.AppendSystemPrompt)
 	}
-	if len(options.AllowedTools) > 0 {
-		args = append(args, "--allowed-tools", strings.Join(options.AllowedTools, ","))
+	allowedTools, disallowedTools := options.AllowedTools, options.DisallowedTools
+	if options.ToolPolicy != nil {
+		allowed, disallowed := options.ToolPolicy.Compile()
+		allowedTools = append(append([]string(nil), allowedTools...), allowed...)
+		disallowedTools = append(append([]string(nil), disallowedTools...), disallowed...)
+	}
+	if len(allowedTools) > 0 {
+		args = append(args, "--allowed-tools", strings.Join(allowedTools, ","))
 	}
-	if len(options.DisallowedTools) > 0 {
-		args = append(args, "--disallowed-tools", strings.Join(options.DisallowedTools, ","))
+	if len(disallowedTools) > 0 {
+		args = append(args, "--disallowed-tools", strings.Join(disallowedTools, ","))
 	}
 	if options.PermissionMode != "" {
 		args = append(args, "--permission-mode", string(options.PermissionMode))
@@ -117,116 +249,216 @@ func newTransport(ctx context.Context, options *ClaudeCodeOptions, streaming boo
 	if options.MaxTurns > 0 {
 		args = append(args, "--max-turns", fmt.Sprintf("%d", options.MaxTurns))
 	}
-	
-	// Add streaming-specific flags
-	if streaming {
-		args = append(args, "--input-format", "stream-json")
+	if options.IncludePartialMessages {
+		args = append(args, "--include-partial-messages")
 	}
 
-	cmd := exec.CommandContext(ctx, cliPath, args...)
-	
-	env := os.Environ()
-	// Set environment variable to match Python SDK
-	env = append(env, "CLAUDE_CODE_ENTRYPOINT=sdk-go")
-	cmd.Env = env
+	return args
+}
 
-	if options.Cwd != "" {
-		cmd.Dir = options.Cwd
+// optionEnv returns the variables that pass options the CLI only reads
+// from its environment. They follow os.Environ, so they take precedence.
+func optionEnv(options *ClaudeCodeOptions) []string {
+	var env []string
+	if options.BaseURL != "" {
+		env = append(env, "ANTHROPIC_BASE_URL="+options.BaseURL)
+	}
+	// An empty key would override one the CLI inherits; Validate rejects it
+	if key := os.Getenv(options.ApiKeyName); options.ApiKeyName != "" && key != "" {
+		env = append(env, "ANTHROPIC_API_KEY="+key)
 	}
+	return env
+}
 
-	stdin, err := cmd.StdinPipe()
+// writeMCPConfig writes options.McpServers to a file in the format read by
+// the CLI's --mcp-config flag and returns its path. The file is only
+// readable by the current user since server configs can hold credentials.
+func writeMCPConfig(options *ClaudeCodeOptions) (string, error) {
+	data, err := json.Marshal(struct {
+		McpServers map[string]MCPServerConfig `json:"mcpServers"`
+	}{options.McpServers})
 	if err != nil {
-		return nil, NewCLIConnectionError("Failed to create stdin pipe", err)
+		return "", err
 	}
+	return createTempFile(options.TempDir, "claude-mcp-*.json", data)
+}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, NewCLIConnectionError("Failed to create stdout pipe", err)
+// checkCLILaunch applies OfflineOnly and VerifyCLIPermissions to cliPath.
+// It must pass before anything executes the binary.
+func checkCLILaunch(cliPath string, options *ClaudeCodeOptions) error {
+	if options.OfflineOnly && !isMockCLI(cliPath) {
+		return NewOfflineLaunchError(cliPath)
+	}
+	if options.VerifyCLIPermissions {
+		return verifyCLIPermissions(cliPath)
 	}
+	return nil
+}
 
-	stderr, err := cmd.StderrPipe()
+// startTransport launches the CLI with args and starts the goroutines
+// reading its output.
+func startTransport(ctx context.Context, options *ClaudeCodeOptions, args []string, entrypoint string, streaming bool) (*transport, error) {
+	cliPath, err := resolveCLI(options)
 	if err != nil {
-		return nil, NewCLIConnectionError("Failed to create stderr pipe", err)
+		return nil, err
 	}
-
-	t := &transport{
-		cmd:         cmd,
-		stdin:       stdin,
-		stdout:      stdout,
-		stderr:      stderr,
-		parser:      newMessageParser(),
-		stderrBuf:   &bytes.Buffer{},
-		messages:    make(chan Message, 100),
-		errors:      make(chan error, 10),
-		done:        make(chan struct{}),
-		controlResp: make(map[string]chan *ControlResponse),
-		isStreaming: streaming,
+	if err := checkCLILaunch(cliPath, options); err != nil {
+		return nil, err
 	}
 
-	if err := cmd.Start(); err != nil {
-		return nil, NewCLIConnectionError("Failed to start Claude Code CLI", err)
-	}
+	var tempFiles []string
+	launched := false
+	defer func() {
+		if !launched {
+			for _, path := range tempFiles {
+				os.Remove(path)
+			}
+		}
+	}()
 
-	go t.readStderr()
-	go t.readMessages()
+	if len(options.McpServers) > 0 {
+		path, err := writeMCPConfig(options)
+		if err != nil {
+			return nil, NewCLIConnectionError("Failed to write MCP config", err)
+		}
+		tempFiles = append(tempFiles, path)
+		args = append(args, "--mcp-config", path)
+	}
 
-	return t, nil
-}
+	env := os.Environ()
+	env = append(env, "CLAUDE_CODE_ENTRYPOINT="+entrypoint)
+	env = append(env, optionEnv(options)...)
 
-// newTransportForQuery creates a transport specifically for the Query function
-// This matches Python's query() behavior with close_stdin_after_prompt=True
-func newTransportForQuery(ctx context.Context, options *ClaudeCodeOptions, prompt string) (*transport, error) {
-	cliPath, err := findCLI()
+	p, err := startProcess(ctx, options, cliPath, args, env)
 	if err != nil {
 		return nil, err
 	}
 
-	// Build command args matching Python SDK query mode
-	args := []string{"--output-format", "stream-json", "--verbose"}
-	
-	// Add the prompt using --print flag (Python string mode)
-	args = append(args, "--print", prompt)
-	
-	// Add options as individual flags (matching Python SDK)
-	if options.Model != "" {
-		args = append(args, "--model", options.Model)
-	}
-	if options.MaxTokens > 0 {
-		args = append(args, "--max-tokens", fmt.Sprintf("%d", options.MaxTokens))
-	}
-	if options.MaxThinkingTokens > 0 {
-		args = append(args, "--max-thinking-tokens", fmt.Sprintf("%d", options.MaxThinkingTokens))
-	}
-	if options.SystemPrompt != "" {
-		args = append(args, "--system-prompt", options.SystemPrompt)
+	t := newProcessTransport(options, p, streaming)
+	t.command = newLaunchCommand(cliPath, args, env)
+	t.tempFiles = tempFiles
+
+	launched = true
+	t.startReaders()
+
+	if options.AuthTimeout > 0 {
+		t.readers.Add(1)
+		go t.watchAuthTimeout(options.AuthTimeout)
 	}
-	if options.AppendSystemPrompt != "" {
-		args = append(args, "--append-system-prompt", options.AppendSystemPrompt)
+
+	return t, nil
+}
+
+// newProcessTransport builds a transport reading the output of p, which
+// for a replay has no command behind it.
+func newProcessTransport(options *ClaudeCodeOptions, p *process, streaming bool) *transport {
+	t := &transport{
+		cmd:          p.cmd,
+		stdin:        p.stdin,
+		stdout:       p.stdout,
+		stderr:       p.stderr,
+		parser:       &messageParser{toolResultInterceptor: options.ToolResultInterceptor},
+		stderrBuf:    newStderrBuffer(maxStderrSize),
+		messages:     make(chan Message, 100),
+		errors:       make(chan error, 10),
+		costWarnings: make(chan CostWarning, 10),
+		logs:         make(chan LogLine, 100),
+		stderrLines:  make(chan string, 100),
+		done:         make(chan struct{}),
+		controlResp:  make(map[string]chan *ControlResponse),
+		isStreaming:  streaming,
+		subs:         make(map[*subscriber]struct{}),
+		options:      options,
+		stdoutActive: make(chan struct{}),
+		stdoutDone:   make(chan struct{}),
+		stderrDone:   make(chan struct{}),
 	}
-	if len(options.AllowedTools) > 0 {
-		args = append(args, "--allowed-tools", strings.Join(options.AllowedTools, ","))
+	t.startedAt = options.clock().Now()
+	if !streaming {
+		// A Query's prompt is sent on the command line
+		t.summary.begin(t.startedAt)
 	}
-	if len(options.DisallowedTools) > 0 {
-		args = append(args, "--disallowed-tools", strings.Join(options.DisallowedTools, ","))
+
+	if options.MessageLogWriter != nil {
+		t.msgLog = newMessageLogger(options.MessageLogWriter, options.clock(), options.Redactor, t.startedAt)
 	}
-	if options.PermissionMode != "" {
-		args = append(args, "--permission-mode", string(options.PermissionMode))
+	if options.MCPToolTimeout > 0 {
+		t.mcpWatch = newMCPWatchdog(options.MCPToolTimeout, options.clock())
 	}
-	if options.ContinueConversation {
-		args = append(args, "--continue-conversation")
+	return t
+}
+
+// startReaders starts the goroutines reading the CLI's stdout and stderr.
+func (t *transport) startReaders() {
+	t.readers.Add(2)
+	go t.readStderr()
+	go t.readMessages()
+	if t.mcpWatch != nil {
+		t.readers.Add(1)
+		go t.watchMCPTools()
 	}
-	if options.Resume != "" {
-		args = append(args, "--resume", options.Resume)
+}
+
+// startCommand starts a launched CLI; tests replace it to simulate
+// transient start failures.
+var startCommand = (*exec.Cmd).Start
+
+// process is a started CLI and its pipes.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr io.ReadCloser
+	// The CLI's end of the stderr pipe, closed here once it has started
+	stderrWriter *os.File
+}
+
+// startProcess launches the CLI, retrying a failed start up to
+// options.MaxStartRetries times with exponential backoff. Only the start
+// itself is retried; a process that starts and then fails is not.
+func startProcess(ctx context.Context, options *ClaudeCodeOptions, cliPath string, args, env []string) (*process, error) {
+	backoff := options.StartRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultStartRetryBackoff
 	}
-	if options.MaxTurns > 0 {
-		args = append(args, "--max-turns", fmt.Sprintf("%d", options.MaxTurns))
+
+	for attempt := 0; ; attempt++ {
+		p, err := newProcess(ctx, options, cliPath, args, env)
+		if err != nil {
+			return nil, err
+		}
+		err = startLimited(p.cmd, options)
+		if err == nil {
+			p.stderrWriter.Close()
+			return p, nil
+		}
+		p.closePipes()
+		if attempt >= options.MaxStartRetries {
+			return nil, NewCLIConnectionError("Failed to start Claude Code CLI", err)
+		}
+
+		timer := options.clock().NewTimer(backoff << attempt)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, NewCLIConnectionError("Failed to start Claude Code CLI", err)
+		}
 	}
+}
 
-	cmd := exec.CommandContext(ctx, cliPath, args...)
-	
-	env := os.Environ()
-	// Set environment variable to match Python SDK query mode
-	env = append(env, "CLAUDE_CODE_ENTRYPOINT=sdk-go-query")
+// closePipes releases the pipes of a process that failed to start.
+func (p *process) closePipes() {
+	p.stdin.Close()
+	p.stdout.Close()
+	p.stderr.Close()
+	p.stderrWriter.Close()
+}
+
+// newProcess prepares a CLI command and its pipes without starting it.
+func newProcess(ctx context.Context, options *ClaudeCodeOptions, cliPath string, args, env []string) (*process, error) {
+	path, args := limitedCommand(cliPath, args, options)
+	cmd := exec.CommandContext(ctx, path, args...)
 	cmd.Env = env
 
 	if options.Cwd != "" {
@@ -243,33 +475,15 @@ func newTransportForQuery(ctx context.Context, options *ClaudeCodeOptions, promp
 		return nil, NewCLIConnectionError("Failed to create stdout pipe", err)
 	}
 
-	stderr, err := cmd.StderrPipe()
+	// Unlike StderrPipe, Wait doesn't close this pipe, so stderr written
+	// just before the CLI exits can still be read after reaping it
+	stderr, stderrWriter, err := os.Pipe()
 	if err != nil {
 		return nil, NewCLIConnectionError("Failed to create stderr pipe", err)
 	}
+	cmd.Stderr = stderrWriter
 
-	t := &transport{
-		cmd:         cmd,
-		stdin:       stdin,
-		stdout:      stdout,
-		stderr:      stderr,
-		parser:      newMessageParser(),
-		stderrBuf:   &bytes.Buffer{},
-		messages:    make(chan Message, 100),
-		errors:      make(chan error, 10),
-		done:        make(chan struct{}),
-		controlResp: make(map[string]chan *ControlResponse),
-		isStreaming: false,
-	}
-
-	if err := cmd.Start(); err != nil {
-		return nil, NewCLIConnectionError("Failed to start Claude Code CLI", err)
-	}
-
-	go t.readStderr()
-	go t.readMessages()
-
-	return t, nil
+	return &process{cmd: cmd, stdin: stdin, stdout: stdout, stderr: stderr, stderrWriter: stderrWriter}, nil
 }
 
 func (t *transport) sendMessage(ctx context.Context, message Message, parentToolUseID, sessionID string) error {
@@ -285,9 +499,12 @@ func (t *transport) sendMessage(ctx context.Context, message Message, parentTool
 		return err
 	}
 
-	t.mu.Lock()
+	if err := t.lockIdle(ctx); err != nil {
+		return err
+	}
 	defer t.mu.Unlock()
 
+	t.summary.begin(t.options.clock().Now())
 	if _, err := t.stdin.Write(data); err != nil {
 		return NewCLIConnectionError("Failed to send message", err)
 	}
@@ -299,56 +516,143 @@ func (t *transport) sendMessage(ctx context.Context, message Message, parentTool
 	return nil
 }
 
-func (t *transport) sendInterrupt(ctx context.Context) error {
+func (t *transport) sendInterrupt(ctx context.Context, reason string) error {
+	timeout := interruptTimeout
+	if t.options != nil && t.options.InterruptTimeout > 0 {
+		timeout = t.options.InterruptTimeout
+	}
+
+	// Hold back user messages until the CLI acknowledges the interrupt, so
+	// none can overtake it
+	if err := t.lockIdle(ctx); err != nil {
+		return err
+	}
+	interrupting := make(chan struct{})
+	t.interrupting = interrupting
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.interrupting = nil
+		t.mu.Unlock()
+		close(interrupting)
+	}()
+
+	seen := t.interruptsSeen.Load()
+	resp, err := t.sendControlRequest(ctx, ControlRequestTypeInterrupt, reason, timeout)
+	if errors.Is(err, errControlTimeout) {
+		return NewInterruptTimeoutError(timeout, t.interruptsSeen.Load() > seen)
+	}
+	if err != nil {
+		return err
+	}
+	if !resp.Response.Success {
+		if reason != "" {
+			return fmt.Errorf("interrupt (%s) failed: %s", reason, resp.Response.Error)
+		}
+		return fmt.Errorf("interrupt failed: %s", resp.Response.Error)
+	}
+	return nil
+}
+
+// lockIdle locks mu once no interrupt is awaiting acknowledgment. It
+// returns without the lock if ctx is done or the transport closes first.
+func (t *transport) lockIdle(ctx context.Context) error {
+	for {
+		t.mu.Lock()
+		interrupting := t.interrupting
+		if interrupting == nil {
+			return nil
+		}
+		t.mu.Unlock()
+
+		select {
+		case <-interrupting:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.done:
+			return NewCLIConnectionError("Transport closed while waiting for interrupt", nil)
+		}
+	}
+}
+
+// sendControlRequest writes a control request of the given subtype and
+// optional reason to the CLI and waits up to timeout for the matching
+// control response.
+func (t *transport) sendControlRequest(ctx context.Context, subtype ControlRequestType, reason string, timeout time.Duration) (*ControlResponse, error) {
 	requestID := fmt.Sprintf("req_%d_%d", t.requestID.Add(1), time.Now().UnixNano())
-	
+
 	request := ControlRequest{
 		Type:      "control_request",
 		RequestID: requestID,
-		Request: struct {
-			Subtype ControlRequestType `json:"subtype"`
-		}{
-			Subtype: ControlRequestTypeInterrupt,
-		},
 	}
+	request.Request.Subtype = subtype
+	request.Request.Reason = reason
 
 	data, err := json.Marshal(request)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	respChan := make(chan *ControlResponse, 1)
-	t.controlMu.Lock()
-	t.controlResp[requestID] = respChan
-	t.controlMu.Unlock()
-
-	defer func() {
-		t.controlMu.Lock()
-		delete(t.controlResp, requestID)
-		t.controlMu.Unlock()
-	}()
+	// Register before writing so a fast response can't be missed
+	t.registerControlRequest(requestID)
 
 	t.mu.Lock()
 	if _, err := t.stdin.Write(data); err != nil {
 		t.mu.Unlock()
-		return NewCLIConnectionError("Failed to send interrupt", err)
+		t.unregisterControlRequest(requestID)
+		return nil, NewCLIConnectionError(fmt.Sprintf("Failed to send %s request", subtype), err)
 	}
 	if _, err := t.stdin.Write([]byte("\n")); err != nil {
 		t.mu.Unlock()
-		return NewCLIConnectionError("Failed to send newline", err)
+		t.unregisterControlRequest(requestID)
+		return nil, NewCLIConnectionError("Failed to send newline", err)
 	}
 	t.mu.Unlock()
 
+	return t.awaitControlResponse(ctx, requestID, timeout)
+}
+
+func (t *transport) registerControlRequest(requestID string) {
+	t.controlMu.Lock()
+	t.controlResp[requestID] = make(chan *ControlResponse, 1)
+	t.controlMu.Unlock()
+}
+
+func (t *transport) unregisterControlRequest(requestID string) {
+	t.controlMu.Lock()
+	delete(t.controlResp, requestID)
+	t.controlMu.Unlock()
+}
+
+// awaitControlResponse waits for the response to a registered control
+// request. It gives up when ctx is done, the transport is closed, or timeout
+// elapses (a non-positive timeout waits indefinitely). The request is
+// unregistered on return.
+func (t *transport) awaitControlResponse(ctx context.Context, requestID string, timeout time.Duration) (*ControlResponse, error) {
+	t.controlMu.Lock()
+	respChan, ok := t.controlResp[requestID]
+	t.controlMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("no pending control request %s", requestID)
+	}
+	defer t.unregisterControlRequest(requestID)
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := t.options.clock().NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C()
+	}
+
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return nil, ctx.Err()
+	case <-t.done:
+		return nil, NewCLIConnectionError("Transport closed while waiting for control response", nil)
 	case resp := <-respChan:
-		if !resp.Response.Success {
-			return fmt.Errorf("interrupt failed: %s", resp.Response.Error)
-		}
-		return nil
-	case <-time.After(5 * time.Second):
-		return fmt.Errorf("interrupt request timeout")
+		return resp, nil
+	case <-timeoutC:
+		return nil, fmt.Errorf("control request %s timed out after %s: %w", requestID, timeout, errControlTimeout)
 	}
 }
 
@@ -363,8 +667,6 @@ func (t *transport) closeStdin() error {
 }
 
 func (t *transport) close() error {
-	var finalErr error
-	
 	t.closeOnce.Do(func() {
 		// First, signal done to stop goroutines
 		close(t.done)
@@ -374,11 +676,22 @@ func (t *transport) close() error {
 			t.stdin.Close()
 		}
 		
-		// Kill the process
-		if t.cmd.Process != nil {
-			t.cmd.Process.Kill()
+		// Ask the process to exit, killing it if it doesn't in time
+		var exitErr error
+		if t.cmd != nil && t.cmd.Process != nil {
+			exitErr = t.terminate()
 		}
 		
+		// Let the stderr reader reach EOF before cutting it off
+		if exitErr != nil {
+			timer := time.NewTimer(stderrDrainTimeout)
+			select {
+			case <-t.stderrDone:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+
 		// Close stdout and stderr to unblock readers
 		if t.stdout != nil {
 			t.stdout.Close()
@@ -387,27 +700,47 @@ func (t *transport) close() error {
 			t.stderr.Close()
 		}
 		
-		// Wait for process to exit
-		if t.cmd.Process != nil {
-			t.cmd.Wait()
+		// Wait for the reader goroutines so nothing sends on a closed channel
+		t.readers.Wait()
+
+		// Stderr is complete now, so the exit can be reported with it
+		if exitErr != nil {
+			t.closeErr = t.exitError(exitErr)
 		}
 		
-		// Give goroutines a moment to finish
-		time.Sleep(10 * time.Millisecond)
-		
+		// The CLI has exited, so the files generated for it can go
+		t.removeTempFiles()
+
 		// Finally, close the channels
 		close(t.messages)
 		close(t.errors)
+		close(t.costWarnings)
+		close(t.logs)
+		close(t.stderrLines)
+
+		t.subsMu.Lock()
+		for sub := range t.subs {
+			delete(t.subs, sub)
+			close(sub.ch)
+		}
+		t.subsMu.Unlock()
 	})
 
-	return finalErr
+	return t.closeErr
 }
 
 func (t *transport) readMessages() {
+	defer t.readers.Done()
+
+	defer close(t.stdoutDone)
+	defer t.markStdoutActive()
+
 	scanner := bufio.NewScanner(t.stdout)
 	scanner.Buffer(make([]byte, maxBufferSize), maxBufferSize)
 
 	for scanner.Scan() {
+		t.markStdoutActive()
+
 		select {
 		case <-t.done:
 			return
@@ -415,13 +748,17 @@ func (t *transport) readMessages() {
 		}
 
 		line := scanner.Bytes()
+		t.stats.lineRead(len(line) + 1)
 		if len(line) == 0 {
+			t.stats.skipped()
 			continue
 		}
+		t.writeTranscript(line)
 
 		if t.parser.isControlResponse(line) {
 			resp, err := t.parser.parseControlResponse(line)
 			if err != nil {
+				t.stats.parseError()
 				select {
 				case t.errors <- err:
 				case <-t.done:
@@ -432,14 +769,20 @@ func (t *transport) readMessages() {
 
 			t.controlMu.Lock()
 			if ch, ok := t.controlResp[resp.RequestID]; ok {
-				ch <- resp
+				// Never block the read loop on a duplicate response
+				select {
+				case ch <- resp:
+				default:
+				}
 			}
 			t.controlMu.Unlock()
+			t.stats.parsed("control_response")
 			continue
 		}
 
-		streamMsg, err := t.parser.parseStreamMessage(line)
+		msg, err := t.parser.parseLine(line)
 		if err != nil {
+			t.stats.parseError()
 			select {
 			case t.errors <- err:
 			case <-t.done:
@@ -448,23 +791,55 @@ func (t *transport) readMessages() {
 			continue
 		}
 
-		msg, err := t.parser.parseMessage(streamMsg.Type, streamMsg.Message)
-		if err != nil {
-			select {
-			case t.errors <- err:
-			case <-t.done:
-				return
-			}
+		if msg == nil {
+			t.stats.skipped()
 			continue
 		}
+		t.stats.parsed(msg.GetType())
+		msg = t.fillResultModel(msg)
+		if t.mcpWatch != nil {
+			t.mcpWatch.observe(msg)
+		}
 
-		if msg != nil {
-			select {
-			case t.messages <- msg:
-			case <-t.done:
+		// The notices go ahead of the result so they are part of the turn
+		result, isResult := msg.(ResultMessage)
+		if isResult {
+			if notice, exceeded := t.checkCostLimit(result); exceeded && !t.forward(notice) {
+				return
+			}
+		}
+		backgroundNotice, backgroundExceeded := t.checkBackgroundTokens(msg)
+		if backgroundExceeded && isResult && !t.forward(backgroundNotice) {
+			return
+		}
+		if t.options.EmitTurnSummary {
+			t.summary.observe(msg)
+		}
+		if !t.forward(msg) {
+			return
+		}
+		if backgroundExceeded && !isResult && !t.forward(backgroundNotice) {
+			return
+		}
+		if notice, reached := t.checkMaxTurns(msg); reached && !t.forward(notice) {
+			return
+		}
+		if isResult && t.options.EmitTurnSummary {
+			if !t.forward(t.summary.summarize(result, t.options.clock().Now())) {
 				return
 			}
 		}
+
+		// Report an overflow after the message so it is in the history
+		if system, ok := msg.(SystemMessage); ok {
+			if overflowErr := contextOverflowError(system); overflowErr != nil {
+				select {
+				case t.errors <- overflowErr:
+				case <-t.done:
+					return
+				}
+			}
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -476,27 +851,162 @@ func (t *transport) readMessages() {
 	}
 }
 
-func (t *transport) readStderr() {
-	reader := bufio.NewReader(t.stderr)
-	buf := make([]byte, 4096)
+// fillResultModel gives a result that doesn't name the model that served
+// it the model from the session's init message, so every consumer sees
+// the same UsedModel. Only the read loop calls it.
+func (t *transport) fillResultModel(msg Message) Message {
+	if model := initModel(msg); model != "" {
+		t.initModel = model
+	}
+	if result, ok := msg.(ResultMessage); ok && result.Data.Model == "" {
+		result.Data.Model = t.initModel
+		return result
+	}
+	return msg
+}
 
-	for {
+// forward logs and delivers a parsed message to subscribers and the
+// messages channel. It returns false once the transport is closed.
+func (t *transport) forward(msg Message) bool {
+	if t.msgLog != nil {
+		t.msgLog.log(msg)
+	}
+	if system, ok := msg.(SystemMessage); ok {
+		switch system.Subtype {
+		case SystemMessageSubtypeCostWarning:
+			t.sendCostWarning(system)
+		case SystemMessageSubtypeInterrupted:
+			t.interruptsSeen.Add(1)
+		}
+	}
+	t.broadcast(msg)
+
+	select {
+	case t.messages <- msg:
+		return true
+	case <-t.done:
+		return false
+	}
+}
+
+// sendCostWarning surfaces a cost_warning system message on the
+// costWarnings channel. Warnings are advisory, so they are dropped rather
+// than stalling the read loop when nobody is listening.
+func (t *transport) sendCostWarning(msg SystemMessage) {
+	var payload struct {
+		Data CostWarning `json:"data"`
+	}
+	if err := json.Unmarshal(msg.Raw, &payload); err != nil {
+		return
+	}
+
+	select {
+	case t.costWarnings <- payload.Data:
+	default:
+	}
+}
+
+// subscribe registers a new fan-out consumer that receives every parsed
+// message in addition to the main messages channel. The returned function
+// unsubscribes; it is safe to call more than once and from any goroutine.
+func (t *transport) subscribe(buffer int) (<-chan Message, func()) {
+	if buffer < 0 {
+		buffer = 0
+	}
+	sub := &subscriber{
+		ch:   make(chan Message, buffer),
+		done: make(chan struct{}),
+	}
+
+	t.subsMu.Lock()
+	select {
+	case <-t.done:
+		// Transport already closed, hand back a closed channel
+		t.subsMu.Unlock()
+		close(sub.ch)
+		return sub.ch, func() {}
+	default:
+	}
+	t.subs[sub] = struct{}{}
+	t.subsMu.Unlock()
+
+	return sub.ch, func() { t.unsubscribe(sub) }
+}
+
+func (t *transport) unsubscribe(sub *subscriber) {
+	// Closing done first unblocks a broadcast that is waiting on this
+	// subscriber, so the lock below can't deadlock against it.
+	sub.doneOnce.Do(func() { close(sub.done) })
+
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+
+	if _, ok := t.subs[sub]; !ok {
+		return
+	}
+	delete(t.subs, sub)
+	close(sub.ch)
+
+	// Release anything still buffered so the reader sees the close promptly
+	for range sub.ch {
+	}
+}
+
+// broadcast delivers msg to every subscriber. Delivery blocks per
+// subscriber so slow readers don't lose messages, but an unsubscribe or
+// transport close always releases it.
+func (t *transport) broadcast(msg Message) {
+	t.subsMu.Lock()
+	defer t.subsMu.Unlock()
+
+	for sub := range t.subs {
 		select {
+		case sub.ch <- msg:
+		case <-sub.done:
 		case <-t.done:
 			return
-		default:
 		}
+	}
+}
+
+func (t *transport) readStderr() {
+	defer t.readers.Done()
+	defer close(t.stderrDone)
+
+	// Read to EOF even once closing, so stderr is complete for the exit
+	// error; close closes the pipe if the CLI's children keep it open
+	reader := bufio.NewReader(t.stderr)
+	buf := make([]byte, 4096)
+
+	var login *loginPromptScanner
+	if t.options.AuthTimeout > 0 {
+		login = &loginPromptScanner{}
+	}
 
+	for {
 		n, err := reader.Read(buf)
 		if n > 0 {
 			t.mu.Lock()
-			if t.stderrBuf.Len()+n <= maxStderrSize {
-				t.stderrBuf.Write(buf[:n])
-			}
+			t.stderrBuf.Write(buf[:n])
 			t.mu.Unlock()
+
+			if login != nil && login.scan(buf[:n]) {
+				t.reportAuthRequired("login prompt on stderr")
+				login = nil
+			}
+			if t.mcpWatch != nil {
+				t.mcpWatch.logged(buf[:n])
+			}
+
+			if t.splitsStderr() {
+				t.emitStderrLines(buf[:n], false)
+			}
 		}
 
 		if err != nil {
+			if t.splitsStderr() {
+				t.emitStderrLines(nil, true)
+			}
 			if err != io.EOF {
 				select {
 				case t.errors <- NewCLIConnectionError("Error reading stderr", err):
@@ -509,16 +1019,164 @@ func (t *transport) readStderr() {
 	}
 }
 
+// splitsStderr reports whether stderr is wanted line by line, parsed on
+// the logs channel or raw on the stderrLines channel.
+func (t *transport) splitsStderr() bool {
+	return t.options.StderrLogFormat != "" || t.options.StderrLines
+}
+
+// emitStderrLines splits stderr output into lines and delivers them on the
+// logs and stderrLines channels, holding back a trailing partial line
+// until more output or EOF (flush) arrives. Only the stderr reader calls
+// it. Lines are dropped when a channel is full so logging never stalls
+// the CLI.
+func (t *transport) emitStderrLines(data []byte, flush bool) {
+	t.logPartial = append(t.logPartial, data...)
+
+	for {
+		idx := bytes.IndexByte(t.logPartial, '\n')
+		if idx < 0 {
+			break
+		}
+		t.sendStderrLine(string(bytes.TrimRight(t.logPartial[:idx], "\r")))
+		t.logPartial = t.logPartial[idx+1:]
+	}
+
+	if flush && len(t.logPartial) > 0 {
+		t.sendStderrLine(string(t.logPartial))
+		t.logPartial = nil
+	}
+}
+
+func (t *transport) sendStderrLine(line string) {
+	if t.options.StderrLines {
+		select {
+		case t.stderrLines <- line:
+		default:
+		}
+	}
+
+	if t.options.StderrLogFormat == "" || strings.TrimSpace(line) == "" {
+		return
+	}
+	select {
+	case t.logs <- parseLogLine(line, t.options.StderrLogFormat, t.options.clock().Now()):
+	default:
+	}
+}
+
+func (t *transport) markStdoutActive() {
+	t.stdoutActiveOnce.Do(func() { close(t.stdoutActive) })
+}
+
+// watchAuthTimeout reports a login hang when stdout stays silent for
+// timeout after the CLI starts.
+func (t *transport) watchAuthTimeout(timeout time.Duration) {
+	defer t.readers.Done()
+
+	timer := t.options.clock().NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		t.reportAuthRequired(fmt.Sprintf("no output within %s", timeout))
+	case <-t.stdoutActive:
+	case <-t.done:
+	}
+}
+
+// reportAuthRequired fails the session with an AuthRequiredError and kills
+// the CLI, which would otherwise wait for a login that never comes. Only
+// the first report has any effect.
+func (t *transport) reportAuthRequired(reason string) {
+	t.mu.Lock()
+	if t.authErr != nil {
+		t.mu.Unlock()
+		return
+	}
+	t.authErr = NewAuthRequiredError(reason, t.stderrBuf.String())
+	err := t.authErr
+	t.mu.Unlock()
+
+	t.cmd.Process.Kill()
+
+	select {
+	case t.errors <- err:
+	case <-t.done:
+	}
+}
+
+// terminate sends the process SIGTERM and waits up to ShutdownGrace for it
+// to exit before killing it. It returns the exit status, or nil if the
+// process exited cleanly or died of the signal.
+func (t *transport) terminate() error {
+	// Platforms without SIGTERM, i.e. Windows, can only kill
+	if err := t.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.cmd.Process.Kill()
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- t.reap() }()
+
+	grace := t.options.ShutdownGrace
+	if grace == 0 {
+		grace = defaultShutdownGrace
+	}
+	// The process runs in real time whatever Clock the session uses
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case err = <-exited:
+	case <-timer.C:
+		t.cmd.Process.Kill()
+		err = <-exited
+	}
+
+	// A process that died of our signal didn't fail
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() < 0 {
+		return nil
+	}
+	return err
+}
+
+// reap waits for the process exactly once; exec.Cmd.Wait must not be called
+// concurrently or more than once.
+func (t *transport) reap() error {
+	t.waitOnce.Do(func() {
+		// A replay has no process to wait for
+		if t.cmd != nil {
+			t.waitErr = t.cmd.Wait()
+		}
+	})
+	return t.waitErr
+}
+
 func (t *transport) wait() error {
-	err := t.cmd.Wait()
-	
-	time.Sleep(100 * time.Millisecond)
-	
+	// Wait closes the pipes, so let the readers drain them first
+	t.readers.Wait()
+	return t.exitError(t.reap())
+}
+
+// exitError turns the result of waiting for the process into the error
+// reported for it, using the captured stderr.
+func (t *transport) exitError(err error) error {
 	t.mu.Lock()
 	stderr := t.stderrBuf.String()
+	authErr := t.authErr
 	t.mu.Unlock()
 
+	// The process was killed for wanting to log in; say so, not that it died
+	if authErr != nil {
+		return authErr
+	}
+
 	if err != nil {
+		if detail, ok := detectContextOverflow(stderr); ok {
+			return NewContextOverflowError(detail)
+		}
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return NewProcessError(exitErr.ExitCode(), "", stderr)
 		}
@@ -528,6 +1186,13 @@ func (t *transport) wait() error {
 	return nil
 }
 
+// stderrOutput returns the stderr captured so far.
+func (t *transport) stderrOutput() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stderrBuf.String()
+}
+
 func (t *transport) collectStderr(timeout time.Duration) string {
 	timer := time.NewTimer(timeout)
 	defer timer.Stop()
@@ -0,0 +1,614 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newPipeTransport builds a transport without a process whose stdin writes
+// can be read back from the returned reader.
+func newPipeTransport(t *testing.T) (*transport, *bufio.Reader) {
+	pr, pw := io.Pipe()
+	t.Cleanup(func() {
+		pr.Close()
+		pw.Close()
+	})
+
+	return &transport{
+		stdin:        pw,
+		parser:       newMessageParser(),
+		messages:     make(chan Message, 100),
+		errors:       make(chan error, 10),
+		costWarnings: make(chan CostWarning, 10),
+		logs:         make(chan LogLine, 100),
+		done:         make(chan struct{}),
+		controlResp:  make(map[string]chan *ControlResponse),
+		subs:         make(map[*subscriber]struct{}),
+	}, bufio.NewReader(pr)
+}
+
+// readControlRequest reads the next control request written by the transport
+func readControlRequest(t *testing.T, r *bufio.Reader) ControlRequest {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		t.Errorf("Failed to read control request: %v", err)
+		return ControlRequest{}
+	}
+	var req ControlRequest
+	if err := json.Unmarshal(line, &req); err != nil {
+		t.Errorf("Failed to decode control request: %v", err)
+	}
+	return req
+}
+
+func TestTransport_SendControlRequest(t *testing.T) {
+	tr, stdin := newPipeTransport(t)
+
+	go func() {
+		req := readControlRequest(t, stdin)
+		resp := &ControlResponse{Type: "control_response", RequestID: req.RequestID}
+		resp.Response.Success = true
+
+		tr.controlMu.Lock()
+		tr.controlResp[req.RequestID] <- resp
+		tr.controlMu.Unlock()
+	}()
+
+	resp, err := tr.sendControlRequest(context.Background(), ControlRequestTypeInterrupt, "", time.Second)
+	if err != nil {
+		t.Fatalf("sendControlRequest() error = %v", err)
+	}
+	if !resp.Response.Success {
+		t.Error("sendControlRequest() response not successful")
+	}
+	if len(tr.controlResp) != 0 {
+		t.Errorf("pending control requests = %d, want 0", len(tr.controlResp))
+	}
+}
+
+func TestTransport_SendControlRequestReason(t *testing.T) {
+	tr, stdin := newPipeTransport(t)
+
+	go func() {
+		req := readControlRequest(t, stdin)
+		resp := &ControlResponse{Type: "control_response", RequestID: req.RequestID}
+		resp.Response.Success = true
+		resp.Response.Reason = req.Request.Reason
+
+		tr.controlMu.Lock()
+		tr.controlResp[req.RequestID] <- resp
+		tr.controlMu.Unlock()
+	}()
+
+	resp, err := tr.sendControlRequest(context.Background(), ControlRequestTypeInterrupt, "deadline reached", time.Second)
+	if err != nil {
+		t.Fatalf("sendControlRequest() error = %v", err)
+	}
+	if resp.Response.Reason != "deadline reached" {
+		t.Errorf("control response reason = %q, want the request's reason echoed", resp.Response.Reason)
+	}
+}
+
+func TestTransport_AwaitControlResponse(t *testing.T) {
+	t.Run("context cancellation", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		tr.registerControlRequest("req_ctx")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		_, err := tr.awaitControlResponse(ctx, "req_ctx", time.Minute)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("awaitControlResponse() error = %v, want context.Canceled", err)
+		}
+	})
+
+	t.Run("explicit timeout", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		tr.registerControlRequest("req_timeout")
+
+		start := time.Now()
+		_, err := tr.awaitControlResponse(context.Background(), "req_timeout", 20*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "timed out") {
+			t.Errorf("awaitControlResponse() error = %v, want timeout", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("awaitControlResponse() took %v, want about 20ms", elapsed)
+		}
+	})
+
+	t.Run("transport closed", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		tr.registerControlRequest("req_done")
+		time.AfterFunc(20*time.Millisecond, func() { close(tr.done) })
+
+		_, err := tr.awaitControlResponse(context.Background(), "req_done", time.Minute)
+		var connErr *CLIConnectionError
+		if !errors.As(err, &connErr) {
+			t.Errorf("awaitControlResponse() error = %v, want *CLIConnectionError", err)
+		}
+	})
+
+	t.Run("unknown request", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		if _, err := tr.awaitControlResponse(context.Background(), "req_missing", time.Second); err == nil {
+			t.Error("awaitControlResponse() for unregistered request should fail")
+		}
+	})
+
+	t.Run("unregisters on return", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		tr.registerControlRequest("req_cleanup")
+		tr.awaitControlResponse(context.Background(), "req_cleanup", time.Millisecond)
+
+		tr.controlMu.Lock()
+		defer tr.controlMu.Unlock()
+		if _, ok := tr.controlResp["req_cleanup"]; ok {
+			t.Error("control request still registered after awaitControlResponse returned")
+		}
+	})
+}
+
+func TestTransport_InterruptOrdering(t *testing.T) {
+	tr, stdin := newPipeTransport(t)
+
+	const senders, messagesEach = 8, 20
+	const interrupters, interruptsEach = 4, 10
+
+	// Play the CLI: acknowledge each interrupt a moment after reading it,
+	// and flag any line that arrives while one is still unacknowledged
+	var mu sync.Mutex
+	pending := false
+	var violations []string
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for i := 0; i < senders*messagesEach+interrupters*interruptsEach; i++ {
+			line, err := stdin.ReadBytes('\n')
+			if err != nil {
+				t.Errorf("Failed to read stdin: %v", err)
+				return
+			}
+			var envelope struct {
+				Type      string `json:"type"`
+				RequestID string `json:"request_id"`
+			}
+			if err := json.Unmarshal(line, &envelope); err != nil {
+				t.Errorf("Failed to decode stdin line: %v", err)
+				return
+			}
+
+			mu.Lock()
+			if pending {
+				violations = append(violations, envelope.Type)
+			}
+			if envelope.Type == "control_request" {
+				pending = true
+			}
+			mu.Unlock()
+
+			if envelope.Type == "control_request" {
+				go func(requestID string) {
+					time.Sleep(time.Millisecond)
+					mu.Lock()
+					pending = false
+					mu.Unlock()
+
+					resp := &ControlResponse{Type: "control_response", RequestID: requestID}
+					resp.Response.Success = true
+					tr.controlMu.Lock()
+					tr.controlResp[requestID] <- resp
+					tr.controlMu.Unlock()
+				}(envelope.RequestID)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messagesEach; j++ {
+				msg := UserMessage{Content: "hello"}
+				if err := tr.sendMessage(context.Background(), msg, "", ""); err != nil {
+					t.Errorf("sendMessage() error = %v", err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < interrupters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < interruptsEach; j++ {
+				if err := tr.sendInterrupt(context.Background(), ""); err != nil {
+					t.Errorf("sendInterrupt() error = %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	<-readerDone
+
+	if len(violations) > 0 {
+		t.Errorf("%d lines written before an interrupt was acknowledged: %v", len(violations), violations)
+	}
+}
+
+func TestTransport_SendWhileInterrupting(t *testing.T) {
+	t.Run("context cancellation", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		tr.interrupting = make(chan struct{})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		err := tr.sendMessage(ctx, UserMessage{Content: "hello"}, "", "")
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("sendMessage() error = %v, want context.DeadlineExceeded", err)
+		}
+	})
+
+	t.Run("transport closed", func(t *testing.T) {
+		tr, _ := newPipeTransport(t)
+		tr.interrupting = make(chan struct{})
+		time.AfterFunc(20*time.Millisecond, func() { close(tr.done) })
+
+		err := tr.sendMessage(context.Background(), UserMessage{Content: "hello"}, "", "")
+		var connErr *CLIConnectionError
+		if !errors.As(err, &connErr) {
+			t.Errorf("sendMessage() error = %v, want *CLIConnectionError", err)
+		}
+	})
+}
+
+func TestOptionEnv(t *testing.T) {
+	t.Setenv("GATEWAY_KEY", "sk-gateway")
+	t.Setenv("GATEWAY_KEY_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		options ClaudeCodeOptions
+		want    []string
+	}{
+		{name: "unset", options: ClaudeCodeOptions{}},
+		{
+			name:    "base URL",
+			options: ClaudeCodeOptions{BaseURL: "https://gateway.example.com"},
+			want:    []string{"ANTHROPIC_BASE_URL=https://gateway.example.com"},
+		},
+		{
+			name:    "API key name",
+			options: ClaudeCodeOptions{ApiKeyName: "GATEWAY_KEY"},
+			want:    []string{"ANTHROPIC_API_KEY=sk-gateway"},
+		},
+		{
+			name:    "API key variable empty",
+			options: ClaudeCodeOptions{ApiKeyName: "GATEWAY_KEY_EMPTY"},
+		},
+		{
+			name:    "both",
+			options: ClaudeCodeOptions{BaseURL: "http://localhost:4000", ApiKeyName: "GATEWAY_KEY"},
+			want:    []string{"ANTHROPIC_BASE_URL=http://localhost:4000", "ANTHROPIC_API_KEY=sk-gateway"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := optionEnv(&tt.options); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("optionEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionArgs_Temperature(t *testing.T) {
+	tests := []struct {
+		name        string
+		temperature float64
+		want        string
+	}{
+		{name: "unset", temperature: 0, want: ""},
+		{name: "fractional", temperature: 0.7, want: "0.7"},
+		{name: "whole", temperature: 1, want: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := optionArgs(&ClaudeCodeOptions{Temperature: tt.temperature})
+
+			got := ""
+			for i, arg := range args {
+				if arg == "--temperature" && i+1 < len(args) {
+					got = args[i+1]
+				}
+			}
+			if got != tt.want {
+				t.Errorf("optionArgs() --temperature = %q, want %q (args %v)", got, tt.want, args)
+			}
+		})
+	}
+}
+
+func TestQuery_TemperatureFlag(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+for arg in "$@"; do
+    if [ "$prev" = "--temperature" ]; then
+        echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"temperature '"$arg"'"}]}}'
+    fi
+    prev="$arg"
+done
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+`)
+
+	result, err := QueryWithOptions(context.Background(), "Hello", func(opts *ClaudeCodeOptions) {
+		opts.Temperature = 0.7
+	})
+	if err != nil {
+		t.Fatalf("QueryWithOptions() error = %v", err)
+	}
+	if result.Stdout != "temperature 0.7" {
+		t.Errorf("QueryWithOptions() stdout = %q, want the CLI to receive --temperature 0.7", result.Stdout)
+	}
+}
+
+func TestQuery_OnlyToolsFlag(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+for arg in "$@"; do
+    if [ "$prev" = "--allowed-tools" ]; then
+        echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"allowed '"$arg"'"}]}}'
+    fi
+    prev="$arg"
+done
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+`)
+
+	var logs bytes.Buffer
+	result, err := QueryWithOptions(context.Background(), "Hello", func(opts *ClaudeCodeOptions) {
+		opts.OnlyTools = []string{"Read", "Grep"}
+		opts.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	})
+	if err != nil {
+		t.Fatalf("QueryWithOptions() error = %v", err)
+	}
+	if result.Stdout != "allowed Read,Grep" {
+		t.Errorf("QueryWithOptions() stdout = %q, want the CLI to receive --allowed-tools Read,Grep", result.Stdout)
+	}
+	if !strings.Contains(logs.String(), "OnlyTools is deprecated") {
+		t.Errorf("logged %q, want a deprecation notice for OnlyTools", logs.String())
+	}
+}
+
+func TestQuery_EndpointEnv(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"'"$ANTHROPIC_BASE_URL $ANTHROPIC_API_KEY"'"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+`)
+	t.Setenv("ANTHROPIC_API_KEY", "sk-default")
+	t.Setenv("GATEWAY_KEY", "sk-gateway")
+
+	result, err := QueryWithOptions(context.Background(), "Hello", func(opts *ClaudeCodeOptions) {
+		opts.BaseURL = "https://gateway.example.com"
+		opts.ApiKeyName = "GATEWAY_KEY"
+	})
+	if err != nil {
+		t.Fatalf("QueryWithOptions() error = %v", err)
+	}
+	if want := "https://gateway.example.com sk-gateway"; result.Stdout != want {
+		t.Errorf("QueryWithOptions() stdout = %q, want %q", result.Stdout, want)
+	}
+}
+
+func TestQuery_MCPConfig(t *testing.T) {
+	setupScriptMockCLI(t, `#!/bin/sh
+for arg in "$@"; do
+    if [ "$prev" = "--mcp-config" ]; then
+        config="$arg"
+    fi
+    prev="$arg"
+done
+escaped=$(sed 's/\\/\\\\/g; s/"/\\"/g' "$config")
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"'"$config"'"},{"type":"text","text":"'"$escaped"'"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":1,"outputTokens":1},"cost":{"totalCost":0.001},"sessionId":"s1"}}}'
+`)
+
+	servers := map[string]MCPServerConfig{
+		"files":  {Type: MCPServerTypeStdio, Command: "files-server", Args: []string{"--root", "/tmp"}},
+		"remote": {Type: MCPServerTypeHTTP, URL: "https://example.com/mcp", Headers: map[string]string{"X-Key": "k"}},
+		"events": {Type: MCPServerTypeSSE, URL: "https://example.com/sse"},
+	}
+	tempDir := t.TempDir()
+
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{McpServers: servers, TempDir: tempDir})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+
+	var texts []string
+	for _, msg := range result.Messages {
+		if assistant, ok := msg.(*AssistantMessage); ok {
+			for _, block := range assistant.Content {
+				if text, ok := block.(TextBlock); ok {
+					texts = append(texts, text.Text)
+				}
+			}
+		}
+	}
+	if len(texts) != 2 {
+		t.Fatalf("mock CLI reported %v, want the config path and content", texts)
+	}
+
+	path, content := texts[0], texts[1]
+	if filepath.Dir(path) != tempDir {
+		t.Errorf("--mcp-config path = %s, want it in TempDir %s", path, tempDir)
+	}
+	var config struct {
+		McpServers map[string]MCPServerConfig `json:"mcpServers"`
+	}
+	if err := json.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatalf("MCP config %q is not valid JSON: %v", content, err)
+	}
+	if !reflect.DeepEqual(config.McpServers, servers) {
+		t.Errorf("MCP config servers = %+v, want %+v", config.McpServers, servers)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("MCP config file still exists after Query: %v", err)
+	}
+}
+
+func TestWriteMCPConfig_SSE(t *testing.T) {
+	sse := MCPServerConfig{Type: MCPServerTypeSSE, URL: "https://example.com/sse", Headers: map[string]string{"X-Key": "k"}}
+	servers := map[string]MCPServerConfig{
+		"events": sse,
+		"remote": {Type: MCPServerTypeHTTP, URL: "https://example.com/mcp"},
+	}
+
+	// The config must survive a round trip through its JSON form
+	data, err := json.Marshal(sse)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var decoded MCPServerConfig
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, sse) {
+		t.Errorf("round trip = %+v, want %+v", decoded, sse)
+	}
+
+	path, err := writeMCPConfig(&ClaudeCodeOptions{McpServers: servers, TempDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("writeMCPConfig() error = %v", err)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading MCP config: %v", err)
+	}
+
+	var raw struct {
+		McpServers map[string]map[string]interface{} `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		t.Fatalf("MCP config %q is not valid JSON: %v", content, err)
+	}
+	for name, wantType := range map[string]string{"events": "sse", "remote": "http"} {
+		if got := raw.McpServers[name]["type"]; got != wantType {
+			t.Errorf("server %s type = %v, want %q (config %s)", name, got, wantType, content)
+		}
+	}
+	if got := raw.McpServers["events"]["url"]; got != sse.URL {
+		t.Errorf("SSE server url = %v, want %q", got, sse.URL)
+	}
+}
+
+func TestQuery_CLIPath(t *testing.T) {
+	dir := t.TempDir()
+	cliPath := filepath.Join(dir, "custom-claude")
+	script := `#!/bin/sh
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"from custom path"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+`
+	if err := os.WriteFile(cliPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write mock CLI: %v", err)
+	}
+	t.Setenv("PATH", "")
+
+	result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{CLIPath: cliPath})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if result.Stdout != "from custom path" {
+		t.Errorf("Query() stdout = %q, want output of the CLI at CLIPath", result.Stdout)
+	}
+
+	missing := filepath.Join(dir, "missing")
+	_, err = Query(context.Background(), "Hello", &ClaudeCodeOptions{CLIPath: missing})
+	var notFound *CLINotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("Query() with missing CLIPath error = %v, want *CLINotFoundError", err)
+	}
+	if len(notFound.SearchPaths) != 1 || notFound.SearchPaths[0] != missing {
+		t.Errorf("CLINotFoundError.SearchPaths = %v, want [%s]", notFound.SearchPaths, missing)
+	}
+}
+
+func TestQuery_StartRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		retries      int
+		exitCode     int
+		wantErr      bool
+		wantAttempts int
+	}{
+		{name: "no retries", failures: 1, retries: 0, wantErr: true, wantAttempts: 1},
+		{name: "recovers", failures: 2, retries: 3, wantAttempts: 3},
+		{name: "retries exhausted", failures: 3, retries: 2, wantErr: true, wantAttempts: 3},
+		{name: "running process not retried", failures: 0, retries: 3, exitCode: 1, wantErr: true, wantAttempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The mock counts its runs in a file, so a relaunch after a
+			// successful start would show up
+			counter := filepath.Join(t.TempDir(), "runs")
+			setupScriptMockCLI(t, `#!/bin/sh
+echo run >> "`+counter+`"
+if [ `+strconv.Itoa(tt.exitCode)+` -ne 0 ]; then
+    exit `+strconv.Itoa(tt.exitCode)+`
+fi
+echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"started"}]}}'
+echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"sessionId":"s1"}}}'
+`)
+
+			attempts := 0
+			t.Cleanup(func() { startCommand = (*exec.Cmd).Start })
+			startCommand = func(cmd *exec.Cmd) error {
+				attempts++
+				if attempts <= tt.failures {
+					return &os.PathError{Op: "fork/exec", Path: cmd.Path, Err: syscall.EAGAIN}
+				}
+				return cmd.Start()
+			}
+
+			result, err := Query(context.Background(), "Hello", &ClaudeCodeOptions{
+				MaxStartRetries:   tt.retries,
+				StartRetryBackoff: time.Millisecond,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Query() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && result.Stdout != "started" {
+				t.Errorf("Query() stdout = %q, want %q", result.Stdout, "started")
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("start attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+
+			runs, _ := os.ReadFile(counter)
+			wantRuns := 0
+			if tt.failures < tt.wantAttempts {
+				wantRuns = 1
+			}
+			if got := strings.Count(string(runs), "run"); got != wantRuns {
+				t.Errorf("CLI ran %d times, want %d", got, wantRuns)
+			}
+		})
+	}
+}
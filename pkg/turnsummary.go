@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"sync"
+	"time"
+)
+
+// TurnSummaryMessage sums up a finished turn in one message. With
+// EmitTurnSummary set it follows every ResultMessage on the stream, and
+// ReceiveResponse delivers it before closing.
+type TurnSummaryMessage struct {
+	Usage ResultUsage `json:"usage"`
+	Cost  ResultCost  `json:"cost"`
+	// Duration runs from the turn's first user message being sent, or
+	// from the CLI starting for a Query, to its result
+	Duration time.Duration `json:"duration"`
+	// ToolUses counts the tool calls Claude made during the turn
+	ToolUses   int    `json:"toolUses"`
+	StopReason string `json:"stopReason,omitempty"`
+	SessionID  string `json:"sessionId,omitempty"`
+}
+
+func (m TurnSummaryMessage) GetRole() MessageRole { return MessageRoleSystem }
+func (m TurnSummaryMessage) GetType() string      { return "turn_summary" }
+
+// turnSummarizer gathers what a TurnSummaryMessage reports that the result
+// doesn't carry. A turn starts with the first user message sent after the
+// previous result.
+type turnSummarizer struct {
+	mu       sync.Mutex
+	inTurn   bool
+	started  time.Time
+	toolUses map[string]bool
+}
+
+// begin marks now as the start of a turn unless one is in progress
+func (s *turnSummarizer) begin(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.inTurn {
+		s.inTurn = true
+		s.started = now
+	}
+}
+
+// observe counts the tool calls in msg
+func (s *turnSummarizer) observe(msg Message) {
+	assistant, ok := msg.(*AssistantMessage)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, block := range assistant.Content {
+		if toolUse, ok := block.(ToolUseBlock); ok {
+			if s.toolUses == nil {
+				s.toolUses = make(map[string]bool)
+			}
+			s.toolUses[toolUse.ID] = true
+		}
+	}
+}
+
+// summarize ends the turn that result finished and returns its summary
+func (s *turnSummarizer) summarize(result ResultMessage, now time.Time) TurnSummaryMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := TurnSummaryMessage{
+		Usage:      result.Data.Usage,
+		Cost:       result.Data.Cost,
+		ToolUses:   len(s.toolUses),
+		StopReason: result.Data.StopReason,
+		SessionID:  result.Data.SessionID,
+	}
+	if s.inTurn {
+		summary.Duration = now.Sub(s.started)
+	}
+	s.inTurn = false
+	s.toolUses = nil
+	return summary
+}
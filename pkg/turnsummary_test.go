@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+const turnSummaryScript = `#!/bin/sh
+respond() {
+    sleep 0.05
+    echo '{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"Read","input":{}},{"type":"tool_use","id":"toolu_2","name":"Grep","input":{}}]}}'
+    echo '{"type":"assistant","message":{"id":"msg_1","role":"assistant","content":[{"type":"tool_use","id":"toolu_2","name":"Grep","input":{}}]}}'
+    echo '{"type":"assistant","message":{"id":"msg_2","role":"assistant","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"},{"type":"text","text":"Done"}]}}'
+    echo '{"type":"system","message":{"role":"system","subtype":"result","data":{"usage":{"inputTokens":10,"outputTokens":20},"cost":{"totalCost":0.003},"sessionId":"summary-session","stopReason":"end_turn"}}}'
+}
+if echo "$*" | grep -q -- '--print'; then
+    respond
+    exit 0
+fi
+while IFS= read -r line; do respond; done
+`
+
+func checkTurnSummary(t *testing.T, summary TurnSummaryMessage) {
+	t.Helper()
+	if summary.Usage.InputTokens != 10 || summary.Usage.OutputTokens != 20 {
+		t.Errorf("summary usage = %+v, want 10 input and 20 output tokens", summary.Usage)
+	}
+	if summary.Cost.TotalCost != 0.003 {
+		t.Errorf("summary cost = %v, want 0.003", summary.Cost.TotalCost)
+	}
+	if summary.ToolUses != 2 {
+		t.Errorf("summary ToolUses = %d, want 2", summary.ToolUses)
+	}
+	if summary.StopReason != StopReasonEndTurn {
+		t.Errorf("summary StopReason = %q, want %q", summary.StopReason, StopReasonEndTurn)
+	}
+	if summary.SessionID != "summary-session" {
+		t.Errorf("summary SessionID = %q, want summary-session", summary.SessionID)
+	}
+	if summary.Duration < 50*time.Millisecond || summary.Duration > 5*time.Second {
+		t.Errorf("summary Duration = %v, want at least the CLI's 50ms delay", summary.Duration)
+	}
+}
+
+func TestClient_EmitTurnSummary(t *testing.T) {
+	setupScriptMockCLI(t, turnSummaryScript)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := NewClient(&ClaudeCodeOptions{EmitTurnSummary: true})
+	if err := client.Connect(ctx, ""); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	for turn := 1; turn <= 2; turn++ {
+		if err := client.SendMessage(ctx, "Search the repo"); err != nil {
+			t.Fatalf("SendMessage() error = %v", err)
+		}
+
+		var messages []Message
+		for msg := range client.ReceiveResponse(ctx) {
+			messages = append(messages, msg)
+		}
+		if len(messages) < 2 {
+			t.Fatalf("turn %d: ReceiveResponse() delivered %d messages, want the result and summary last", turn, len(messages))
+		}
+		if _, ok := messages[len(messages)-2].(ResultMessage); !ok {
+			t.Errorf("turn %d: second to last message = %T, want ResultMessage", turn, messages[len(messages)-2])
+		}
+		summary, ok := messages[len(messages)-1].(TurnSummaryMessage)
+		if !ok {
+			t.Fatalf("turn %d: last message = %T, want TurnSummaryMessage", turn, messages[len(messages)-1])
+		}
+		// The tool counts start over each turn
+		checkTurnSummary(t, summary)
+	}
+}
+
+func TestQuery_EmitTurnSummary(t *testing.T) {
+	setupScriptMockCLI(t, turnSummaryScript)
+
+	result, err := Query(context.Background(), "Search the repo", &ClaudeCodeOptions{EmitTurnSummary: true})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	last := result.Messages[len(result.Messages)-1]
+	summary, ok := last.(TurnSummaryMessage)
+	if !ok {
+		t.Fatalf("last message = %T, want TurnSummaryMessage", last)
+	}
+	checkTurnSummary(t, summary)
+}
+
+func TestQuery_TurnSummaryOffByDefault(t *testing.T) {
+	setupScriptMockCLI(t, turnSummaryScript)
+
+	result, err := Query(context.Background(), "Search the repo", nil)
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	for _, msg := range result.Messages {
+		if _, ok := msg.(TurnSummaryMessage); ok {
+			t.Error("Query() without EmitTurnSummary delivered a TurnSummaryMessage")
+		}
+	}
+}
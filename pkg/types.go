@@ -2,6 +2,9 @@ package pkg
 
 import (
 	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
 )
 
 type PermissionMode string
@@ -38,15 +41,16 @@ func (c *MCPServerConfig) UnmarshalJSON(data []byte) error {
 
 	serverType, ok := raw["type"].(string)
 	if !ok {
-		return json.Unmarshal(data, &struct {
-			Command string   `json:"command"`
-			Args    []string `json:"args"`
+		var legacy struct {
+			Command string            `json:"command"`
+			Args    []string          `json:"args"`
 			Env     map[string]string `json:"env,omitempty"`
-		}{
-			Command: c.Command,
-			Args:    c.Args,
-			Env:     c.Env,
-		})
+		}
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		c.Command, c.Args, c.Env = legacy.Command, legacy.Args, legacy.Env
+		return nil
 	}
 
 	c.Type = MCPServerType(serverType)
@@ -79,6 +83,36 @@ func (c *MCPServerConfig) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// MarshalJSON mirrors UnmarshalJSON, writing only the fields that apply to
+// the server's type. A config without a type keeps the legacy shape.
+func (c MCPServerConfig) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{})
+	if c.Type != "" {
+		out["type"] = c.Type
+	}
+
+	switch c.Type {
+	case MCPServerTypeSSE, MCPServerTypeHTTP:
+		out["url"] = c.URL
+		if c.APIKey != "" {
+			out["apiKey"] = c.APIKey
+		}
+		if len(c.Headers) > 0 {
+			out["headers"] = c.Headers
+		}
+	default:
+		out["command"] = c.Command
+		if len(c.Args) > 0 {
+			out["args"] = c.Args
+		}
+		if len(c.Env) > 0 {
+			out["env"] = c.Env
+		}
+	}
+
+	return json.Marshal(out)
+}
+
 type ClaudeCodeOptions struct {
 	// Python SDK compatible fields
 	AllowedTools              []string                   `json:"allowedTools,omitempty"`
@@ -96,20 +130,204 @@ type ClaudeCodeOptions struct {
 	Cwd                       string                     `json:"cwd,omitempty"`
 	
 	// Additional Go SDK fields (kept for compatibility)
-	ApiKeyName          string                     `json:"apiKeyName,omitempty"`
-	BaseURL             string                     `json:"baseUrl,omitempty"`
+	ApiKeyName          string                     `json:"apiKeyName,omitempty"` // Environment variable whose value the CLI gets as ANTHROPIC_API_KEY
+	BaseURL             string                     `json:"baseUrl,omitempty"` // API endpoint, passed to the CLI as ANTHROPIC_BASE_URL
 	MaxTokens           int                        `json:"maxTokens,omitempty"`
-	MaxBackgroundTokens int                        `json:"maxBackgroundTokens,omitempty"`
-	MaxCostUSD          float64                    `json:"maxCostUsd,omitempty"`
-	Temperature         float64                    `json:"temperature,omitempty"`
+	MaxBackgroundTokens int                        `json:"maxBackgroundTokens,omitempty"` // Enforced by the SDK, see BackgroundTokenLimitExceeded
+	MaxCostUSD          float64                    `json:"maxCostUsd,omitempty"` // Enforced client-side, see CostLimitExceeded
+	Temperature         float64                    `json:"temperature,omitempty"` // Zero means the CLI default
 	CustomInstructions  string                     `json:"customInstructions,omitempty"`
 	Mode                PermissionMode             `json:"mode,omitempty"` // Deprecated: use PermissionMode
 	AssistantID         string                     `json:"assistantId,omitempty"`
 	OnlyTools           []string                   `json:"onlyTools,omitempty"` // Deprecated: use AllowedTools
 	McpServers          map[string]MCPServerConfig `json:"mcpServers,omitempty"`
-	MaxFileUploadsBytes int                        `json:"maxFileUploadsBytes,omitempty"`
-	MaxImagePixels      int                        `json:"maxImagePixels,omitempty"`
+	MaxFileUploadsBytes int                        `json:"maxFileUploadsBytes,omitempty"` // Per attachment, zero means no limit; see AttachmentTooLargeError
+	MaxImagePixels      int                        `json:"maxImagePixels,omitempty"`      // Per image, zero means no limit; see AttachmentTooLargeError
 	SessionID           string                     `json:"sessionId,omitempty"`
+
+	// AutoContinueOnTruncation makes WaitForResult, ReceiveResponse and
+	// ResponseReader send a "continue" prompt when a turn stops at
+	// max_tokens, up to MaxContinuations times (default 3), and hold back
+	// the truncated result. The stitched text is available from Client.ResponseText. The
+	// raw Messages, StreamMessages and IterateMessages streams don't
+	// continue.
+	AutoContinueOnTruncation bool `json:"autoContinueOnTruncation,omitempty"`
+	MaxContinuations         int  `json:"maxContinuations,omitempty"`
+
+	// MessageLogWriter, when set, receives one JSON envelope per parsed
+	// message with a sequence number, timestamp and latency, for structured
+	// logging pipelines.
+	MessageLogWriter io.Writer `json:"-"`
+
+	// MaxMCPServers caps the number of stdio MCP servers in McpServers,
+	// since the CLI spawns a process for each. Zero means no limit.
+	MaxMCPServers int `json:"maxMcpServers,omitempty"`
+
+	// PreserveStdoutWhitespace joins text blocks into QueryResult.Stdout
+	// verbatim. By default trailing whitespace is trimmed from each block.
+	PreserveStdoutWhitespace bool `json:"preserveStdoutWhitespace,omitempty"`
+
+	// QueryCache, when set, lets Query return a stored result for an
+	// identical prompt and options instead of running the CLI again. It is
+	// not used when ToolResultInterceptor or Redactor is set.
+	QueryCache QueryCache `json:"-"`
+
+	// AllowSharedSession lets several clients in this process connect with
+	// the same SessionID. By default the second Connect fails with a
+	// SessionInUseError, since concurrent writers race on one transcript.
+	AllowSharedSession bool `json:"allowSharedSession,omitempty"`
+
+	// StderrLogFormat enables parsing CLI stderr into LogLines delivered on
+	// Client.Logs. Empty disables parsing; raw stderr is captured either way.
+	StderrLogFormat LogFormat `json:"stderrLogFormat,omitempty"`
+
+	// StderrLines enables delivering raw CLI stderr on Client.StderrLines,
+	// one line at a time as it arrives, e.g. to watch MCP servers start.
+	// Stderr is still captured for errors either way.
+	StderrLines bool `json:"stderrLines,omitempty"`
+
+	// Nice sets the CLI process's scheduling priority (-20 to 19; higher
+	// is lower priority) and RLimitAS caps its address space in bytes.
+	// Both are applied on Linux only and ignored elsewhere. Zero leaves
+	// the inherited setting.
+	Nice     int    `json:"nice,omitempty"`
+	RLimitAS uint64 `json:"rlimitAs,omitempty"`
+
+	// MaxPromptChars rejects prompts longer than this many characters with
+	// a PromptTooLargeError before they are sent. Zero means no limit.
+	MaxPromptChars int `json:"maxPromptChars,omitempty"`
+
+	// Redactor, when set, is applied to message text before it is written
+	// to a logging sink such as MessageLogWriter, e.g. to mask PII or
+	// secrets. Messages delivered to the application are not redacted.
+	Redactor func(s string) string `json:"-"`
+
+	// InterruptTimeout is how long SendInterrupt waits for the CLI to
+	// acknowledge an interrupt. Zero means 5 seconds.
+	InterruptTimeout time.Duration `json:"interruptTimeout,omitempty"`
+
+	// ToolPolicy adds structured allow/deny rules, compiled into the same
+	// CLI flags as AllowedTools and DisallowedTools.
+	ToolPolicy *ToolPolicy `json:"toolPolicy,omitempty"`
+
+	// TreatInterruptAsError makes WaitForResult and Query return an
+	// InterruptedError instead of a result when the turn was interrupted.
+	TreatInterruptAsError bool `json:"treatInterruptAsError,omitempty"`
+
+	// Clock overrides the source of time for timestamps and timeouts,
+	// mainly so tests can use a FakeClock. Nil uses the system clock.
+	// Waits for the CLI process to exit on Close always use real time.
+	Clock Clock `json:"-"`
+
+	// IncludePromptEcho keeps the user message some CLI versions echo back
+	// for the --print prompt in QueryResult.Messages. By default it is dropped.
+	IncludePromptEcho bool `json:"includePromptEcho,omitempty"`
+
+	// AuthTimeout fails the session with an AuthRequiredError when the CLI
+	// writes nothing to stdout within this long of starting, which is how a
+	// CLI stuck waiting for an interactive login looks, or when it prints
+	// a login prompt on stderr. Zero disables both checks.
+	AuthTimeout time.Duration `json:"authTimeout,omitempty"`
+
+	// ToolResultInterceptor, if set, is applied to every tool_result block
+	// as assistant and user messages are parsed, before the application, history or
+	// message log see them, e.g. to truncate huge outputs.
+	ToolResultInterceptor func(ToolResultBlock) ToolResultBlock `json:"-"`
+
+	// Tracer, if set, receives a span per Query or client turn with model,
+	// token, cost and tool count attributes, and a child span per tool call.
+	Tracer Tracer `json:"-"`
+
+	// IncludeTrailingMessages makes ReceiveResponse also deliver the system
+	// messages some CLI versions write after the result, such as final
+	// usage, instead of only recording them in the history.
+	IncludeTrailingMessages bool `json:"includeTrailingMessages,omitempty"`
+
+	// EmitTurnSummary adds a TurnSummaryMessage after each ResultMessage,
+	// with the turn's usage, cost, duration, tool calls and stop reason.
+	EmitTurnSummary bool `json:"emitTurnSummary,omitempty"`
+
+	// CoalesceAssistantMessages stores consecutive partial assistant
+	// messages sharing an ID as one assembled message in the client's
+	// history. The stream still delivers each partial message as it arrives.
+	CoalesceAssistantMessages bool `json:"coalesceAssistantMessages,omitempty"`
+
+	// TempDir is where the SDK writes the files it generates for a session,
+	// which are removed when the session closes. Empty means the system
+	// temp directory. It must exist and be writable.
+	TempDir string `json:"tempDir,omitempty"`
+
+	// OfflineOnly refuses to launch any CLI executable that has not been
+	// registered as a mock with RegisterMockCLI, guaranteeing tests never
+	// reach the real CLI and the network.
+	OfflineOnly bool `json:"offlineOnly,omitempty"`
+
+	// QueryTimeout bounds how long Query waits for the CLI to finish before
+	// returning a QueryTimeoutError. Zero means 30 minutes.
+	QueryTimeout time.Duration `json:"queryTimeout,omitempty"`
+
+	// OnClose, if set, is called once when a client closes with its final
+	// SessionReport, including the CloseReason, e.g. to emit metrics.
+	OnClose func(report SessionReport) `json:"-"`
+
+	// CLIPath is the CLI executable to launch. When set, PATH and the usual
+	// install locations are not searched.
+	CLIPath string `json:"cliPath,omitempty"`
+
+	// MaxStartRetries is how many times a CLI that fails to start, e.g.
+	// with a transient fork/exec error, is relaunched before giving up.
+	// A CLI that started is never relaunched.
+	MaxStartRetries int `json:"maxStartRetries,omitempty"`
+
+	// StartRetryBackoff is the delay before the first start retry, doubled
+	// for each further one. Zero means 100ms.
+	StartRetryBackoff time.Duration `json:"startRetryBackoff,omitempty"`
+
+	// ShutdownGrace is how long Close waits for the CLI to exit after
+	// SIGTERM before killing it. Zero means 2s.
+	ShutdownGrace time.Duration `json:"shutdownGrace,omitempty"`
+
+	// IncludePartialMessages asks the CLI to stream text as it is
+	// generated. Each increment arrives as an assistant message holding a
+	// TextDeltaBlock, ahead of the complete message.
+	IncludePartialMessages bool `json:"includePartialMessages,omitempty"`
+
+	// HistoryFile, when set, keeps the client's message history in this
+	// file, holding only the most recent messages in memory. GetMessages
+	// and HistoryCursor read older ones back from disk. The file is
+	// overwritten by each client that uses it.
+	HistoryFile string `json:"historyFile,omitempty"`
+
+	// OnMessage, if set, is called with each message as it is appended to
+	// the history, in order, on the goroutine consuming the stream. It
+	// holds up the stream while it runs, so slow work such as writing to a
+	// database should be handed off.
+	OnMessage func(msg Message) `json:"-"`
+
+	// OnSessionID, if set, is called once with the session ID as soon as
+	// the CLI reports it in its init message or first result, before
+	// OnMessage sees that message. Persisting it there lets a crashed app
+	// resume the session.
+	OnSessionID func(id string) `json:"-"`
+
+	// VerifyCLIPermissions refuses to launch a CLI binary that is not
+	// owned by root or the current user, or that is world-writable, with
+	// a CLISecurityError. Symlinks are resolved first. Only checked on Unix.
+	VerifyCLIPermissions bool `json:"verifyCliPermissions,omitempty"`
+
+	// RawTranscript, if set, receives every line the CLI writes to stdout,
+	// unparsed and in order, after the Redactor if one is set. A recorded
+	// transcript can be played back with ReplayClient.
+	RawTranscript io.Writer `json:"-"`
+
+	// MCPToolTimeout, when set, reports a call to an MCP server's tool as
+	// an MCPTimeoutError if neither its result nor any MCP log output on
+	// stderr arrives within it, to catch a hung server. Zero disables it.
+	MCPToolTimeout time.Duration `json:"mcpToolTimeout,omitempty"`
+
+	// Logger receives the SDK's own diagnostics, such as notices about
+	// deprecated options. Nil means slog.Default().
+	Logger *slog.Logger `json:"-"`
 }
 
 type MessageRole string
@@ -128,11 +346,56 @@ type Message interface {
 type UserMessage struct {
 	Role    MessageRole `json:"role"`
 	Content string      `json:"content"`
+	// Blocks, when set, replaces Content with a list of content blocks
+	// such as tool results.
+	Blocks []ContentBlock `json:"-"`
 }
 
 func (m UserMessage) GetRole() MessageRole { return m.Role }
 func (m UserMessage) GetType() string      { return "user" }
 
+func (m UserMessage) MarshalJSON() ([]byte, error) {
+	if len(m.Blocks) == 0 {
+		type Alias UserMessage
+		return json.Marshal(Alias(m))
+	}
+
+	return json.Marshal(struct {
+		Role    MessageRole    `json:"role"`
+		Content []ContentBlock `json:"content"`
+	}{
+		Role:    m.Role,
+		Content: m.Blocks,
+	})
+}
+
+// UnmarshalJSON mirrors MarshalJSON: string content goes to Content and
+// an array of blocks to Blocks.
+func (m *UserMessage) UnmarshalJSON(data []byte) error {
+	var aux struct {
+		Role    MessageRole     `json:"role"`
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*m = UserMessage{Role: aux.Role}
+	if len(aux.Content) == 0 || string(aux.Content) == "null" {
+		return nil
+	}
+	if aux.Content[0] != '[' {
+		return json.Unmarshal(aux.Content, &m.Content)
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(aux.Content, &raws); err != nil {
+		return err
+	}
+	m.Blocks = decodeContentBlocks(raws)
+	return nil
+}
+
 type ContentBlock interface {
 	GetType() string
 }
@@ -153,6 +416,44 @@ type ToolUseBlock struct {
 
 func (b ToolUseBlock) GetType() string { return "tool_use" }
 
+// InputJSON returns the tool input as indented JSON, "{}" when empty
+func (b ToolUseBlock) InputJSON() string {
+	if b.Input == nil {
+		return "{}"
+	}
+	input, err := json.MarshalIndent(b.Input, "", "  ")
+	if err != nil {
+		return "{}"
+	}
+	return string(input)
+}
+
+// InputString returns the input value for key: strings as they are, and
+// other values as compact JSON. It reports false if key is absent.
+func (b ToolUseBlock) InputString(key string) (string, bool) {
+	value, ok := b.Input[key]
+	if !ok {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	// Input decoded from JSON always encodes again
+	data, _ := json.Marshal(value)
+	return string(data), true
+}
+
+// ThinkingBlock is Claude's reasoning ahead of its answer, sent when
+// extended thinking is enabled with MaxThinkingTokens. Signature verifies
+// the block if it is passed back to the API.
+type ThinkingBlock struct {
+	Type      string `json:"type"`
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature,omitempty"`
+}
+
+func (b ThinkingBlock) GetType() string { return "thinking" }
+
 type ToolResultBlock struct {
 	Type       string                 `json:"type"`
 	ToolUseID  string                 `json:"tool_use_id"`
@@ -162,7 +463,22 @@ type ToolResultBlock struct {
 
 func (b ToolResultBlock) GetType() string { return "tool_result" }
 
+// TextDeltaBlock is an increment of the text block at Index of the
+// assistant message being generated, streamed when IncludePartialMessages
+// is set. Consumers build the text by appending the deltas of each index
+// in order; the complete message still arrives afterwards.
+type TextDeltaBlock struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	Delta string `json:"text"`
+}
+
+func (b TextDeltaBlock) GetType() string { return "text_delta" }
+
 type AssistantMessage struct {
+	// ID is the API message ID. Partial messages streamed for the same
+	// response share it.
+	ID      string         `json:"id,omitempty"`
 	Role    MessageRole    `json:"role"`
 	Content []ContentBlock `json:"content"`
 }
@@ -170,6 +486,16 @@ type AssistantMessage struct {
 func (m AssistantMessage) GetRole() MessageRole { return m.Role }
 func (m AssistantMessage) GetType() string      { return "assistant" }
 
+// isDelta reports whether m only carries streamed text deltas.
+func (m *AssistantMessage) isDelta() bool {
+	for _, block := range m.Content {
+		if _, ok := block.(TextDeltaBlock); !ok {
+			return false
+		}
+	}
+	return len(m.Content) > 0
+}
+
 func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 	type Alias AssistantMessage
 	aux := &struct {
@@ -183,8 +509,15 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 		return err
 	}
 
-	m.Content = make([]ContentBlock, 0, len(aux.Content))
-	for _, raw := range aux.Content {
+	m.Content = decodeContentBlocks(aux.Content)
+	return nil
+}
+
+// decodeContentBlocks decodes the content blocks of a message, skipping
+// malformed blocks and types the SDK doesn't model.
+func decodeContentBlocks(raws []json.RawMessage) []ContentBlock {
+	blocks := make([]ContentBlock, 0, len(raws))
+	for _, raw := range raws {
 		var typeCheck struct {
 			Type string `json:"type"`
 		}
@@ -209,14 +542,28 @@ func (m *AssistantMessage) UnmarshalJSON(data []byte) error {
 			if err := json.Unmarshal(raw, &trb); err == nil {
 				block = trb
 			}
+		case "text_delta":
+			var tdb TextDeltaBlock
+			if err := json.Unmarshal(raw, &tdb); err == nil {
+				block = tdb
+			}
+		case "thinking":
+			var thb ThinkingBlock
+			if err := json.Unmarshal(raw, &thb); err == nil {
+				block = thb
+			}
+		case "image":
+			var ib ImageBlock
+			if err := json.Unmarshal(raw, &ib); err == nil {
+				block = ib
+			}
 		}
 
 		if block != nil {
-			m.Content = append(m.Content, block)
+			blocks = append(blocks, block)
 		}
 	}
-
-	return nil
+	return blocks
 }
 
 type SystemMessageSubtype string
@@ -231,12 +578,23 @@ const (
 	SystemMessageSubtypeFile          SystemMessageSubtype = "file"
 	SystemMessageSubtypeInterrupted   SystemMessageSubtype = "interrupted"
 	SystemMessageSubtypeUserPromptSubmitHook SystemMessageSubtype = "user_prompt_submit_hook"
+	SystemMessageSubtypeCostWarning   SystemMessageSubtype = "cost_warning"
+	SystemMessageSubtypeInit          SystemMessageSubtype = "init"
+	// Sent by the SDK, not the CLI, when the session's cost passes MaxCostUSD
+	SystemMessageSubtypeCostLimitExceeded SystemMessageSubtype = "cost_limit_exceeded"
+	// Sent by the SDK when the session's assistant turns reach MaxTurns
+	SystemMessageSubtypeMaxTurnsReached SystemMessageSubtype = "max_turns_reached"
+	// Sent by the SDK when the session's background tokens pass MaxBackgroundTokens
+	SystemMessageSubtypeBackgroundTokenLimitExceeded SystemMessageSubtype = "background_token_limit_exceeded"
 )
 
 type SystemMessage struct {
 	Role    MessageRole          `json:"role"`
 	Subtype SystemMessageSubtype `json:"subtype"`
 	Data    interface{}          `json:"data,omitempty"`
+	// Raw is the undecoded message payload, kept so consumers can handle
+	// subtypes the SDK doesn't model.
+	Raw json.RawMessage `json:"-"`
 }
 
 func (m SystemMessage) GetRole() MessageRole { return m.Role }
@@ -259,11 +617,38 @@ type ResultCost struct {
 	TotalCost            float64 `json:"totalCost"`
 }
 
+// CostWarning is emitted by the CLI as a cost_warning system message when a
+// session approaches a spend threshold.
+type CostWarning struct {
+	Threshold   float64 `json:"threshold"`
+	CurrentCost float64 `json:"currentCost"`
+	Message     string  `json:"message,omitempty"`
+}
+
+// Stop reasons reported in ResultMessageData.StopReason
+const (
+	StopReasonEndTurn      = "end_turn"
+	StopReasonMaxTokens    = "max_tokens"
+	StopReasonStopSequence = "stop_sequence"
+	StopReasonToolUse      = "tool_use"
+)
+
 type ResultMessageData struct {
 	Usage              ResultUsage `json:"usage"`
 	Cost               ResultCost  `json:"cost"`
 	SessionID          string      `json:"sessionId"`
 	InterruptRequested bool        `json:"interruptRequested"`
+	StopReason         string      `json:"stopReason,omitempty"`
+	// StopSequence is the stop sequence that ended the response when
+	// StopReason is StopReasonStopSequence.
+	StopSequence string `json:"stopSequence,omitempty"`
+	// Model is the model that actually served the request, which may differ
+	// from the requested one when an alias was resolved or a fallback
+	// model engaged.
+	Model string `json:"model,omitempty"`
+	// IsError reports that the turn ended in an error rather than an
+	// answer, e.g. an API failure the CLI gave up on.
+	IsError bool `json:"isError,omitempty"`
 }
 
 type ResultMessage struct {
@@ -274,6 +659,19 @@ type ResultMessage struct {
 func (m ResultMessage) GetRole() MessageRole { return MessageRoleSystem }
 func (m ResultMessage) GetType() string      { return "result" }
 
+// UsedModel returns the model that served the request, or "" if neither
+// the result nor the session's init message reported one.
+func (m ResultMessage) UsedModel() string { return m.Data.Model }
+
+// StopSequence returns the stop sequence that ended the response. ok is
+// false unless the response stopped because of a stop sequence.
+func (m ResultMessage) StopSequence() (sequence string, ok bool) {
+	if m.Data.StopReason != StopReasonStopSequence {
+		return "", false
+	}
+	return m.Data.StopSequence, true
+}
+
 type InputMessage struct {
 	Type               string        `json:"type"`
 	Message            Message       `json:"message"`
@@ -285,6 +683,9 @@ type ControlRequestType string
 
 const (
 	ControlRequestTypeInterrupt ControlRequestType = "interrupt"
+	// Sent by CheckClientAlive; any response shows the CLI is serving
+	// the control protocol
+	ControlRequestTypeInitialize ControlRequestType = "initialize"
 )
 
 type ControlRequest struct {
@@ -292,6 +693,9 @@ type ControlRequest struct {
 	RequestID string             `json:"request_id"`
 	Request   struct {
 		Subtype ControlRequestType `json:"subtype"`
+		// Reason optionally explains the request, e.g. why a turn is
+		// being interrupted
+		Reason string `json:"reason,omitempty"`
 	} `json:"request"`
 }
 
@@ -301,12 +705,17 @@ type ControlResponse struct {
 	Response  struct {
 		Success bool   `json:"success"`
 		Error   string `json:"error,omitempty"`
+		// Reason is the request's reason as acknowledged by the CLI, if
+		// it echoes one
+		Reason string `json:"reason,omitempty"`
 	} `json:"response"`
 }
 
 type StreamMessage struct {
 	Type    string          `json:"type"`
 	Message json.RawMessage `json:"message"`
+	// Event is the API streaming event of a stream_event line
+	Event json.RawMessage `json:"event,omitempty"`
 }
 
 func (s *StreamMessage) Parse() (Message, error) {
@@ -339,6 +748,7 @@ func parseMessage(msgType string, data json.RawMessage) (Message, error) {
 
 		var msg SystemMessage
 		err := json.Unmarshal(data, &msg)
+		msg.Raw = data
 		return msg, err
 	default:
 		return nil, nil
@@ -247,4 +247,246 @@ func TestClaudeCodeOptions_JSON(t *testing.T) {
 	if !reflect.DeepEqual(options, decoded) {
 		t.Errorf("Round trip failed:\ngot  = %+v\nwant = %+v", decoded, options)
 	}
-}
\ No newline at end of file
+}
+func TestUserMessage_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  UserMessage
+		want string
+	}{
+		{
+			name: "string content",
+			msg:  UserMessage{Role: MessageRoleUser, Content: "hello"},
+			want: `{"role":"user","content":"hello"}`,
+		},
+		{
+			name: "block content",
+			msg: UserMessage{Role: MessageRoleUser, Blocks: []ContentBlock{
+				ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_1", Content: "42"},
+			}},
+			want: `{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"42"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.msg)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserMessage_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want UserMessage
+	}{
+		{
+			name: "string content",
+			data: `{"role":"user","content":"hello"}`,
+			want: UserMessage{Role: MessageRoleUser, Content: "hello"},
+		},
+		{
+			name: "block content",
+			data: `{"role":"user","content":[{"type":"text","text":"see result"},{"type":"tool_result","tool_use_id":"toolu_1","content":"42"},{"type":"unknown"}]}`,
+			want: UserMessage{Role: MessageRoleUser, Blocks: []ContentBlock{
+				TextBlock{Type: "text", Text: "see result"},
+				ToolResultBlock{Type: "tool_result", ToolUseID: "toolu_1", Content: "42"},
+			}},
+		},
+		{
+			name: "no content",
+			data: `{"role":"user"}`,
+			want: UserMessage{Role: MessageRoleUser},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got UserMessage
+			if err := json.Unmarshal([]byte(tt.data), &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	var msg UserMessage
+	if err := json.Unmarshal([]byte(`{"role":"user","content":42}`), &msg); err == nil {
+		t.Error("Unmarshal() of numeric content error = nil, want error")
+	}
+}
+
+func TestMCPServerConfig_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		config MCPServerConfig
+		want   string
+	}{
+		{
+			name: "stdio server",
+			config: MCPServerConfig{
+				Type:    MCPServerTypeStdio,
+				Command: "node",
+				Args:    []string{"server.js"},
+				Env:     map[string]string{"NODE_ENV": "production"},
+			},
+			want: `{"args":["server.js"],"command":"node","env":{"NODE_ENV":"production"},"type":"stdio"}`,
+		},
+		{
+			name: "http server",
+			config: MCPServerConfig{
+				Type:    MCPServerTypeHTTP,
+				URL:     "https://api.example.com/mcp",
+				Headers: map[string]string{"Authorization": "Bearer token"},
+			},
+			want: `{"headers":{"Authorization":"Bearer token"},"type":"http","url":"https://api.example.com/mcp"}`,
+		},
+		{
+			name: "sse server",
+			config: MCPServerConfig{
+				Type:   MCPServerTypeSSE,
+				URL:    "https://api.example.com/sse",
+				APIKey: "secret123",
+			},
+			want: `{"apiKey":"secret123","type":"sse","url":"https://api.example.com/sse"}`,
+		},
+		{
+			name: "legacy format (no type)",
+			config: MCPServerConfig{
+				Command: "python",
+				Args:    []string{"-m", "server"},
+			},
+			want: `{"args":["-m","server"],"command":"python"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.config)
+			if err != nil {
+				t.Fatalf("MarshalJSON() error = %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("MarshalJSON() = %s, want %s", data, tt.want)
+			}
+
+			var roundTrip MCPServerConfig
+			if err := json.Unmarshal(data, &roundTrip); err != nil {
+				t.Fatalf("UnmarshalJSON() error = %v", err)
+			}
+			if !reflect.DeepEqual(roundTrip, tt.config) {
+				t.Errorf("round trip = %+v, want %+v", roundTrip, tt.config)
+			}
+		})
+	}
+}
+
+func TestResultMessage_StopSequence(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   string
+		wantOK bool
+	}{
+		{
+			name:   "matched stop sequence",
+			data:   `{"stopReason":"stop_sequence","stopSequence":"\n\nHuman:"}`,
+			want:   "\n\nHuman:",
+			wantOK: true,
+		},
+		{
+			name: "end of turn",
+			data: `{"stopReason":"end_turn"}`,
+		},
+		{
+			name: "sequence without stop_sequence reason",
+			data: `{"stopReason":"max_tokens","stopSequence":"END"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := `{"type":"system","message":{"role":"system","subtype":"result","data":` + tt.data + `}}`
+			msg, err := ParseLine([]byte(line))
+			if err != nil {
+				t.Fatalf("ParseLine() error = %v", err)
+			}
+			result, ok := msg.(ResultMessage)
+			if !ok {
+				t.Fatalf("ParseLine() = %T, want ResultMessage", msg)
+			}
+
+			got, gotOK := result.StopSequence()
+			if got != tt.want || gotOK != tt.wantOK {
+				t.Errorf("StopSequence() = (%q, %v), want (%q, %v)", got, gotOK, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestToolUseBlock_InputJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		input map[string]interface{}
+		want  string
+	}{
+		{name: "nil", input: nil, want: "{}"},
+		{name: "empty", input: map[string]interface{}{}, want: "{}"},
+		{
+			name: "nested",
+			input: map[string]interface{}{
+				"path":    "main.go",
+				"options": map[string]interface{}{"lines": []interface{}{1.0, 2.0}, "recursive": true},
+			},
+			want: "{\n  \"options\": {\n    \"lines\": [\n      1,\n      2\n    ],\n    \"recursive\": true\n  },\n  \"path\": \"main.go\"\n}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := ToolUseBlock{Type: "tool_use", Name: "Read", Input: tt.input}
+			if got := block.InputJSON(); got != tt.want {
+				t.Errorf("InputJSON() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolUseBlock_InputString(t *testing.T) {
+	block := ToolUseBlock{Type: "tool_use", Name: "Bash", Input: map[string]interface{}{
+		"command": "ls -la",
+		"timeout": 30.0,
+		"env":     map[string]interface{}{"DEBUG": "1"},
+		"empty":   "",
+	}}
+
+	tests := []struct {
+		key    string
+		want   string
+		wantOK bool
+	}{
+		{key: "command", want: "ls -la", wantOK: true},
+		{key: "timeout", want: "30", wantOK: true},
+		{key: "env", want: `{"DEBUG":"1"}`, wantOK: true},
+		{key: "empty", want: "", wantOK: true},
+		{key: "missing", want: "", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, ok := block.InputString(tt.key)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("InputString(%q) = %q, %v, want %q, %v", tt.key, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}